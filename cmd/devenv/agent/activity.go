@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/client-go/kubernetes"
+)
+
+// apiRequestsMetric is the API-server metric that counts requests
+const apiRequestsMetric = "apiserver_request_total"
+
+// userVerbs are request verbs that are generally only made by a user, or
+// the tools they run, rather than by the cluster itself. Reads are ignored
+// because controllers constantly make them.
+//
+//nolint:gochecknoglobals // Why: Used as a constant set
+var userVerbs = map[string]bool{
+	"CREATE":           true,
+	"UPDATE":           true,
+	"PATCH":            true,
+	"APPLY":            true,
+	"DELETE":           true,
+	"DELETECOLLECTION": true,
+	"CONNECT":          true,
+}
+
+// userSubresources are subresources that, when read, indicate a user
+// is interacting with the cluster, e.g. 'kubectl logs'.
+//
+//nolint:gochecknoglobals // Why: Used as a constant set
+var userSubresources = map[string]bool{
+	"log":         true,
+	"exec":        true,
+	"attach":      true,
+	"portforward": true,
+	"proxy":       true,
+}
+
+// systemResources are resources that the cluster itself
+// constantly writes to, so they aren't considered activity.
+//
+//nolint:gochecknoglobals // Why: Used as a constant set
+var systemResources = map[string]bool{
+	"leases":         true,
+	"events":         true,
+	"endpoints":      true,
+	"endpointslices": true,
+}
+
+// isUserRequest returns true if a request, identified by the labels of
+// the apiserver_request_total metric, was likely made by a user.
+func isUserRequest(labels map[string]string) bool {
+	if userSubresources[labels["subresource"]] {
+		return true
+	}
+
+	if labels["subresource"] == "status" || systemResources[labels["resource"]] {
+		return false
+	}
+
+	return userVerbs[labels["verb"]]
+}
+
+// countUserRequests returns the number of requests, in a Prometheus
+// text exposition of the API-server's metrics, that were likely made by
+// a user.
+func countUserRequests(r io.Reader) (float64, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse metrics")
+	}
+
+	mf, ok := families[apiRequestsMetric]
+	if !ok {
+		return 0, errors.Errorf("metric %s not found", apiRequestsMetric)
+	}
+
+	var total float64
+	for _, m := range mf.Metric {
+		labels := make(map[string]string)
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+
+		if isUserRequest(labels) && m.Counter != nil {
+			total += m.Counter.GetValue()
+		}
+	}
+
+	return total, nil
+}
+
+// getUserRequests returns the number of requests made to the API-server,
+// since it started, that were likely made by a user.
+func getUserRequests(ctx context.Context, k kubernetes.Interface) (float64, error) {
+	b, err := k.Discovery().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get API-server metrics")
+	}
+
+	return countUserRequests(bytes.NewReader(b))
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCountUserRequests(t *testing.T) {
+	metrics := `# HELP apiserver_request_total Counter of apiserver requests
+# TYPE apiserver_request_total counter
+apiserver_request_total{code="200",resource="pods",subresource="",verb="LIST"} 100
+apiserver_request_total{code="201",resource="deployments",subresource="",verb="CREATE"} 2
+apiserver_request_total{code="200",resource="deployments",subresource="",verb="PATCH"} 3
+apiserver_request_total{code="200",resource="pods",subresource="status",verb="PATCH"} 50
+apiserver_request_total{code="200",resource="leases",subresource="",verb="UPDATE"} 500
+apiserver_request_total{code="200",resource="pods",subresource="log",verb="GET"} 4
+apiserver_request_total{code="101",resource="pods",subresource="portforward",verb="CONNECT"} 1
+`
+
+	count, err := countUserRequests(strings.NewReader(metrics))
+	assert.NilError(t, err)
+	assert.Equal(t, count, float64(10))
+
+	_, err = countUserRequests(strings.NewReader("# TYPE other counter\nother 1\n"))
+	assert.ErrorContains(t, err, "not found")
+}
@@ -0,0 +1,336 @@
+// Package agent implements the agent devenv command
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getoutreach/devenv/cmd/devenv/stop"
+	"github.com/getoutreach/devenv/internal/alert"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/crashes"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	"github.com/getoutreach/devenv/pkg/status"
+	"github.com/getoutreach/gobox/pkg/async"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/getoutreach/localizer/pkg/localizer"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+//nolint:gochecknoglobals
+var (
+	agentLongDesc = `
+		Agent runs in the background and stops your local developer environment once it has been idle for a while, saving battery and memory.
+
+		Your developer environment is considered active when the devenv CLI (including kubectl) is used, when requests are made to the Kubernetes API server, or when traffic is sent through localizer tunnels. A desktop notification is sent before your developer environment is stopped, any activity after that will keep it running.
+
+		Remote developer environments are ignored, as they have their own sleep mode.
+
+		With --capture-crashes, the logs, specs and events of crashing pods are also saved in the background, see 'devenv crashes'.
+	`
+	agentExample = `
+		# Stop your developer environment after it has been idle for 2 hours
+		devenv agent
+
+		# Stop your developer environment after it has been idle for 30 minutes
+		devenv agent --idle-timeout 30m
+
+		# Also capture crashing pods while your developer environment is running
+		devenv agent --capture-crashes
+	`
+)
+
+// Options holds the options for the agent command
+type Options struct {
+	log logrus.FieldLogger
+	b   *box.Config
+
+	// IdleTimeout is how long the developer environment needs to be
+	// idle before it is stopped
+	IdleTimeout time.Duration
+
+	// CheckInterval is how often to check for activity
+	CheckInterval time.Duration
+
+	// WarnBefore is how long before stopping the developer
+	// environment to notify the user
+	WarnBefore time.Duration
+
+	// APIRequestThreshold is the number of requests made by a user to the
+	// API server, per CheckInterval, that is considered activity
+	APIRequestThreshold int
+
+	// TunnelBytesThreshold is the number of bytes sent through localizer
+	// tunnels, per CheckInterval, that is considered activity
+	TunnelBytesThreshold uint64
+
+	// CaptureCrashes saves the logs, specs and events of
+	// crashing pods every CheckInterval
+	CaptureCrashes bool
+}
+
+// NewOptions creates a new Options instance for the agent command
+func NewOptions(log logrus.FieldLogger) (*Options, error) {
+	b, err := box.LoadBox()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load box configuration")
+	}
+
+	return &Options{
+		log: log,
+		b:   b,
+	}, nil
+}
+
+// NewCmdAgent creates a new command for the agent subcommand
+func NewCmdAgent(log logrus.FieldLogger) *cli.Command {
+	return &cli.Command{
+		Name:        "agent",
+		Usage:       "Stop your developer environment when it's idle",
+		Description: cmdutil.NewDescription(agentLongDesc, agentExample),
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "idle-timeout",
+				Usage: "How long your developer environment must be idle before it is stopped",
+				Value: 2 * time.Hour,
+			},
+			&cli.DurationFlag{
+				Name:  "check-interval",
+				Usage: "How often to check for activity",
+				Value: time.Minute,
+			},
+			&cli.DurationFlag{
+				Name:  "warn-before",
+				Usage: "How long before stopping your developer environment to send a notification",
+				Value: 5 * time.Minute,
+			},
+			&cli.IntFlag{
+				Name:  "api-request-threshold",
+				Usage: "Number of API server requests, per check interval, that is considered activity",
+				Value: 10,
+			},
+			&cli.Uint64Flag{
+				Name:  "tunnel-bytes-threshold",
+				Usage: "Number of bytes sent through localizer tunnels, per check interval, that is considered activity",
+				Value: 64 * 1024,
+			},
+			&cli.BoolFlag{
+				Name:  "capture-crashes",
+				Usage: "Save the logs, specs and events of crashing pods, see 'devenv crashes'",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			o, err := NewOptions(log)
+			if err != nil {
+				return err
+			}
+			o.IdleTimeout = c.Duration("idle-timeout")
+			o.CheckInterval = c.Duration("check-interval")
+			o.WarnBefore = c.Duration("warn-before")
+			o.APIRequestThreshold = c.Int("api-request-threshold")
+			o.TunnelBytesThreshold = c.Uint64("tunnel-bytes-threshold")
+			o.CaptureCrashes = c.Bool("capture-crashes")
+
+			return o.Run(c.Context)
+		},
+	}
+}
+
+// tracker tracks activity in the developer environment between checks
+type tracker struct {
+	// lastActive is the last time activity was seen
+	lastActive time.Time
+
+	// warned denotes if the user was notified that the
+	// developer environment is about to be stopped
+	warned bool
+
+	// requests is the number of user requests made to the
+	// API server as of the last check, or -1 if unknown.
+	requests float64
+
+	// tunnelBytes is the number of bytes sent to and from the
+	// nodes as of the last check, or 0 if unknown.
+	tunnelBytes uint64
+
+	// ownRequests is the number of requests, counted as user requests,
+	// that the agent made since the last check, e.g. to capture logs.
+	ownRequests float64
+}
+
+// reset resets the tracker, marking the developer environment as active
+func (t *tracker) reset() {
+	t.lastActive = time.Now()
+	t.warned = false
+	t.requests = -1
+	t.tunnelBytes = 0
+	t.ownRequests = 0
+}
+
+// active marks the developer environment as active
+func (t *tracker) active(log logrus.FieldLogger, source string) {
+	log.WithField("source", source).Debug("Detected activity")
+	t.lastActive = time.Now()
+	t.warned = false
+}
+
+// getKindRuntime returns the current runtime, if it is a running
+// kind runtime, otherwise nil is returned.
+func (o *Options) getKindRuntime(ctx context.Context) *kubernetesruntime.KindRuntime {
+	conf, err := config.LoadConfig(ctx)
+	if err != nil {
+		return nil
+	}
+
+	r, err := kubernetesruntime.GetRuntimeFromContext(conf, o.b)
+	if err != nil {
+		return nil
+	}
+
+	kr, ok := r.(*kubernetesruntime.KindRuntime)
+	if !ok {
+		return nil
+	}
+	kr.Configure(o.log, o.b)
+
+	if kr.Status(ctx).Status.Status != status.Running {
+		return nil
+	}
+
+	return kr
+}
+
+// check checks for activity in the developer environment, updating
+// the tracker. Sources that can't be checked are skipped.
+func (o *Options) check(ctx context.Context, kr *kubernetesruntime.KindRuntime, t *tracker) {
+	if last, err := devenvutil.LastActivity(); err == nil && last.After(t.lastActive) {
+		t.active(o.log, "cli")
+	}
+
+	// Traffic between the host and the nodes is only measured between
+	// API server checks, so that the metrics requests aren't counted.
+	if localizer.IsRunning() {
+		if n, err := kr.NetworkBytes(ctx); err == nil {
+			if t.tunnelBytes != 0 && n > t.tunnelBytes && n-t.tunnelBytes >= o.TunnelBytesThreshold {
+				t.active(o.log, "tunnel")
+			}
+		}
+	}
+
+	k, err := kube.GetKubeClient()
+	if err != nil {
+		o.log.WithError(err).Warn("Failed to create kubernetes client")
+		return
+	}
+
+	requests, err := getUserRequests(ctx, k)
+	if err != nil {
+		o.log.WithError(err).Warn("Failed to get API server requests")
+	} else {
+		// The counters reset when the API server restarts, so a decrease
+		// is treated as the start of a new measurement.
+		if t.requests >= 0 && requests >= t.requests && requests-t.requests-t.ownRequests >= float64(o.APIRequestThreshold) {
+			t.active(o.log, "apiserver")
+		}
+		t.requests = requests
+	}
+
+	t.ownRequests = 0
+	if o.CaptureCrashes {
+		t.ownRequests = o.captureCrashes(ctx, k)
+	}
+
+	t.tunnelBytes = 0
+	if localizer.IsRunning() {
+		if n, err := kr.NetworkBytes(ctx); err == nil {
+			t.tunnelBytes = n
+		}
+	}
+}
+
+// captureCrashes captures crashing pods, returning the number of requests
+// made that are counted as user requests, i.e. reading container logs.
+func (o *Options) captureCrashes(ctx context.Context, k kubernetes.Interface) float64 {
+	pods, err := k.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		o.log.WithError(err).Warn("Failed to list pods")
+		return 0
+	}
+
+	podPtrs := make([]*corev1.Pod, len(pods.Items))
+	for i := range pods.Items {
+		podPtrs[i] = &pods.Items[i]
+	}
+
+	crash, err := crashes.Capture(ctx, k, o.log, podPtrs)
+	if err != nil {
+		o.log.WithError(err).Warn("Failed to capture crashing pods")
+		return 0
+	} else if crash == nil {
+		return 0
+	}
+
+	o.log.WithField("crash", crash.ID).Info("Captured crashing pods")
+	alert.Alert(fmt.Sprintf("%d container(s) crashed in your developer environment, run 'devenv crashes show %s' to see why",
+		len(crash.Containers), crash.ID))
+
+	return float64(len(crash.Containers))
+}
+
+// Run runs the agent command
+func (o *Options) Run(ctx context.Context) error {
+	if o.WarnBefore >= o.IdleTimeout {
+		return fmt.Errorf("--warn-before must be less than --idle-timeout")
+	}
+
+	o.log.WithField("idle-timeout", o.IdleTimeout).Info("Watching developer environment for activity")
+
+	t := &tracker{}
+	t.reset()
+	for ctx.Err() == nil {
+		kr := o.getKindRuntime(ctx)
+		if kr == nil {
+			// Nothing to stop, so start the idle period
+			// over once the developer environment is running.
+			t.reset()
+			async.Sleep(ctx, o.CheckInterval)
+			continue
+		}
+
+		o.check(ctx, kr, t)
+
+		idle := time.Since(t.lastActive)
+		switch {
+		case idle >= o.IdleTimeout:
+			o.log.WithField("idle", idle.Round(time.Second)).Info("Developer environment is idle, stopping it")
+			alert.Alert(fmt.Sprintf("Your developer environment has been idle for %s and is being stopped, run 'devenv start' to start it again",
+				idle.Round(time.Minute)))
+
+			so, err := stop.NewOptions(o.log)
+			if err == nil {
+				err = so.Run(ctx)
+			}
+			if err != nil {
+				o.log.WithError(err).Error("Failed to stop developer environment")
+			}
+			t.reset()
+		case idle >= o.IdleTimeout-o.WarnBefore && !t.warned:
+			alert.Alert(fmt.Sprintf("Your developer environment is idle and will be stopped in %s, use it to keep it running",
+				(o.IdleTimeout - idle).Round(time.Minute)))
+			t.warned = true
+		}
+
+		async.Sleep(ctx, o.CheckInterval)
+	}
+
+	return nil
+}
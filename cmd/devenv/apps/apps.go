@@ -7,6 +7,7 @@ import (
 	"github.com/getoutreach/devenv/cmd/devenv/apps/list"
 	"github.com/getoutreach/devenv/cmd/devenv/apps/run"
 	"github.com/getoutreach/devenv/cmd/devenv/apps/shell"
+	"github.com/getoutreach/devenv/cmd/devenv/apps/top"
 	"github.com/getoutreach/devenv/cmd/devenv/apps/update"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -28,6 +29,7 @@ func NewCmd(log logrus.FieldLogger) *cli.Command {
 			run.NewCmd(log),
 			shell.NewCmd(log),
 			e2e.NewCmd(log),
+			top.NewCmd(log),
 		},
 	}
 }
@@ -0,0 +1,301 @@
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/getoutreach/devenv/internal/apps"
+	"github.com/getoutreach/devenv/pkg/app"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+//nolint:gochecknoglobals
+var (
+	topLongDesc = `
+		Shows the resources requested and used by each application deployed in your devenv. Usage requires metrics-server to be running.
+
+		With --enforce, the ResourceQuota and LimitRange configured in each application's devenv.yaml are applied to its namespaces.
+	`
+	topExample = `
+		# Show the resources used by each application in your devenv
+		devenv apps top
+
+		# Return the resources used in json
+		devenv apps top --output json
+
+		# Apply the resource quotas from each application's devenv.yaml
+		devenv apps top --enforce
+	`
+)
+
+// Options are various options for the `apps top` command
+type Options struct {
+	log  logrus.FieldLogger
+	k    kubernetes.Interface
+	conf *rest.Config
+
+	// Format is the format to output in
+	// table or json
+	Format string
+
+	// Enforce applies the resource quotas configured in
+	// each application's devenv.yaml
+	Enforce bool
+}
+
+// AppUsage is the resources requested and used by an application
+type AppUsage struct {
+	// Name is the name of the application
+	Name string `json:"name"`
+
+	// Pods is the number of running pods of the application
+	Pods int `json:"pods"`
+
+	// CPURequests is the total CPU requested by the application
+	CPURequests resource.Quantity `json:"cpuRequests"`
+
+	// CPUUsage is the total CPU used by the application, this
+	// is nil if metrics-server is unavailable.
+	CPUUsage *resource.Quantity `json:"cpuUsage,omitempty"`
+
+	// MemoryRequests is the total memory requested by the application
+	MemoryRequests resource.Quantity `json:"memoryRequests"`
+
+	// MemoryUsage is the total memory used by the application, this
+	// is nil if metrics-server is unavailable.
+	MemoryUsage *resource.Quantity `json:"memoryUsage,omitempty"`
+}
+
+// NewOptions create an initialized options struct for the `apps top` command
+func NewOptions(log logrus.FieldLogger) (*Options, error) {
+	k, conf, err := kube.GetKubeClientWithConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kubernetes client")
+	}
+
+	return &Options{
+		k:    k,
+		conf: conf,
+		log:  log,
+	}, nil
+}
+
+// NewCmd creates a new cli.Command for the `apps top` command
+func NewCmd(log logrus.FieldLogger) *cli.Command {
+	return &cli.Command{
+		Name:  "top",
+		Usage: "Show the resources requested and used by each application in your devenv",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Change the output format, valid options are: table, json",
+				Value:   "table",
+			},
+			&cli.BoolFlag{
+				Name:  "enforce",
+				Usage: "Apply the resource quotas configured in each application's devenv.yaml",
+			},
+		},
+		Description: cmdutil.NewDescription(topLongDesc, topExample),
+		Action: func(c *cli.Context) error {
+			o, err := NewOptions(log)
+			if err != nil {
+				return err
+			}
+			o.Format = c.String("output")
+			o.Enforce = c.Bool("enforce")
+			return o.Run(c.Context)
+		},
+	}
+}
+
+// getUsage returns the resources requested and used by an application. If
+// metrics is nil, usage is not returned.
+func (o *Options) getUsage(ctx context.Context, mc metricsclient.Interface, name string) (*AppUsage, error) {
+	usage := &AppUsage{Name: name}
+	if mc != nil {
+		usage.CPUUsage = &resource.Quantity{}
+		usage.MemoryUsage = &resource.Quantity{}
+	}
+
+	for _, ns := range app.Namespaces(name) {
+		pods, err := o.k.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list pods in %s", ns)
+		}
+
+		for i := range pods.Items {
+			p := &pods.Items[i]
+			if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+				continue
+			}
+
+			usage.Pods++
+			for j := range p.Spec.Containers {
+				usage.CPURequests.Add(*p.Spec.Containers[j].Resources.Requests.Cpu())
+				usage.MemoryRequests.Add(*p.Spec.Containers[j].Resources.Requests.Memory())
+			}
+		}
+
+		if mc == nil || len(pods.Items) == 0 {
+			continue
+		}
+
+		metrics, err := mc.MetricsV1beta1().PodMetricses(ns).List(ctx, metav1.ListOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "failed to get pod metrics in %s", ns)
+		} else if err != nil {
+			continue
+		}
+
+		for i := range metrics.Items {
+			for j := range metrics.Items[i].Containers {
+				usage.CPUUsage.Add(*metrics.Items[i].Containers[j].Usage.Cpu())
+				usage.MemoryUsage.Add(*metrics.Items[i].Containers[j].Usage.Memory())
+			}
+		}
+	}
+
+	return usage, nil
+}
+
+// getMetricsClient returns a metrics-server client, or nil
+// if metrics-server isn't available.
+func (o *Options) getMetricsClient(ctx context.Context) metricsclient.Interface {
+	mc, err := metricsclient.NewForConfig(o.conf)
+	if err != nil {
+		return nil
+	}
+
+	if _, err := kube.NodeUsage(ctx, mc); err != nil {
+		o.log.WithError(err).Warn("metrics-server is unavailable, only showing requests")
+		return nil
+	}
+
+	return mc
+}
+
+// formatQuantity formats a quantity for display, nil
+// quantities are displayed as unknown.
+func formatQuantity(q *resource.Quantity, memory bool) string {
+	if q == nil {
+		return "-"
+	}
+
+	if memory {
+		return fmt.Sprintf("%dMi", q.Value()/(1024*1024))
+	}
+	return fmt.Sprintf("%dm", q.MilliValue())
+}
+
+// enforce applies the resource quotas configured in each
+// application's devenv.yaml
+func (o *Options) enforce(ctx context.Context, b *box.Config, deployedApps []apps.App) error {
+	conf, err := config.LoadConfig(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load config")
+	}
+
+	kr, err := devenvutil.EnsureDevenvRunning(ctx, conf, b)
+	if err != nil {
+		return err
+	}
+
+	for i := range deployedApps {
+		a := &deployedApps[i]
+
+		// Local apps aren't tied to a path we can read devenv.yaml from
+		if a.Version == app.AppVersionLocal {
+			o.log.WithField("app.name", a.Name).Warn("Skipping locally deployed application")
+			continue
+		}
+
+		if err := app.EnforceResources(ctx, o.log, o.k, b, o.conf, a.Name+"@"+a.Version, kr.GetConfig()); err != nil {
+			return errors.Wrapf(err, "failed to enforce resources for %s", a.Name)
+		}
+	}
+
+	return nil
+}
+
+// Run runs the `apps top` command
+func (o *Options) Run(ctx context.Context) error { //nolint:funlen
+	b, err := box.LoadBox()
+	if err != nil {
+		return errors.Wrap(err, "failed to load box configuration")
+	}
+
+	conf, err := config.LoadConfig(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load config")
+	}
+
+	if _, err := devenvutil.EnsureDevenvRunning(ctx, conf, b); err != nil {
+		return err
+	}
+
+	appsClient := apps.NewKubernetesConfigmapClient(o.k, "")
+	deployedApps, err := appsClient.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if o.Enforce {
+		if err := o.enforce(ctx, b, deployedApps); err != nil {
+			return err
+		}
+	}
+
+	mc := o.getMetricsClient(ctx)
+	usages := make([]*AppUsage, 0, len(deployedApps))
+	for i := range deployedApps {
+		usage, err := o.getUsage(ctx, mc, deployedApps[i].Name)
+		if err != nil {
+			return err
+		}
+		usages = append(usages, usage)
+	}
+
+	// sort by the largest memory consumers, which is
+	// what generally runs out on the node
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].MemoryUsage != nil && usages[j].MemoryUsage != nil {
+			return usages[i].MemoryUsage.Cmp(*usages[j].MemoryUsage) > 0
+		}
+		return usages[i].MemoryRequests.Cmp(usages[j].MemoryRequests) > 0
+	})
+
+	if o.Format == "table" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "APP\tPODS\tCPU REQUESTS\tCPU USAGE\tMEMORY REQUESTS\tMEMORY USAGE")
+		for _, u := range usages {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", u.Name, u.Pods,
+				formatQuantity(&u.CPURequests, false), formatQuantity(u.CPUUsage, false),
+				formatQuantity(&u.MemoryRequests, true), formatQuantity(u.MemoryUsage, true))
+		}
+		return w.Flush()
+	} else if o.Format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(usages)
+	}
+
+	return fmt.Errorf("invalid format %s", o.Format)
+}
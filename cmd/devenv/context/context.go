@@ -12,6 +12,7 @@ import (
 	"github.com/getoutreach/devenv/pkg/config"
 	"github.com/getoutreach/devenv/pkg/devenvutil"
 	"github.com/getoutreach/devenv/pkg/embed"
+	"github.com/getoutreach/devenv/pkg/kube"
 	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/pkg/errors"
@@ -96,9 +97,9 @@ func (o *Options) setContext(ctx gocontext.Context, conf *config.Config,
 		return fmt.Errorf("unknown context '%s', check current contexts by running 'devenv context'", o.DesiredContext)
 	}
 
-	homeDir, err := os.UserHomeDir()
+	kubeConfPath, err := kube.GetKubeConfig()
 	if err != nil {
-		return errors.Wrap(err, "failed to get user's home directory")
+		return errors.Wrap(err, "failed to get kubeconfig path")
 	}
 
 	o.log.Infof("Setting context to %s", o.DesiredContext)
@@ -131,7 +132,7 @@ func (o *Options) setContext(ctx gocontext.Context, conf *config.Config,
 	ingressControllerIP := devenvutil.GetIngressControllerIP(ctx, k, o.log)
 
 	// Update the kube config to point to the new cluster
-	err = clientcmd.WriteToFile(*cluster.KubeConfig, filepath.Join(homeDir, ".outreach", "kubeconfig.yaml"))
+	err = clientcmd.WriteToFile(*cluster.KubeConfig, kubeConfPath)
 	if err != nil {
 		return errors.Wrap(err, "failed to write kubeconfig")
 	}
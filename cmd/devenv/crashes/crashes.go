@@ -0,0 +1,171 @@
+// Package crashes implements the crashes devenv command
+package crashes
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/crashes"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+//nolint:gochecknoglobals
+var (
+	crashesLongDesc = `
+		Crashes shows the pods that were captured while crashing, i.e. in CrashLoopBackOff or terminated with a non-zero exit code.
+
+		Crashing pods are captured while waiting for pods to be ready, e.g. during 'devenv provision' or 'devenv apps deploy', and by 'devenv agent --capture-crashes'. Their previous container logs, spec and events are saved into ~/.local/dev-environment/crashes.
+	`
+	crashesExample = `
+		# List captured crashes
+		devenv crashes list
+
+		# Show the latest captured crash
+		devenv crashes show
+
+		# Show a specific captured crash
+		devenv crashes show <id>
+	`
+)
+
+// Options are the options for the crashes command
+type Options struct {
+	log logrus.FieldLogger
+	w   io.Writer
+}
+
+// NewOptions creates a new options struct for the crashes command
+func NewOptions(log logrus.FieldLogger) *Options {
+	return &Options{
+		log: log,
+		w:   os.Stdout,
+	}
+}
+
+// NewCmdCrashes creates a new cli.Command for the crashes command
+func NewCmdCrashes(log logrus.FieldLogger) *cli.Command {
+	return &cli.Command{
+		Name:        "crashes",
+		Usage:       "Show pods that were captured while crashing",
+		Description: cmdutil.NewDescription(crashesLongDesc, crashesExample),
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List captured crashes",
+				Action: func(c *cli.Context) error {
+					return NewOptions(log).List()
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "Show the logs, and events, of a captured crash, defaults to the latest",
+				ArgsUsage: "[id]",
+				Action: func(c *cli.Context) error {
+					return NewOptions(log).Show(c.Args().First())
+				},
+			},
+		},
+	}
+}
+
+// List lists the captured crashes
+func (o *Options) List() error {
+	captured, err := crashes.List()
+	if err != nil {
+		return err
+	}
+
+	if len(captured) == 0 {
+		fmt.Fprintln(o.w, "No crashes have been captured")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tCONTAINERS")
+	for i := range captured {
+		c := &captured[i]
+
+		containers := make([]string, 0, len(c.Containers))
+		for j := range c.Containers {
+			cc := &c.Containers[j]
+			containers = append(containers, fmt.Sprintf("%s/%s/%s (%s, exit %d)", cc.Namespace, cc.Pod, cc.Container, cc.Reason, cc.ExitCode))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.ID, c.Time.Local().Format("2006-01-02 15:04:05"), strings.Join(containers, ", "))
+	}
+
+	return w.Flush()
+}
+
+// Show shows the logs, and events, of a captured crash. If
+// id is empty, the latest crash is shown.
+func (o *Options) Show(id string) error {
+	if id == "" {
+		captured, err := crashes.List()
+		if err != nil {
+			return err
+		}
+		if len(captured) == 0 {
+			return fmt.Errorf("no crashes have been captured")
+		}
+		id = captured[0].ID
+	}
+
+	c, dir, err := crashes.Get(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.w, "Crash %s, captured at %s\nFiles: %s\n", c.ID, c.Time.Local().Format("2006-01-02 15:04:05"), dir)
+
+	shownEvents := make(map[string]bool)
+	for i := range c.Containers {
+		cc := &c.Containers[i]
+
+		fmt.Fprintf(o.w, "\n%s\n---\n", color.New(color.Bold).Sprintf("%s/%s container %s", cc.Namespace, cc.Pod, cc.Container))
+		fmt.Fprintf(o.w, "Reason: %s\nExit Code: %d\nRestarts: %d\n", cc.Reason, cc.ExitCode, cc.RestartCount)
+		if !cc.FinishedAt.IsZero() {
+			fmt.Fprintf(o.w, "Finished At: %s\n", cc.FinishedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+
+		// Events are per pod, so only show them once
+		if !shownEvents[cc.Dir()] {
+			shownEvents[cc.Dir()] = true
+			if err := o.showFile("Events", filepath.Join(dir, cc.Dir(), "events.yaml")); err != nil {
+				return err
+			}
+		}
+
+		if err := o.showFile("Logs", filepath.Join(dir, cc.LogFile())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// showFile writes the contents of a file, files that
+// don't exist, e.g. logs that failed to be captured, are noted.
+func (o *Options) showFile(title, path string) error {
+	fmt.Fprintf(o.w, "\n%s:\n", title)
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(o.w, "(not captured)")
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(o.w, f)
+	return errors.Wrapf(err, "failed to read %s", path)
+}
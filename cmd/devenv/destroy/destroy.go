@@ -7,7 +7,6 @@ import (
 	dockerclient "github.com/docker/docker/client"
 	"github.com/getoutreach/devenv/pkg/cmdutil"
 	"github.com/getoutreach/devenv/pkg/config"
-	"github.com/getoutreach/devenv/pkg/containerruntime"
 	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/getoutreach/gobox/pkg/trace"
@@ -132,7 +131,7 @@ func (o *Options) Run(ctx context.Context) error {
 	if o.RemoveImageCache {
 		if o.KubernetesRuntime.GetConfig().Type == kubernetesruntime.RuntimeTypeLocal {
 			o.log.Info("Removing Kubernetes Docker image cache ...")
-			err := o.d.VolumeRemove(ctx, containerruntime.ContainerName+"-containerd", false)
+			err := o.d.VolumeRemove(ctx, kubernetesruntime.GetKindControlPlaneContainer()+"-containerd", false)
 			if err != nil && !dockerclient.IsErrNotFound(err) {
 				return errors.Wrap(err, "failed to remove image volume")
 			}
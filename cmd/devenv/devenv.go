@@ -20,24 +20,31 @@ import (
 
 	// Place any extra imports for your startup code here
 	///Block(imports)
+	"github.com/getoutreach/devenv/cmd/devenv/agent"
 	"github.com/getoutreach/devenv/cmd/devenv/apps"
 	"github.com/getoutreach/devenv/cmd/devenv/auth"
 	"github.com/getoutreach/devenv/cmd/devenv/completion"
 	cmdcontext "github.com/getoutreach/devenv/cmd/devenv/context"
+	"github.com/getoutreach/devenv/cmd/devenv/crashes"
 	"github.com/getoutreach/devenv/cmd/devenv/deprecated"
 	"github.com/getoutreach/devenv/cmd/devenv/destroy"
+	"github.com/getoutreach/devenv/cmd/devenv/doctor"
 	"github.com/getoutreach/devenv/cmd/devenv/expose"
 	"github.com/getoutreach/devenv/cmd/devenv/kubectl"
 	localapp "github.com/getoutreach/devenv/cmd/devenv/local-app"
+	"github.com/getoutreach/devenv/cmd/devenv/logs"
 	"github.com/getoutreach/devenv/cmd/devenv/provision"
 	"github.com/getoutreach/devenv/cmd/devenv/registry"
 	"github.com/getoutreach/devenv/cmd/devenv/snapshot"
 	"github.com/getoutreach/devenv/cmd/devenv/start"
 	"github.com/getoutreach/devenv/cmd/devenv/status"
 	"github.com/getoutreach/devenv/cmd/devenv/stop"
+	"github.com/getoutreach/devenv/cmd/devenv/supportbundle"
+	"github.com/getoutreach/devenv/cmd/devenv/top"
 	"github.com/getoutreach/devenv/cmd/devenv/tunnel"
 	"github.com/getoutreach/devenv/internal/shim"
 	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
 	///EndBlock(imports)
 )
 
@@ -94,6 +101,14 @@ func main() {
 				return err
 			}
 
+			// The agent uses this to determine if the devenv is idle, so
+			// it shouldn't count itself as activity.
+			if c.Args().First() != "agent" {
+				if err := devenvutil.RecordActivity(); err != nil {
+					log.WithError(err).Warn("failed to record activity")
+				}
+			}
+
 			binPath, err := os.Executable()
 			if err != nil {
 				return errors.Wrap(err, "failed to get devenv executable path")
@@ -132,11 +147,20 @@ func main() {
 		cmdcontext.NewCmdContext(log),
 		registry.NewCmdRegistry(log),
 		apps.NewCmd(log),
+		doctor.NewCmdDoctor(log),
+		agent.NewCmdAgent(log),
+		top.NewCmdTop(log),
+		logs.NewCmdLogs(log),
+		crashes.NewCmdCrashes(log),
+		supportbundle.NewCmdSupportBundle(log),
 		///EndBlock(commands)
 	}
 
 	///Block(postApp)
 	app.Commands = append(app.Commands, deprecated.Commands(log)...)
+
+	// Record invocations locally, so they can be included in support bundles
+	devenvutil.TraceCommands(app.Commands)
 	///EndBlock(postApp)
 
 	// Insert global flags, tracing, updating and start the application.
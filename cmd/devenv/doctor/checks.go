@@ -0,0 +1,364 @@
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	dockerclient "github.com/docker/docker/client"
+	"github.com/getoutreach/devenv/cmd/devenv/provision"
+	"github.com/getoutreach/devenv/pkg/app"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	"github.com/getoutreach/devenv/pkg/kubernetestunnelruntime"
+	localizerapi "github.com/getoutreach/localizer/api"
+	"github.com/getoutreach/localizer/pkg/localizer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// checkTimeout is the maximum amount of time a single check
+// that talks to an external service can take.
+const checkTimeout = 10 * time.Second
+
+// check is a health check ran by the doctor command. A check may
+// return multiple results, e.g. one per binary checked.
+type check struct {
+	name string
+	run  func(context.Context, *Options) []*Result
+}
+
+//nolint:gochecknoglobals // Why: This is the catalog of checks
+var checks = []check{
+	{name: "docker", run: checkDocker},
+	{name: "binaries", run: checkBinaries},
+	{name: "kubeconfig", run: checkKubeConfig},
+	{name: "context", run: checkContext},
+	{name: "hosts", run: checkHosts},
+	{name: "localizer", run: checkLocalizer},
+	{name: "vault", run: checkVault},
+}
+
+// pass, warn and fail are helpers for creating results
+func pass(msg string) *Result {
+	return &Result{Status: CheckStatusPass, Message: msg}
+}
+
+func warn(msg, remediation string) *Result {
+	return &Result{Status: CheckStatusWarn, Message: msg, Remediation: remediation}
+}
+
+func fail(msg, remediation string) *Result {
+	return &Result{Status: CheckStatusFail, Message: msg, Remediation: remediation}
+}
+
+// checkDocker ensures that Docker is reachable and has enough resources
+// allocated to it to run a developer environment.
+func checkDocker(ctx context.Context, _ *Options) []*Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	d, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv)
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("failed to create docker client: %v", err), "Ensure Docker is installed")}
+	}
+
+	info, err := d.Info(ctx)
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("failed to reach docker: %v", err), "Ensure Docker is installed and running")}
+	}
+
+	results := []*Result{pass("Docker " + info.ServerVersion + " is reachable")}
+
+	if info.NCPU < provision.RecommendedDockerCPUs {
+		results = append(results, warn(
+			fmt.Sprintf("Docker has %d CPUs, %d are recommended", info.NCPU, provision.RecommendedDockerCPUs),
+			"Increase the CPUs available to Docker in its settings",
+		))
+	}
+
+	// Docker reports slightly less memory than is allocated to its VM, so allow
+	// for some overhead before warning.
+	memoryMiB := info.MemTotal / 1024 / 1024
+	if memoryMiB < provision.RecommendedDockerMemoryMiB*9/10 {
+		results = append(results, warn(
+			fmt.Sprintf("Docker has %dMiB of memory, %dMiB is recommended", memoryMiB, provision.RecommendedDockerMemoryMiB),
+			"Increase the memory available to Docker in its settings",
+		))
+	}
+
+	if r := checkDockerForMacDisk(); r != nil {
+		results = append(results, r)
+	}
+
+	return results
+}
+
+// checkDockerForMacDisk checks the disk size allocated to Docker for Mac, if
+// not running on macOS or the settings can't be read nil is returned.
+func checkDockerForMacDisk() *Result {
+	if runtime.GOOS != "darwin" {
+		return nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(homeDir, "Library", "Group Containers", "group.com.docker", "settings.json"))
+	if err != nil {
+		return nil
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(b, &settings); err != nil {
+		return nil
+	}
+
+	diskSpace, ok := settings["diskSizeMiB"].(float64)
+	if !ok || int(diskSpace) >= provision.RecommendedDockerStorageMiB {
+		return nil
+	}
+
+	return warn(
+		fmt.Sprintf("Docker has %dMiB of disk, %dMiB is recommended", int(diskSpace), provision.RecommendedDockerStorageMiB),
+		"Increase the disk size available to Docker in its settings, or run 'devenv provision' to do so automatically",
+	)
+}
+
+// checkBinaries ensures that the binaries the devenv relies on are present
+func checkBinaries(_ context.Context, o *Options) []*Result {
+	results := []*Result{}
+
+	// These are downloaded automatically when first used
+	deps := []struct{ name, version string }{
+		{"kind", kubernetesruntime.KindVersion},
+		{"loft", kubernetesruntime.LoftVersion},
+		{"devspace", app.DevspaceVersion},
+		{"localizer", kubernetestunnelruntime.LocalizerVersion},
+	}
+	for _, dep := range deps {
+		path, err := cmdutil.GetDependencyPath(dep.name + "-" + dep.version)
+		if err != nil {
+			results = append(results, fail(fmt.Sprintf("failed to determine path for %s: %v", dep.name, err), ""))
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			results = append(results, warn(
+				fmt.Sprintf("%s %s is not downloaded", dep.name, dep.version),
+				fmt.Sprintf("%s will be downloaded automatically when first used", dep.name),
+			))
+			continue
+		}
+
+		results = append(results, pass(fmt.Sprintf("%s found at %s", dep.name, path)))
+	}
+
+	// These are expected to be installed by the user
+	required := []string{"kubecfg", "saml2aws"}
+	if o.b.DeveloperEnvironmentConfig.VaultConfig.Enabled {
+		required = append(required, "vault")
+	}
+	for _, name := range required {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			results = append(results, fail(
+				fmt.Sprintf("%s was not found in $PATH", name),
+				fmt.Sprintf("Install %s and ensure it's in your $PATH", name),
+			))
+			continue
+		}
+
+		results = append(results, pass(fmt.Sprintf("%s found at %s", name, path)))
+	}
+
+	return results
+}
+
+// checkKubeConfig ensures that the devenv kubeconfig exists and is valid
+func checkKubeConfig(_ context.Context, _ *Options) []*Result {
+	remediation := "Run 'devenv context' to list your developer environments, then 'devenv context <context>' to regenerate it"
+
+	kubeConfPath, err := kube.GetKubeConfig()
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("failed to determine kubeconfig path: %v", err), "")}
+	}
+
+	kubeconfig, err := clientcmd.LoadFromFile(kubeConfPath)
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("failed to load %s: %v", kubeConfPath, err), remediation)}
+	}
+
+	if err := clientcmd.Validate(*kubeconfig); err != nil {
+		return []*Result{fail(fmt.Sprintf("%s is invalid: %v", kubeConfPath, err), remediation)}
+	}
+
+	if _, ok := kubeconfig.Contexts[kubernetesruntime.KindClusterName]; !ok {
+		return []*Result{fail(
+			fmt.Sprintf("%s is missing the %s context", kubeConfPath, kubernetesruntime.KindClusterName), remediation,
+		)}
+	}
+
+	return []*Result{pass(kubeConfPath + " is valid")}
+}
+
+// checkContext ensures that the current devenv context points to an
+// enabled runtime
+func checkContext(ctx context.Context, o *Options) []*Result {
+	conf, err := config.LoadConfig(ctx)
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("failed to load devenv config: %v", err), "")}
+	}
+
+	r, err := kubernetesruntime.GetRuntimeFromContext(conf, o.b)
+	if err != nil {
+		return []*Result{fail(
+			fmt.Sprintf("current context '%s' is not resolvable: %v", conf.CurrentContext, err),
+			"Run 'devenv context' to list your developer environments, then 'devenv context <context>' to select one",
+		)}
+	}
+
+	return []*Result{pass(fmt.Sprintf("current context '%s' uses runtime %s", conf.CurrentContext, r.GetConfig().Name))}
+}
+
+// checkHosts ensures that all ingress hosts in the devenv have an
+// entry in /etc/hosts
+func checkHosts(ctx context.Context, _ *Options) []*Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	k, err := kube.GetKubeClient()
+	if err != nil {
+		return []*Result{warn(fmt.Sprintf("skipped, failed to create kubernetes client: %v", err), "")}
+	}
+
+	ingresses, err := k.NetworkingV1().Ingresses(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return []*Result{warn(fmt.Sprintf("skipped, failed to list ingresses: %v", err), "")}
+	}
+
+	hosts := []string{}
+	for i := range ingresses.Items {
+		for j := range ingresses.Items[i].Spec.Rules {
+			if h := ingresses.Items[i].Spec.Rules[j].Host; h != "" {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+
+	f, err := os.Open("/etc/hosts")
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("failed to read /etc/hosts: %v", err), "")}
+	}
+	defer f.Close()
+
+	missing, err := missingHosts(f, hosts)
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("failed to read /etc/hosts: %v", err), "")}
+	}
+
+	if len(missing) != 0 {
+		return []*Result{fail(
+			fmt.Sprintf("/etc/hosts is missing entries for: %s", strings.Join(missing, ", ")),
+			"Run 'devenv context <context>' with your current context to update /etc/hosts",
+		)}
+	}
+
+	return []*Result{pass(fmt.Sprintf("/etc/hosts has entries for all %d ingress hosts", len(hosts)))}
+}
+
+// missingHosts returns the hosts that don't have an entry in
+// the provided hosts file
+func missingHosts(r io.Reader, hosts []string) ([]string, error) {
+	found := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		// The first field is the IP address, the rest are hostnames
+		for _, h := range fields[1:] {
+			found[h] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, h := range hosts {
+		if !found[h] {
+			missing = append(missing, h)
+		}
+	}
+
+	return missing, nil
+}
+
+// checkLocalizer ensures that, if localizer is running, it's reachable
+func checkLocalizer(ctx context.Context, _ *Options) []*Result {
+	if !localizer.IsRunning() {
+		return []*Result{warn("localizer is not running", "Run 'devenv tunnel' to access services in your developer environment")}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	remediation := "Run 'sudo kill $(pgrep localizer) && sudo rm -f " + localizer.Socket + "', then rerun 'devenv tunnel'"
+
+	client, closer, err := localizer.Connect(ctx, grpc.WithBlock(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return []*Result{fail(fmt.Sprintf("localizer socket exists but could not connect: %v", err), remediation)}
+	}
+	defer closer()
+
+	if _, err := client.Ping(ctx, &localizerapi.PingRequest{}); err != nil {
+		return []*Result{fail(fmt.Sprintf("localizer is not responding: %v", err), remediation)}
+	}
+
+	return []*Result{pass("localizer is running and responding")}
+}
+
+// checkVault ensures that the current vault token is valid, if vault
+// is enabled
+func checkVault(ctx context.Context, o *Options) []*Result {
+	vaultConfig := &o.b.DeveloperEnvironmentConfig.VaultConfig
+	if !vaultConfig.Enabled {
+		return []*Result{pass("vault is not enabled")}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	//nolint:gosec // Why: Passing in the vault address
+	if out, err := exec.CommandContext(ctx, "vault", "token", "lookup", "-address", vaultConfig.Address).CombinedOutput(); err != nil {
+		return []*Result{fail(
+			fmt.Sprintf("vault token is invalid: %s", strings.TrimSpace(string(out))),
+			"Run 'devenv auth refresh' to login to vault",
+		)}
+	}
+
+	return []*Result{pass("vault token is valid")}
+}
@@ -0,0 +1,25 @@
+package doctor
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMissingHosts(t *testing.T) {
+	hostsFile := `
+127.0.0.1 localhost
+# 10.0.0.1 commented.outreach-dev.com
+10.0.0.1 app.outreach-dev.com  other.outreach-dev.com # trailing comment
+`
+
+	missing, err := missingHosts(strings.NewReader(hostsFile), []string{
+		"app.outreach-dev.com",
+		"other.outreach-dev.com",
+		"commented.outreach-dev.com",
+		"missing.outreach-dev.com",
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, missing, []string{"commented.outreach-dev.com", "missing.outreach-dev.com"})
+}
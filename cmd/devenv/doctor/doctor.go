@@ -0,0 +1,182 @@
+// Package doctor implements the doctor devenv command
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+//nolint:gochecknoglobals
+var (
+	doctorLongDesc = `
+		Doctor runs a series of checks against your machine and developer environment and reports any problems found, along with how to fix them.
+	`
+	doctorExample = `
+		# Check the health of your developer environment
+		devenv doctor
+
+		# Output the results as JSON, e.g. for a support ticket
+		devenv doctor -o json
+	`
+)
+
+// CheckStatus is the outcome of a check
+type CheckStatus string
+
+const (
+	// CheckStatusPass is a check that found no problems
+	CheckStatusPass CheckStatus = "pass"
+
+	// CheckStatusWarn is a check that found a problem which may
+	// cause issues, but isn't fatal.
+	CheckStatusWarn CheckStatus = "warn"
+
+	// CheckStatusFail is a check that found a problem which will
+	// cause the developer environment to not function correctly.
+	CheckStatusFail CheckStatus = "fail"
+)
+
+// Result is the result of running a check
+type Result struct {
+	// Name is the name of the check that was ran
+	Name string `json:"name"`
+
+	// Status is the outcome of the check
+	Status CheckStatus `json:"status"`
+
+	// Message is a human readable description of the outcome
+	Message string `json:"message,omitempty"`
+
+	// Remediation is a hint on how to fix the problem found, this
+	// is only set when Status isn't CheckStatusPass.
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Options holds the options for the doctor command
+type Options struct {
+	log logrus.FieldLogger
+	b   *box.Config
+
+	// Output is the format to output the results in, if empty
+	// human readable text is output.
+	Output string
+}
+
+// NewOptions creates a new Options instance for the doctor command
+func NewOptions(log logrus.FieldLogger) (*Options, error) {
+	b, err := box.LoadBox()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load box configuration")
+	}
+
+	return &Options{
+		log: log,
+		b:   b,
+	}, nil
+}
+
+// NewCmdDoctor creates a new command for the doctor subcommand
+func NewCmdDoctor(log logrus.FieldLogger) *cli.Command {
+	return &cli.Command{
+		Name:        "doctor",
+		Usage:       "Check the health of your machine and developer environment",
+		Description: cmdutil.NewDescription(doctorLongDesc, doctorExample),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format, one of: json. Defaults to human readable text.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			o, err := NewOptions(log)
+			if err != nil {
+				return err
+			}
+			o.Output = c.String("output")
+
+			return o.Run(c.Context)
+		},
+	}
+}
+
+// RunChecks runs all of the checks and returns their results
+func (o *Options) RunChecks(ctx context.Context) []*Result {
+	results := make([]*Result, 0, len(checks))
+	for _, c := range checks {
+		for _, r := range c.run(ctx, o) {
+			if r.Name == "" {
+				r.Name = c.name
+			}
+			results = append(results, r)
+		}
+	}
+
+	return results
+}
+
+// writeText writes the results in a human readable format
+func writeText(w io.Writer, results []*Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		var status string
+		switch r.Status {
+		case CheckStatusPass:
+			status = color.GreenString("PASS")
+		case CheckStatusWarn:
+			status = color.YellowString("WARN")
+		case CheckStatusFail:
+			status = color.RedString("FAIL")
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, r.Name, r.Message)
+		if r.Status != CheckStatusPass && r.Remediation != "" {
+			fmt.Fprintf(tw, "\t\t-> %s\n", r.Remediation)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// Run runs the doctor command
+func (o *Options) Run(ctx context.Context) error {
+	results := o.RunChecks(ctx)
+
+	switch o.Output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return errors.Wrap(err, "failed to encode results")
+		}
+	case "":
+		if err := writeText(os.Stdout, results); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output format '%s'", o.Output)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == CheckStatusFail {
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package logs implements the logs devenv command
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/getoutreach/devenv/pkg/app"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+//nolint:gochecknoglobals
+var (
+	logsLongDesc = `
+		Logs shows the logs of every pod belonging to an application, found through its namespaces. Lines from each container are interleaved and prefixed with the pod and container they came from.
+
+		With --follow, logs are streamed until interrupted. New pods, and containers that restart, are automatically attached to.
+	`
+	logsExample = `
+		# Show the logs of an application
+		devenv logs <appName>
+
+		# Follow the logs of an application, starting from 5 minutes ago
+		devenv logs --follow --since 5m <appName>
+
+		# Follow only error lines of the worker pods of an application
+		devenv logs -f --grep error --selector component=worker <appName>
+	`
+)
+
+// Options are the options for the logs command
+type Options struct {
+	log logrus.FieldLogger
+	k   kubernetes.Interface
+
+	// App is the name of the application to show logs for
+	App string
+
+	// Since, if set, only shows logs newer than this duration
+	Since time.Duration
+
+	// Grep, if set, is a regular expression that lines must match
+	// to be shown
+	Grep string
+
+	// Selector, if set, is a label selector that pods must match
+	Selector string
+
+	// Follow streams logs until the context is canceled
+	Follow bool
+}
+
+// NewOptions creates a new options struct for the logs command
+func NewOptions(log logrus.FieldLogger) (*Options, error) {
+	k, err := kube.GetKubeClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kubernetes client")
+	}
+
+	return &Options{
+		log: log,
+		k:   k,
+	}, nil
+}
+
+// NewCmdLogs creates a new cli.Command for the logs command
+func NewCmdLogs(log logrus.FieldLogger) *cli.Command {
+	return &cli.Command{
+		Name:        "logs",
+		Usage:       "Show the logs of every pod of an application",
+		Description: cmdutil.NewDescription(logsLongDesc, logsExample),
+		ArgsUsage:   "<appName>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "follow",
+				Aliases: []string{"f"},
+				Usage:   "Stream logs, attaching to new and restarted pods",
+			},
+			&cli.DurationFlag{
+				Name:  "since",
+				Usage: "Only show logs newer than a relative duration, e.g. 5m",
+			},
+			&cli.StringFlag{
+				Name:  "grep",
+				Usage: "Only show lines matching a regular expression",
+			},
+			&cli.StringFlag{
+				Name:    "selector",
+				Aliases: []string{"l"},
+				Usage:   "Only show logs of pods matching a label selector, e.g. component=worker",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Args().Len() == 0 {
+				return fmt.Errorf("missing application")
+			}
+
+			o, err := NewOptions(log)
+			if err != nil {
+				return err
+			}
+
+			o.App = c.Args().First()
+			o.Follow = c.Bool("follow")
+			o.Since = c.Duration("since")
+			o.Grep = c.String("grep")
+			o.Selector = c.String("selector")
+
+			return o.Run(c.Context)
+		},
+	}
+}
+
+// podLogOptions returns the options to request container logs with
+func (o *Options) podLogOptions() *corev1.PodLogOptions {
+	opts := &corev1.PodLogOptions{Follow: o.Follow}
+	if o.Since > 0 {
+		seconds := int64(o.Since.Seconds())
+		opts.SinceSeconds = &seconds
+	}
+	return opts
+}
+
+// follow attaches to pods in the application's namespaces as they
+// are created, or their containers restart, until ctx is canceled.
+func (o *Options) follow(ctx context.Context, s *streamer) error {
+	onPod := func(obj interface{}) {
+		if p, ok := obj.(*corev1.Pod); ok {
+			s.attach(ctx, p)
+		}
+	}
+
+	for _, ns := range app.Namespaces(o.App) {
+		factory := informers.NewSharedInformerFactoryWithOptions(o.k, 0,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = o.Selector
+			}),
+		)
+		factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    onPod,
+			UpdateFunc: func(_, obj interface{}) { onPod(obj) },
+		})
+		factory.Start(ctx.Done())
+	}
+
+	<-ctx.Done()
+	s.wait()
+	return nil
+}
+
+// Run runs the logs command
+func (o *Options) Run(ctx context.Context) error {
+	b, err := box.LoadBox()
+	if err != nil {
+		return errors.Wrap(err, "failed to load box configuration")
+	}
+
+	conf, err := config.LoadConfig(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load config")
+	}
+
+	if _, err := devenvutil.EnsureDevenvRunning(ctx, conf, b); err != nil { //nolint:govet // Why: OK w/ err shadow
+		return err
+	}
+
+	return o.stream(ctx, os.Stdout)
+}
+
+// stream writes the logs of the application to w
+func (o *Options) stream(ctx context.Context, w io.Writer) error {
+	var grep *regexp.Regexp
+	if o.Grep != "" {
+		var err error
+		grep, err = regexp.Compile(o.Grep)
+		if err != nil {
+			return errors.Wrap(err, "invalid --grep expression")
+		}
+	}
+
+	s := newStreamer(o.log, o.k, o.podLogOptions(), grep, w)
+	if o.Follow {
+		return o.follow(ctx, s)
+	}
+
+	found := false
+	for _, ns := range app.Namespaces(o.App) {
+		pods, err := o.k.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: o.Selector})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list pods in %s", ns)
+		}
+
+		for i := range pods.Items {
+			found = true
+			s.attach(ctx, &pods.Items[i])
+		}
+	}
+	s.wait()
+
+	if !found {
+		return fmt.Errorf("no pods found for application %s", o.App)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPod(namespace, name string, statuses ...corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Status:     corev1.PodStatus{ContainerStatuses: statuses},
+	}
+}
+
+func TestStream(t *testing.T) {
+	color.NoColor = true
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	waiting := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+
+	k := fake.NewSimpleClientset(
+		newPod("app", "app-1", corev1.ContainerStatus{Name: "app", State: running}),
+		newPod("app--bento1a", "app-2",
+			corev1.ContainerStatus{Name: "app", State: running},
+			corev1.ContainerStatus{Name: "sidecar", State: waiting},
+		),
+		newPod("other", "other-1", corev1.ContainerStatus{Name: "other", State: running}),
+	)
+
+	o := &Options{log: log, k: k, App: "app"}
+
+	var buf bytes.Buffer
+	assert.NilError(t, o.stream(context.Background(), &buf))
+
+	// The fake clientset returns "fake logs" for every container
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(lines)
+	assert.DeepEqual(t, lines, []string{
+		"[app-1/app] fake logs",
+		"[app-2/app] fake logs",
+	})
+
+	buf.Reset()
+	o.Grep = "^nothing"
+	assert.NilError(t, o.stream(context.Background(), &buf))
+	assert.Equal(t, buf.String(), "")
+
+	o.App = "missing"
+	assert.ErrorContains(t, o.stream(context.Background(), &buf), "no pods found")
+}
+
+func TestWriteLinesSplitsLongLines(t *testing.T) {
+	var buf bytes.Buffer
+	s := newStreamer(logrus.New(), nil, nil, nil, &buf)
+
+	long := strings.Repeat("a", maxLineSize+10)
+	assert.NilError(t, s.writeLines(strings.NewReader("short\n"+long+"\nlast"), "[p]"))
+	assert.Equal(t, buf.String(), "[p] short\n[p] "+long[:maxLineSize]+"\n[p] "+long[maxLineSize:]+"\n[p] last\n")
+}
@@ -0,0 +1,162 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxLineSize is the longest log line that will be output, longer
+// lines are split.
+const maxLineSize = 1024 * 1024
+
+// prefixColors are the colors used to prefix log lines, a
+// container always gets the same color.
+//nolint:gochecknoglobals // Why: It's a constant list of colors
+var prefixColors = []color.Attribute{
+	color.FgCyan,
+	color.FgGreen,
+	color.FgMagenta,
+	color.FgYellow,
+	color.FgBlue,
+	color.FgRed,
+	color.FgHiCyan,
+	color.FgHiGreen,
+	color.FgHiMagenta,
+	color.FgHiYellow,
+	color.FgHiBlue,
+}
+
+// prefix returns the colored prefix for log lines of a container
+func prefix(pod, container string) string {
+	h := fnv.New32a()
+	h.Write([]byte(pod + "/" + container)) //nolint:errcheck // Why: hash writes never fail
+	return color.New(prefixColors[h.Sum32()%uint32(len(prefixColors))]).Sprintf("[%s/%s]", pod, container)
+}
+
+// streamer streams the logs of containers, interleaving their
+// lines onto a single writer.
+type streamer struct {
+	log  logrus.FieldLogger
+	k    kubernetes.Interface
+	opts *corev1.PodLogOptions
+
+	// grep, if set, filters out lines that don't match
+	grep *regexp.Regexp
+
+	// wmu guards writes to w
+	wmu sync.Mutex
+	w   io.Writer
+
+	// amu guards attached
+	amu sync.Mutex
+
+	// attached contains the container instances that have been
+	// streamed, containers are keyed by their restart count so
+	// that a restarted container is streamed again.
+	attached map[string]bool
+
+	wg sync.WaitGroup
+}
+
+// newStreamer creates a streamer that writes to w
+func newStreamer(log logrus.FieldLogger, k kubernetes.Interface, opts *corev1.PodLogOptions,
+	grep *regexp.Regexp, w io.Writer) *streamer {
+	return &streamer{
+		log:      log,
+		k:        k,
+		opts:     opts,
+		grep:     grep,
+		w:        w,
+		attached: make(map[string]bool),
+	}
+}
+
+// attach starts streaming the logs of every container in the pod that has
+// started and hasn't been streamed yet. Containers that are waiting to
+// start, e.g. in CrashLoopBackOff, are attached to once they are running.
+func (s *streamer) attach(ctx context.Context, pod *corev1.Pod) {
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+	s.amu.Lock()
+	defer s.amu.Unlock()
+
+	for i := range statuses {
+		cs := &statuses[i]
+		if cs.State.Running == nil && cs.State.Terminated == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s/%s/%d", pod.Namespace, pod.Name, cs.Name, cs.RestartCount)
+		if s.attached[key] {
+			continue
+		}
+		s.attached[key] = true
+
+		s.wg.Add(1)
+		go func(namespace, name, container string) {
+			defer s.wg.Done()
+			s.stream(ctx, namespace, name, container)
+		}(pod.Namespace, pod.Name, cs.Name)
+	}
+}
+
+// stream streams the logs of a container until they end, or ctx is canceled
+func (s *streamer) stream(ctx context.Context, namespace, name, container string) {
+	log := s.log.WithField("pod", namespace+"/"+name).WithField("container", container)
+
+	r, err := kube.StreamContainerLogs(ctx, s.k, name, namespace, container, s.opts)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.WithError(err).Warn("Failed to stream logs")
+		}
+		return
+	}
+	defer r.Close()
+
+	if err := s.writeLines(r, prefix(name, container)); err != nil && ctx.Err() == nil {
+		log.WithError(err).Warn("Failed to read logs")
+	}
+}
+
+// writeLines writes the lines read from r, prefixed with p, until r ends.
+// Lines longer than maxLineSize are split into multiple lines.
+func (s *streamer) writeLines(r io.Reader, p string) error {
+	br := bufio.NewReaderSize(r, maxLineSize)
+	for {
+		// ReadLine returns the start of lines that don't fit in
+		// its buffer, and the rest of them on the next calls
+		line, _, err := br.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if s.grep != nil && !s.grep.Match(line) {
+			continue
+		}
+
+		s.wmu.Lock()
+		fmt.Fprintf(s.w, "%s %s\n", p, line)
+		s.wmu.Unlock()
+	}
+}
+
+// wait waits for all streams to end
+func (s *streamer) wait() {
+	s.wg.Wait()
+}
@@ -13,6 +13,17 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// RecommendedDockerCPUs is the recommended number of CPUs for Docker
+	RecommendedDockerCPUs = 4
+
+	// RecommendedDockerMemoryMiB is the recommended amount of memory for Docker
+	RecommendedDockerMemoryMiB = 8192
+
+	// RecommendedDockerStorageMiB is the recommended disk size for Docker, 208 GB
+	RecommendedDockerStorageMiB = 212992
+)
+
 func startDockerForMac(ctx context.Context, d dockerclient.APIClient, log logrus.FieldLogger) error {
 	// Give Docker for Mac time to stop.
 	time.Sleep(2 * time.Second)
@@ -50,10 +61,9 @@ func reconcileDockerForMacConfig(_ context.Context, settingsFile string) (bool,
 		return false, err
 	}
 
-	recommendedCPU := 4
-	recommendedMemory := 8192
-	// 208 GB
-	recommendedStorage := 212992
+	recommendedCPU := RecommendedDockerCPUs
+	recommendedMemory := RecommendedDockerMemoryMiB
+	recommendedStorage := RecommendedDockerStorageMiB
 	requiredMounts := map[string]bool{
 		"/Users":               true,
 		"/private/var/folders": true,
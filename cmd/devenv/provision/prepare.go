@@ -14,6 +14,7 @@ import (
 	"github.com/getoutreach/devenv/pkg/cmdutil"
 	"github.com/getoutreach/devenv/pkg/devenvutil"
 	"github.com/getoutreach/devenv/pkg/embed"
+	"github.com/getoutreach/devenv/pkg/kube"
 	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
 	"github.com/getoutreach/gobox/pkg/async"
 	"github.com/pkg/errors"
@@ -153,3 +154,17 @@ func (o *Options) ensureImagePull(ctx context.Context) error {
 
 	return os.WriteFile(storagePath, []byte(imageSecret), 0o600)
 }
+
+// DeploySnapshotInfrastructure deploys the snapshot infrastructure, velero and minio,
+// into a running developer environment. It is removed after provisioning from a
+// snapshot, but is needed to create and restore personal snapshots.
+func (o *Options) DeploySnapshotInfrastructure(ctx context.Context) error {
+	k, conf, err := kube.GetKubeClientWithConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to create kubernetes client")
+	}
+	o.k = k
+	o.r = conf
+
+	return o.deployStage(ctx, "pre-restore")
+}
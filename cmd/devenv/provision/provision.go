@@ -70,6 +70,15 @@ var (
 
 		# Restore a snapshot
 		devenv provision --snapshot <name>
+
+		# Use the snapshot before the latest one, e.g. when the latest snapshot is broken
+		devenv provision --snapshot-age 1
+
+		# Use a specific snapshot, see 'devenv snapshot ls-remote' for the available snapshots
+		devenv provision --snapshot-digest <digest>
+
+		# Create a new development environment with two tainted worker nodes
+		devenv provision --workers 2 --node-label tier=backend --node-taint dedicated=backend:NoSchedule
 	`
 
 	imagePullSecretPath = filepath.Join(".outreach", ".config", "dev-environment", "image-pull-secret")
@@ -77,10 +86,18 @@ var (
 	snapshotLocalBucket = "velero-restore"
 )
 
+// etcHostsScript is the provision.d script that points /etc/hosts
+// at the ingress controller
+const etcHostsScript = "30-etc-hosts.sh"
+
 type Options struct {
 	DeployApps        []string
 	SnapshotTarget    string
 	SnapshotChannel   box.SnapshotLockChannel
+	SnapshotStream    bool
+	SnapshotDigest    string
+	SnapshotURI       string
+	SnapshotAge       int
 	KubernetesRuntime kubernetesruntime.Runtime
 	Base              bool
 	UseDevspace       bool
@@ -97,10 +114,17 @@ func (o *Options) MarshalLog(addField func(key string, v interface{})) {
 	addField("devenv.provision.deploy_apps", o.DeployApps)
 	addField("devenv.provision.snapshot_target", o.SnapshotTarget)
 	addField("devenv.provision.snapshot_channel", o.SnapshotChannel)
+	addField("devenv.provision.snapshot_stream", o.SnapshotStream)
+	addField("devenv.provision.snapshot_digest", o.SnapshotDigest)
+	addField("devenv.provision.snapshot_uri", o.SnapshotURI)
+	addField("devenv.provision.snapshot_age", o.SnapshotAge)
 	addField("devenv.provision.base", o.Base)
 	addField("devenv.provision.use_devspace", o.UseDevspace)
 
 	addField("devenv.runtime", o.KubernetesRuntime.GetConfig().Name)
+	if kr, ok := o.KubernetesRuntime.(*kubernetesruntime.KindRuntime); ok {
+		addField("devenv.provision.workers", kr.Workers.Count)
+	}
 }
 
 // NewOptions creates a new provision command
@@ -158,11 +182,39 @@ func NewCmdProvision(log logrus.FieldLogger) *cli.Command { //nolint:funlen
 				Usage: "Snapshot channel to use",
 				Value: string(box.SnapshotLockChannelStable),
 			},
+			&cli.StringFlag{
+				Name:  "snapshot-digest",
+				Usage: "Use the snapshot of the snapshot target with this digest, instead of the latest",
+			},
+			&cli.StringFlag{
+				Name:  "snapshot-uri",
+				Usage: "Use the snapshot at this key in the snapshot bucket, instead of the latest",
+			},
+			&cli.IntFlag{
+				Name:  "snapshot-age",
+				Usage: "Use the Nth previous snapshot in the snapshot channel, instead of the latest, e.g. 1 for the one before the latest",
+			},
+			&cli.BoolFlag{
+				Name:  "snapshot-stream",
+				Usage: "Stream the snapshot into the environment instead of downloading it first, uses less disk but failed downloads aren't resumed",
+			},
 			&cli.StringFlag{
 				Name:  "kubernetes-runtime",
 				Usage: "Specify which kubernetes runtime to use (options: kind, loft)",
 				Value: "kind",
 			},
+			&cli.IntFlag{
+				Name:  "workers",
+				Usage: "Number of worker nodes to create in addition to the control-plane node (kind only)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "node-label",
+				Usage: "Label to apply to worker nodes, in the format key=value, can be repeated (kind only)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "node-taint",
+				Usage: "Taint to apply to worker nodes, in the format key[=value]:effect, can be repeated (kind only)",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			ctx := trace.StartCall(c.Context, "provision")
@@ -184,6 +236,23 @@ func NewCmdProvision(log logrus.FieldLogger) *cli.Command { //nolint:funlen
 			o.UseDevspace = c.Bool("x-use-devspace")
 			o.SnapshotTarget = c.String("snapshot-target")
 			o.SnapshotChannel = box.SnapshotLockChannel(c.String("snapshot-channel"))
+			o.SnapshotStream = c.Bool("snapshot-stream")
+			o.SnapshotDigest = c.String("snapshot-digest")
+			o.SnapshotURI = c.String("snapshot-uri")
+			o.SnapshotAge = c.Int("snapshot-age")
+
+			pinned := 0
+			for _, set := range []bool{o.SnapshotDigest != "", o.SnapshotURI != "", o.SnapshotAge != 0} {
+				if set {
+					pinned++
+				}
+			}
+			if pinned > 1 {
+				return trace.SetCallStatus(ctx, fmt.Errorf("only one of --snapshot-digest, --snapshot-uri and --snapshot-age can be set"))
+			}
+			if o.SnapshotAge < 0 {
+				return trace.SetCallStatus(ctx, fmt.Errorf("--snapshot-age can't be negative"))
+			}
 
 			runtimeName := c.String("kubernetes-runtime")
 			k8sRuntime, err := kubernetesruntime.GetRuntime(runtimeName)
@@ -193,6 +262,10 @@ func NewCmdProvision(log logrus.FieldLogger) *cli.Command { //nolint:funlen
 			}
 			o.KubernetesRuntime = k8sRuntime
 
+			if err := o.configureWorkers(c.Int("workers"), c.StringSlice("node-label"), c.StringSlice("node-taint")); err != nil {
+				return trace.SetCallStatus(ctx, err)
+			}
+
 			trace.AddInfo(ctx, o)
 
 			return trace.SetCallStatus(ctx, o.Run(ctx))
@@ -200,6 +273,46 @@ func NewCmdProvision(log logrus.FieldLogger) *cli.Command { //nolint:funlen
 	}
 }
 
+// configureWorkers configures the worker nodes created by the kubernetes
+// runtime, this is only supported by the kind runtime.
+func (o *Options) configureWorkers(count int, labels, taints []string) error {
+	if count == 0 && len(labels) == 0 && len(taints) == 0 {
+		return nil
+	}
+
+	kr, ok := o.KubernetesRuntime.(*kubernetesruntime.KindRuntime)
+	if !ok {
+		return fmt.Errorf("--workers, --node-label and --node-taint are only supported by the kind runtime")
+	}
+
+	if count <= 0 {
+		return fmt.Errorf("--node-label and --node-taint require --workers to be set")
+	}
+
+	kr.Workers = kubernetesruntime.KindWorkers{
+		Count:  count,
+		Labels: make(map[string]string),
+	}
+
+	for _, l := range labels {
+		spl := strings.SplitN(l, "=", 2)
+		if len(spl) != 2 || spl[0] == "" {
+			return fmt.Errorf("invalid node label '%s', expected key=value", l)
+		}
+		kr.Workers.Labels[spl[0]] = spl[1]
+	}
+
+	for _, t := range taints {
+		taint, err := kubernetesruntime.ParseTaint(t)
+		if err != nil {
+			return err
+		}
+		kr.Workers.Taints = append(kr.Workers.Taints, taint)
+	}
+
+	return nil
+}
+
 func (o *Options) applyPostRestore(ctx context.Context, manifestsCompressed []byte) error { //nolint:funlen
 	gzr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding,
 		bytes.NewReader(manifestsCompressed)))
@@ -270,20 +383,20 @@ func (o *Options) snapshotRestore(ctx context.Context) error { //nolint:funlen,g
 		return errors.Wrap(err, "failed to setup snapshot infrastructure")
 	}
 
-	rawSnapshotInfo, err := o.k.CoreV1().ConfigMaps("devenv").Get(ctx, "snapshot", metav1.GetOptions{})
+	rawSnapshotInfo, err := o.k.CoreV1().ConfigMaps("devenv").Get(ctx, snapshot.InfoConfigMap, metav1.GetOptions{})
 	if err != nil {
 		return errors.Wrap(err, "failed to retrieve loaded snapshot information")
 	}
 
 	var snapshotTarget box.SnapshotLockListItem
-	if err := json.Unmarshal([]byte(rawSnapshotInfo.Data["snapshot.json"]), &snapshotTarget); err != nil {
+	if err := json.Unmarshal([]byte(rawSnapshotInfo.Data[snapshot.InfoSnapshotKey]), &snapshotTarget); err != nil {
 		return errors.Wrap(err, "failed to parse snapshot from kubernetes configmap")
 	}
 
 	// Wait for Velero to load the backup
 	o.log.Info("Creating snapshot storage CRD")
 	err = devenvutil.Backoff(ctx, 10*time.Second, 10, func() error {
-		err2 := m.CreateBackupStorage(ctx, "devenv", snapshotLocalBucket)
+		err2 := m.CreateBackupStorage(ctx, "devenv", snapshotLocalBucket, "")
 		if err2 != nil && !kerrors.IsAlreadyExists(err2) {
 			o.log.WithError(err2).Debug("Waiting to create backup storage location")
 		}
@@ -315,10 +428,13 @@ func (o *Options) snapshotRestore(ctx context.Context) error { //nolint:funlen,g
 	o.log.Info("Cleaning up snapshot restore artifacts")
 
 	// After we restore the snapshot we no longer need the velero resource. They can also prevent auto scaling in loft.
-	if err := cmdutil.RunKubernetesCommand(ctx, "", false, "kubectl", "delete", "helmchart", "-n", "kube-system", "velero"); err != nil {
-		return errors.Wrap(err, "failed to cleanup velero helm chart")
+	// Snapshot generation still needs them to create a snapshot derived from this one.
+	if os.Getenv("DEVENV_SNAPSHOT_GENERATION") == "" {
+		if err := cmdutil.RunKubernetesCommand(ctx, "", false, "kubectl", "delete", "helmchart", "-n", "kube-system", "velero"); err != nil {
+			return errors.Wrap(err, "failed to cleanup velero helm chart")
+		}
+		o.log.Info("Deleted velero helmchart")
 	}
-	o.log.Info("Deleted velero helmchart")
 
 	if err := o.runProvisionScripts(ctx); err != nil {
 		return errors.Wrap(err, "failed to run provision.d scripts")
@@ -467,6 +583,12 @@ func (o *Options) runProvisionScripts(ctx context.Context) error {
 			continue
 		}
 
+		// /etc/hosts should only ever point to the default cluster, not
+		// clusters that were created alongside it
+		if f.Name() == etcHostsScript && kubernetesruntime.GetKindClusterName() != kubernetesruntime.KindClusterName {
+			continue
+		}
+
 		o.log.WithField("script", f.Name()).Info("Running provision.d script")
 
 		// HACK: In the future we should just expose setting env vars
@@ -493,9 +615,13 @@ func (o *Options) removeServiceImages(ctx context.Context) error {
 		return nil
 	}
 
+	// Use the container of the cluster being provisioned, which isn't the
+	// default one when generating snapshots in parallel
+	container := kubernetesruntime.GetKindControlPlaneContainer()
+
 	//nolint:gosec // Why: We're passing a constant
 	cmd := exec.CommandContext(ctx, "docker", "exec",
-		kubernetesruntime.KindClusterName+"-control-plane", "ctr", "--namespace", "k8s.io", "images", "ls")
+		container, "ctr", "--namespace", "k8s.io", "images", "ls")
 	b, err := cmd.CombinedOutput()
 	if err != nil {
 		return errors.Wrapf(err, "failed to list docker images: %s", string(b))
@@ -525,7 +651,7 @@ func (o *Options) removeServiceImages(ctx context.Context) error {
 
 	for img := range images {
 		o.log.WithField("image", img).Infoln("Removing docker image")
-		if err2 := containerruntime.RemoveImage(ctx, img); err2 != nil {
+		if err2 := containerruntime.RemoveImage(ctx, container, img); err2 != nil {
 			o.log.WithField("image", img).Warn("Failed to remove docker image")
 		}
 	}
@@ -616,8 +742,13 @@ func (o *Options) Run(ctx context.Context) error { //nolint:funlen,gocyclo
 		return errors.Wrap(err, "failed to create kubernetes cluster")
 	}
 
+	kubeConfPath, err := kube.GetKubeConfig()
+	if err != nil {
+		return err
+	}
+
 	//nolint:govet // Why: OK w/ err shadow
-	if err := clientcmd.WriteToFile(*kconf, filepath.Join(o.homeDir, ".outreach", "kubeconfig.yaml")); err != nil {
+	if err := clientcmd.WriteToFile(*kconf, kubeConfPath); err != nil {
 		return errors.Wrap(err, "failed to write kubeconfig")
 	}
 
@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/getoutreach/devenv/internal/snapshot"
 	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
 	"github.com/getoutreach/gobox/pkg/app"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/pkg/errors"
@@ -17,6 +18,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// snapshotDownloadDir is the directory the snapshot staging job downloads snapshots into
+const snapshotDownloadDir = "/var/cache/devenv-snapshot"
+
+// snapshotChunkCacheDir is the directory the snapshot staging job caches
+// the chunks of chunked snapshots in
+const snapshotChunkCacheDir = "/var/cache/devenv-snapshot-chunks"
+
 // startSnapshotRestore kicks off the snapshot staging job and waits for
 // it to finish
 //nolint:funlen // Why: most of this is just structs
@@ -48,7 +56,24 @@ func (o *Options) stageSnapshot(ctx context.Context, target string, channel box.
 			AWSSecretKey:    creds.SecretAccessKey,
 			AWSSessionToken: creds.SessionToken,
 			Region:          o.b.DeveloperEnvironmentConfig.SnapshotConfig.Region,
+			Key:             o.SnapshotURI,
+			Digest:          o.SnapshotDigest,
+			SnapshotAge:     o.SnapshotAge,
 		},
+		DownloadDir:   snapshotDownloadDir,
+		Stream:        o.SnapshotStream,
+		ChunkCacheDir: snapshotChunkCacheDir,
+	}
+
+	// Local clusters cache chunks on the host, so that they're kept when
+	// the cluster is recreated and only the chunks that changed are fetched
+	chunkCache := corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+	if o.KubernetesRuntime.GetConfig().Type == kubernetesruntime.RuntimeTypeLocal {
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		chunkCache = corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+			Path: kubernetesruntime.KindSnapshotChunkCachePath,
+			Type: &hostPathType,
+		}}
 	}
 
 	// marshal the configuration into json so that
@@ -86,6 +111,29 @@ func (o *Options) stageSnapshot(ctx context.Context, target string, channel box.
 									Value: string(confStr),
 								},
 							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "download",
+									MountPath: snapshotDownloadDir,
+								},
+								{
+									Name:      "chunk-cache",
+									MountPath: snapshotChunkCacheDir,
+								},
+							},
+						},
+					},
+					// Keep partial downloads across container restarts so they can be resumed
+					Volumes: []corev1.Volume{
+						{
+							Name: "download",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name:         "chunk-cache",
+							VolumeSource: chunkCache,
 						},
 					},
 				},
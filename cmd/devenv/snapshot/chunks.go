@@ -0,0 +1,176 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // Why: just using for digest checking
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	noncmdsnapshot "github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/pkg/snapshoter"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// chunkUploader uploads the chunks of a snapshot into S3, skipping
+// chunks that have already been uploaded by a previous snapshot.
+type chunkUploader struct {
+	s3c    *s3.Client
+	bucket string
+	enc    *zstd.Encoder
+
+	// seen are the chunks that are known to exist in S3
+	seen map[string]bool
+
+	// uploaded and reused are the number of chunks that were
+	// uploaded, and that already existed, respectively
+	uploaded int
+	reused   int
+}
+
+// upload uploads a chunk into S3, if it doesn't already exist
+func (c *chunkUploader) upload(ctx context.Context, digest string, chunk []byte) error {
+	if c.seen[digest] {
+		c.reused++
+		return nil
+	}
+
+	key := noncmdsnapshot.ChunkKey(digest)
+	if _, err := c.s3c.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &c.bucket, Key: &key}); err == nil {
+		c.seen[digest] = true
+		c.reused++
+		return nil
+	}
+
+	compressed := c.enc.EncodeAll(chunk, nil)
+	hash := md5.Sum(compressed) //nolint:gosec // Why: We're just creating a digest
+	hashStr := base64.StdEncoding.EncodeToString(hash[:])
+	_, err := c.s3c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:     &c.bucket,
+		Key:        &key,
+		Body:       bytes.NewReader(compressed),
+		ContentMD5: &hashStr,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload chunk %s", digest)
+	}
+
+	c.seen[digest] = true
+	c.uploaded++
+	return nil
+}
+
+// addFile splits a file into chunks, uploads them and adds it to a manifest
+func (c *chunkUploader) addFile(ctx context.Context, m *noncmdsnapshot.ChunkManifest, name string, size int64, r io.Reader) error {
+	chunks, err := noncmdsnapshot.SplitChunks(r, func(digest string, chunk []byte) error {
+		return c.upload(ctx, digest, chunk)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to chunk %s", name)
+	}
+
+	m.Files = append(m.Files, noncmdsnapshot.ChunkedFile{Name: name, Size: size, Chunks: chunks})
+	return nil
+}
+
+// uploadChunkedSnapshot uploads the contents of the local snapshot bucket as
+// content-addressed chunks, and a manifest of them. Unlike uploadSnapshot, only
+// chunks that weren't uploaded by previous snapshots are uploaded.
+//nolint:funlen,gocritic // Why: Mirrors uploadSnapshot
+func (o *Options) uploadChunkedSnapshot(ctx context.Context, s3c *s3.Client,
+	name string, t *box.SnapshotTarget) (string, string, error) {
+	mc, err := snapshoter.NewSnapshotBackend(ctx, o.r, o.k)
+	if err != nil {
+		return "", "", err
+	}
+	defer mc.Close()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to create zstd encoder")
+	}
+	defer enc.Close()
+
+	c := &chunkUploader{
+		s3c:    s3c,
+		bucket: o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
+		enc:    enc,
+		seen:   make(map[string]bool),
+	}
+	manifest := &noncmdsnapshot.ChunkManifest{}
+
+	o.log.Info("uploading snapshot chunks")
+	for obj := range mc.ListObjects(ctx, noncmdsnapshot.SnapshotNamespace, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return "", "", errors.Wrap(obj.Err, "failed to list objects in local S3")
+		}
+		if obj.Key == "" {
+			continue
+		}
+
+		sObj, err := mc.GetObject(ctx, noncmdsnapshot.SnapshotNamespace, obj.Key, minio.GetObjectOptions{}) //nolint:govet
+		if err != nil {
+			return "", "", errors.Wrap(err, "failed to get object from local S3")
+		}
+
+		err = c.addFile(ctx, manifest, obj.Key, obj.Size, sObj)
+		sObj.Close()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// Include the post-restore manifests at the same well-known path as uploadSnapshot
+	if t.PostRestore != "" {
+		f, err := os.Open(t.PostRestore) //nolint:govet // Why: We're OK shadowing err.
+		if err != nil {
+			return "", "", errors.Wrap(err, "failed to open post-restore file")
+		}
+		defer f.Close()
+
+		inf, err := f.Stat()
+		if err != nil {
+			return "", "", errors.Wrap(err, "failed to stat post-restore file")
+		}
+
+		if err := c.addFile(ctx, manifest, postRestoreArchivePath, inf.Size(), f); err != nil {
+			return "", "", err
+		}
+	}
+	o.log.WithField("chunks.uploaded", c.uploaded).WithField("chunks.reused", c.reused).Info("uploaded snapshot chunks")
+
+	byt, err := json.Marshal(manifest)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to marshal chunk manifest")
+	}
+
+	// The digest is stored in the lockfile, the MD5 is only used by S3 to
+	// verify the upload.
+	hash := md5.Sum(byt) //nolint:gosec // Why: We're just creating a digest
+	hashStr := base64.StdEncoding.EncodeToString(hash[:])
+	key := filepath.Join("automated-snapshots", "v2", name,
+		strconv.Itoa(int(time.Now().UTC().UnixNano()))+noncmdsnapshot.ManifestSuffix)
+
+	o.log.WithField("bucket", c.bucket).WithField("key", key).Info("uploading chunk manifest")
+	_, err = s3c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:     aws.String(c.bucket),
+		Key:        &key,
+		Body:       bytes.NewReader(byt),
+		ContentMD5: &hashStr,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return noncmdsnapshot.Digest(byt), key, nil
+}
@@ -0,0 +1,326 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	noncmdsnapshot "github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/snapshoter"
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// archiveManifestName is the name of the file, at the start of an
+	// exported snapshot, that describes the snapshot in it
+	archiveManifestName = "devenv-snapshot.json"
+
+	// importBucket is the bucket in the in-cluster minio that imported
+	// snapshots are stored in, each under a prefix of their name
+	importBucket = "velero-imports"
+)
+
+// archiveManifest describes the snapshot in an exported snapshot
+type archiveManifest struct {
+	// Name is the name of the snapshot
+	Name string `json:"name"`
+
+	// Namespaces are the namespaces included in the snapshot
+	Namespaces []string `json:"namespaces"`
+
+	// CreatedAt is when the snapshot was created
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// importStorageLocation returns the name of the velero backup
+// storage location for an imported snapshot
+func importStorageLocation(name string) string {
+	return "import-" + name
+}
+
+// storagePrefix returns the prefix in its bucket that a backup storage
+// location stores objects under, with a trailing slash if not empty.
+func storagePrefix(bsl *velerov1api.BackupStorageLocation) string {
+	if bsl.Spec.ObjectStorage == nil || bsl.Spec.ObjectStorage.Prefix == "" {
+		return ""
+	}
+	return path.Clean(bsl.Spec.ObjectStorage.Prefix) + "/"
+}
+
+// volumeNamespaces returns the namespaces of the volumes in a snapshot,
+// their data is stored in a restic repository per namespace.
+func (o *Options) volumeNamespaces(ctx context.Context, name string) ([]string, error) {
+	pvbs, err := o.vc.VeleroV1().PodVolumeBackups(noncmdsnapshot.SnapshotNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: velerov1api.BackupNameLabel + "=" + name,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list snapshot volumes")
+	}
+
+	seen := make(map[string]bool)
+	namespaces := make([]string, 0)
+	for i := range pvbs.Items {
+		ns := pvbs.Items[i].Spec.Pod.Namespace
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// Export writes a local snapshot into a zstd compressed tar archive. The archive
+// contains the velero backup and the restic repositories of its volumes, so it
+// can be imported into any developer environment.
+func (o *Options) Export(ctx context.Context, name, output string) error {
+	if err := o.ensureSnapshotInfrastructure(ctx); err != nil {
+		return err
+	}
+
+	backup, err := o.getLocalSnapshot(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if backup.Status.Phase != velerov1api.BackupPhaseCompleted {
+		return fmt.Errorf("snapshot %q has status %s, only completed snapshots can be exported", name, backup.Status.Phase)
+	}
+
+	mc, err := snapshoter.NewSnapshotBackend(ctx, o.r, o.k)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to snapshot storage")
+	}
+	defer mc.Close()
+
+	f, err := os.Create(output)
+	if err != nil {
+		return errors.Wrap(err, "failed to create output file")
+	}
+	defer f.Close()
+
+	o.log.WithField("snapshot", name).WithField("output", output).Info("Exporting snapshot")
+	if err := o.writeExport(ctx, mc.Client, backup, f); err != nil { //nolint:govet // Why: OK shadowing err
+		return err
+	}
+	if err := f.Close(); err != nil { //nolint:govet // Why: OK shadowing err
+		return errors.Wrap(err, "failed to write output file")
+	}
+
+	o.log.Infof("Exported snapshot %q, import it with 'devenv snapshot import %s'", name, output)
+	return nil
+}
+
+// writeExport writes the archive of a local snapshot, stored in m, into w
+func (o *Options) writeExport(ctx context.Context, m *minio.Client, backup *velerov1api.Backup, w io.Writer) error {
+	name := backup.Name
+	bsl, err := o.vc.VeleroV1().BackupStorageLocations(noncmdsnapshot.SnapshotNamespace).
+		Get(ctx, backup.Spec.StorageLocation, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get snapshot storage location")
+	}
+	if bsl.Spec.ObjectStorage == nil {
+		return fmt.Errorf("snapshot storage location %q has no bucket", bsl.Name)
+	}
+	bucket := bsl.Spec.ObjectStorage.Bucket
+	prefix := storagePrefix(bsl)
+
+	volumeNamespaces, err := o.volumeNamespaces(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return errors.Wrap(err, "failed to create zstd writer")
+	}
+	tw := tar.NewWriter(zw)
+
+	manifest, err := json.Marshal(archiveManifest{
+		Name:       name,
+		Namespaces: backupNamespaces(backup),
+		CreatedAt:  backup.CreationTimestamp.Time,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal snapshot manifest")
+	}
+
+	if err := writeArchiveFile(tw, archiveManifestName, manifest); err != nil { //nolint:govet // Why: OK shadowing err
+		return err
+	}
+
+	// Restic repositories are shared by every snapshot of a namespace, so they
+	// include the data of other snapshots too.
+	dirs := []string{path.Join("backups", name) + "/"}
+	for _, ns := range volumeNamespaces {
+		dirs = append(dirs, path.Join("restic", ns)+"/")
+	}
+
+	aw := noncmdsnapshot.NewArchiveWriter(tw)
+	for _, dir := range dirs {
+		if err := snapshoter.WriteArchive(ctx, aw, m, bucket, prefix, dir); err != nil { //nolint:govet // Why: OK shadowing err
+			return errors.Wrapf(err, "failed to export %s", dir)
+		}
+	}
+
+	// Checksums are written last so files can be verified as they're imported
+	if err := aw.Close(); err != nil { //nolint:govet // Why: OK shadowing err
+		return err
+	}
+
+	if err := tw.Close(); err != nil { //nolint:govet // Why: OK shadowing err
+		return errors.Wrap(err, "failed to finish tar archive")
+	}
+	return errors.Wrap(zw.Close(), "failed to finish zstd compression")
+}
+
+// readArchiveManifest reads the manifest at the start of an exported snapshot
+func readArchiveManifest(tr *tar.Reader) (*archiveManifest, error) {
+	header, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tar header")
+	}
+
+	if header.Name != archiveManifestName {
+		return nil, fmt.Errorf("not an exported snapshot, expected %s at the start of the archive", archiveManifestName)
+	}
+
+	var manifest archiveManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to parse snapshot manifest")
+	}
+
+	if errs := validation.IsDNS1123Subdomain(manifest.Name); len(errs) != 0 {
+		return nil, fmt.Errorf("invalid snapshot name %q: %s", manifest.Name, strings.Join(errs, ", "))
+	}
+
+	return &manifest, nil
+}
+
+// Import imports a snapshot exported by Export into the developer environment,
+// it can then be restored like any other local snapshot.
+func (o *Options) Import(ctx context.Context, input string) error {
+	if err := o.ensureSnapshotInfrastructure(ctx); err != nil {
+		return err
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		return errors.Wrap(err, "failed to open exported snapshot")
+	}
+	defer f.Close()
+
+	mc, err := snapshoter.NewSnapshotBackend(ctx, o.r, o.k)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to snapshot storage")
+	}
+	defer mc.Close()
+
+	name, err := o.extractImport(ctx, mc.Client, f)
+	if err != nil {
+		return err
+	}
+
+	m, err := noncmdsnapshot.NewManager(o.log, o.b)
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot client")
+	}
+
+	err = m.CreateBackupStorage(ctx, importStorageLocation(name), importBucket, name)
+	if err != nil && !kerrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "failed to create snapshot storage location")
+	}
+
+	o.log.Info("Waiting for velero to load the snapshot")
+	err = devenvutil.Backoff(ctx, 5*time.Second, 36, func() error {
+		_, err := m.RetrieveVeleroBackup(ctx, name)
+		return err
+	}, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify velero loaded snapshot")
+	}
+
+	o.log.Infof("Imported snapshot %q, restore it with 'devenv snapshot restore %s'", name, name)
+	return nil
+}
+
+// extractImport extracts an exported snapshot, read from r, into the import
+// bucket in m, returning the name of the snapshot. Snapshots that already
+// exist aren't imported.
+func (o *Options) extractImport(ctx context.Context, m *minio.Client, r io.Reader) (string, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create zstd reader")
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	manifest, err := readArchiveManifest(tr)
+	if err != nil {
+		return "", err
+	}
+	name := manifest.Name
+
+	_, err = o.vc.VeleroV1().Backups(noncmdsnapshot.SnapshotNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return "", fmt.Errorf("snapshot %q already exists, delete it with 'devenv snapshot delete %s' to import it again", name, name)
+	} else if !kerrors.IsNotFound(err) {
+		return "", errors.Wrapf(err, "failed to check if snapshot %q exists", name)
+	}
+
+	exists, err := m.BucketExists(ctx, importBucket)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to check if import bucket exists")
+	}
+	if !exists {
+		if err := m.MakeBucket(ctx, importBucket, minio.MakeBucketOptions{}); err != nil { //nolint:govet // Why: OK shadowing err
+			return "", errors.Wrap(err, "failed to create import bucket")
+		}
+	}
+
+	o.log.WithField("snapshot", name).Info("Importing snapshot")
+	if err := snapshoter.ExtractArchive(ctx, tr, m, importBucket, name+"/"); err != nil { //nolint:govet // Why: OK shadowing err
+		return "", errors.Wrap(err, "failed to import snapshot")
+	}
+
+	return name, nil
+}
+
+// removeImport removes the storage of an imported snapshot
+func (o *Options) removeImport(ctx context.Context, name string) error {
+	err := o.vc.VeleroV1().BackupStorageLocations(noncmdsnapshot.SnapshotNamespace).
+		Delete(ctx, importStorageLocation(name), metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to delete snapshot storage location")
+	}
+
+	mc, err := snapshoter.NewSnapshotBackend(ctx, o.r, o.k)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to snapshot storage")
+	}
+	defer mc.Close()
+
+	objects := mc.ListObjects(ctx, importBucket, minio.ListObjectsOptions{Prefix: name + "/", Recursive: true})
+	for rerr := range mc.RemoveObjects(ctx, importBucket, objects, minio.RemoveObjectsOptions{}) {
+		if rerr.Err != nil {
+			return errors.Wrapf(rerr.Err, "failed to remove %s", rerr.ObjectName)
+		}
+	}
+
+	return nil
+}
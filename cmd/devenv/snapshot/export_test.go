@@ -0,0 +1,195 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	noncmdsnapshot "github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/internal/snapshot/snapshottest"
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newArchive creates a zstd compressed tar archive of files, in order
+func newArchive(t *testing.T, files [][2]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	assert.NilError(t, err)
+
+	tw := tar.NewWriter(zw)
+	for _, f := range files {
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: f[0], Size: int64(len(f[1])), Mode: 0o644}))
+		_, err := tw.Write([]byte(f[1]))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	assert.NilError(t, zw.Close())
+
+	return &buf
+}
+
+func TestReadArchiveManifest(t *testing.T) {
+	manifest, err := json.Marshal(archiveManifest{Name: "before-migration", Namespaces: []string{"my-database"}})
+	assert.NilError(t, err)
+
+	buf := newArchive(t, [][2]string{
+		{archiveManifestName, string(manifest)},
+		{"backups/before-migration/velero-backup.json", "{}"},
+	})
+	zr, err := zstd.NewReader(buf)
+	assert.NilError(t, err)
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	got, err := readArchiveManifest(tr)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Name, "before-migration")
+	assert.DeepEqual(t, got.Namespaces, []string{"my-database"})
+
+	// The rest of the archive is left to be imported
+	header, err := tr.Next()
+	assert.NilError(t, err)
+	assert.Equal(t, header.Name, "backups/before-migration/velero-backup.json")
+}
+
+func TestReadArchiveManifestErrors(t *testing.T) {
+	tests := map[string][][2]string{
+		"missing manifest": {{"backups/x/velero-backup.json", "{}"}},
+		"invalid name":     {{archiveManifestName, `{"name":"../etc"}`}},
+	}
+
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			zr, err := zstd.NewReader(newArchive(t, files))
+			assert.NilError(t, err)
+			defer zr.Close()
+
+			_, err = readArchiveManifest(tar.NewReader(zr))
+			assert.Assert(t, err != nil)
+		})
+	}
+}
+
+func TestStoragePrefix(t *testing.T) {
+	bsl := &velerov1api.BackupStorageLocation{}
+	assert.Equal(t, storagePrefix(bsl), "")
+
+	bsl.Spec.ObjectStorage = &velerov1api.ObjectStorageLocation{Bucket: "velero"}
+	assert.Equal(t, storagePrefix(bsl), "")
+
+	bsl.Spec.ObjectStorage.Prefix = "before-migration"
+	assert.Equal(t, storagePrefix(bsl), "before-migration/")
+}
+
+func TestExportImport(t *testing.T) { //nolint:funlen
+	ctx := context.Background()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	backup := &velerov1api.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "before-migration",
+			Namespace:   noncmdsnapshot.SnapshotNamespace,
+			Labels:      map[string]string{localSnapshotLabel: "true"},
+			Annotations: map[string]string{namespacesAnnotation: "my-database"},
+		},
+		Spec:   velerov1api.BackupSpec{StorageLocation: defaultBackupStorageLocation},
+		Status: velerov1api.BackupStatus{Phase: velerov1api.BackupPhaseCompleted},
+	}
+	pvb := func(name, backupName, namespace string) *velerov1api.PodVolumeBackup {
+		return &velerov1api.PodVolumeBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: noncmdsnapshot.SnapshotNamespace,
+				Labels:    map[string]string{velerov1api.BackupNameLabel: backupName},
+			},
+			Spec: velerov1api.PodVolumeBackupSpec{Pod: corev1.ObjectReference{Namespace: namespace}},
+		}
+	}
+	exporter := &Options{
+		log: log,
+		vc: velerofake.NewSimpleClientset(
+			backup,
+			&velerov1api.BackupStorageLocation{
+				ObjectMeta: metav1.ObjectMeta{Name: defaultBackupStorageLocation, Namespace: noncmdsnapshot.SnapshotNamespace},
+				Spec: velerov1api.BackupStorageLocationSpec{
+					StorageType: velerov1api.StorageType{ObjectStorage: &velerov1api.ObjectStorageLocation{Bucket: "velero"}},
+				},
+			},
+			pvb("before-migration-1", "before-migration", "my-database"),
+			pvb("other-1", "other", "other"),
+		),
+	}
+
+	// Only the backup, and the restic repositories of its volumes, are exported
+	src := &snapshottest.S3{}
+	srcClient := snapshottest.NewS3Client(t, src)
+	files := map[string]string{
+		"backups/before-migration/velero-backup.json": "{}",
+		"backups/before-migration/logs.gz":            "logs",
+		"backups/other/velero-backup.json":            "{}",
+		"restic/my-database/config":                   "config",
+		"restic/my-database/data/00/abc":              "data",
+		"restic/other/config":                         "config",
+	}
+	for k, v := range files {
+		_, err := srcClient.PutObject(ctx, "velero", k, strings.NewReader(v), int64(len(v)), minio.PutObjectOptions{})
+		assert.NilError(t, err)
+	}
+
+	var archive bytes.Buffer
+	assert.NilError(t, exporter.writeExport(ctx, srcClient, backup, &archive))
+
+	// Snapshots that already exist aren't imported over
+	dest := &snapshottest.S3{}
+	destClient := snapshottest.NewS3Client(t, dest)
+	_, err := exporter.extractImport(ctx, destClient, bytes.NewReader(archive.Bytes()))
+	assert.ErrorContains(t, err, `snapshot "before-migration" already exists`)
+	assert.Equal(t, len(dest.Objects()), 0)
+
+	importer := &Options{log: log, vc: velerofake.NewSimpleClientset()}
+	name, err := importer.extractImport(ctx, destClient, bytes.NewReader(archive.Bytes()))
+	assert.NilError(t, err)
+	assert.Equal(t, name, "before-migration")
+	assert.DeepEqual(t, dest.Objects(), map[string][]byte{
+		"before-migration/backups/before-migration/velero-backup.json": []byte("{}"),
+		"before-migration/backups/before-migration/logs.gz":            []byte("logs"),
+		"before-migration/restic/my-database/config":                   []byte("config"),
+		"before-migration/restic/my-database/data/00/abc":              []byte("data"),
+	})
+}
+
+func TestImportVerifiesChecksums(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	manifest, err := json.Marshal(archiveManifest{Name: "before-migration"})
+	assert.NilError(t, err)
+	archive := newArchive(t, [][2]string{
+		{archiveManifestName, string(manifest)},
+		{"backups/before-migration/velero-backup.json", "{}"},
+		{"backups/before-migration/velero-backup.json" + noncmdsnapshot.ChecksumSuffix, noncmdsnapshot.Digest([]byte("{}"))},
+		{"restic/my-database/config", "corrupt"},
+		{"restic/my-database/config" + noncmdsnapshot.ChecksumSuffix, noncmdsnapshot.Digest([]byte("config"))},
+	})
+
+	dest := &snapshottest.S3{}
+	o := &Options{log: log, vc: velerofake.NewSimpleClientset()}
+	_, err = o.extractImport(context.Background(), snapshottest.NewS3Client(t, dest), archive)
+	assert.ErrorContains(t, err, "file 'restic/my-database/config' failed checksum validation")
+
+	// The corrupt file isn't left behind
+	_, ok := dest.Objects()["before-migration/restic/my-database/config"]
+	assert.Assert(t, !ok)
+}
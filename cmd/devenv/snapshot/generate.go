@@ -0,0 +1,582 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/getoutreach/devenv/internal/apps"
+	"github.com/getoutreach/devenv/pkg/app"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// generateClusterPrefix is the prefix of the names of the kind clusters
+// that targets are generated in when generating in parallel
+const generateClusterPrefix = "devenv-snapshot-"
+
+// GenerateConfig is the snapshots.yaml that snapshots are generated from
+type GenerateConfig struct {
+	*box.SnapshotGenerateConfig
+
+	// Bases maps derived targets to the target they're derived from.
+	// Derived targets are generated by restoring a snapshot of their
+	// base target and applying their changes on top of it, rather than
+	// starting from an empty developer environment.
+	Bases map[string]string
+}
+
+// generateTargetConfig contains the fields of a target in snapshots.yaml
+// that aren't part of box.SnapshotTarget
+type generateTargetConfig struct {
+	// BaseTarget is the target this target is derived from
+	BaseTarget string `yaml:"base_target"`
+}
+
+// appDeployment is the result of deploying an application while generating a snapshot
+type appDeployment struct {
+	// App is the application as it was passed to deploy
+	App string `json:"app"`
+
+	// Duration is how long the deployment took
+	Duration time.Duration `json:"duration"`
+
+	// Error is why the deployment failed, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// generatedSnapshot is the result of generating a snapshot of a target
+type generatedSnapshot struct {
+	// Target is the name of the target the snapshot was generated for
+	Target string `json:"target"`
+
+	// Item is the snapshot's lockfile item
+	Item *box.SnapshotLockListItem `json:"item"`
+
+	// Deployments are the applications deployed by the target, in order
+	Deployments []appDeployment `json:"deployments"`
+
+	// Apps are all of the applications, and their versions, in the snapshot
+	Apps []apps.App `json:"apps"`
+
+	// Duration is how long generating the snapshot took
+	Duration time.Duration `json:"duration"`
+
+	// Error is why generating the snapshot failed, if it did. Failed
+	// snapshots have no Item or Apps, only the Deployments before it failed
+	Error string `json:"error,omitempty"`
+}
+
+// LoadGenerateConfig reads a snapshots.yaml
+func LoadGenerateConfig(path string) (*GenerateConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseGenerateConfig(b)
+}
+
+// parseGenerateConfig parses a snapshots.yaml, derived targets without
+// post-restore manifests inherit the ones of their base target.
+func parseGenerateConfig(b []byte) (*GenerateConfig, error) {
+	var s *box.SnapshotGenerateConfig
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if s == nil {
+		s = &box.SnapshotGenerateConfig{}
+	}
+
+	var extra struct {
+		Targets map[string]generateTargetConfig `yaml:"targets"`
+	}
+	if err := yaml.Unmarshal(b, &extra); err != nil {
+		return nil, err
+	}
+
+	conf := &GenerateConfig{SnapshotGenerateConfig: s, Bases: make(map[string]string)}
+	for name, t := range extra.Targets {
+		if t.BaseTarget == "" {
+			continue
+		}
+		if _, ok := s.Targets[t.BaseTarget]; !ok {
+			return nil, fmt.Errorf("target '%s' is derived from unknown target '%s'", name, t.BaseTarget)
+		}
+		conf.Bases[name] = t.BaseTarget
+	}
+
+	order, err := conf.generationOrder(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bases come first, so inherited manifests are passed down chains of derived targets
+	for _, name := range order {
+		base, ok := conf.Bases[name]
+		if !ok || s.Targets[name].PostRestore != "" {
+			continue
+		}
+
+		t := *s.Targets[name]
+		t.PostRestore = s.Targets[base].PostRestore
+		s.Targets[name] = &t
+	}
+
+	return conf, nil
+}
+
+// generationOrder returns the names of targets, defaulting to every target,
+// sorted so that targets are always after the target they're derived from.
+func (s *GenerateConfig) generationOrder(targets []string) ([]string, error) {
+	if len(targets) == 0 {
+		for name := range s.Targets {
+			targets = append(targets, name)
+		}
+	}
+	sort.Strings(targets)
+
+	selected := make(map[string]bool)
+	for _, name := range targets {
+		if _, ok := s.Targets[name]; !ok {
+			return nil, fmt.Errorf("unknown snapshot target '%s'", name)
+		}
+		selected[name] = true
+	}
+
+	order := make([]string, 0, len(targets))
+	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("target '%s' is derived from itself", name)
+		}
+
+		visiting[name] = true
+		if base, ok := s.Bases[name]; ok {
+			if err := visit(base); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+
+		// Bases that weren't selected aren't generated, the latest
+		// snapshot of them is used instead
+		if selected[name] {
+			order = append(order, name)
+		}
+		return nil
+	}
+
+	for _, name := range targets {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// findBaseSnapshot returns the snapshot of a base target that a derived target
+// is generated from, digest defaults to the latest snapshot in the channel.
+func findBaseSnapshot(lockfile *box.SnapshotLock, base string,
+	channel box.SnapshotLockChannel, digest string) (*box.SnapshotLockListItem, error) {
+	var snapshots []*box.SnapshotLockListItem
+	if t, ok := lockfile.TargetsV2[base]; ok && t.Snapshots != nil {
+		snapshots = t.Snapshots[channel]
+	}
+
+	for _, itm := range snapshots {
+		if digest == "" || itm.Digest == digest {
+			return itm, nil
+		}
+	}
+
+	if digest != "" {
+		return nil, fmt.Errorf("no snapshot of base target '%s' found with digest '%s' in channel '%s'", base, digest, channel)
+	}
+	return nil, fmt.Errorf("no snapshots of base target '%s' found in channel '%s', generate it first", base, channel)
+}
+
+// generateClusterName returns the name of the kind cluster a target is
+// generated in when generating in parallel
+func generateClusterName(target string) string {
+	name := []rune(strings.ToLower(target))
+	for i, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			name[i] = '-'
+		}
+	}
+	return generateClusterPrefix + string(name)
+}
+
+// generateParallel generates targets at once, each in a separate devenv
+// process with its own kind cluster, kubeconfig and devenv configuration.
+// Derived targets wait for their base target to be generated. The lockfile
+// is updated as every target finishes, failures are reported once all
+// targets have finished.
+func (o *Options) generateParallel(ctx context.Context, s3c *s3.Client, lockfile *box.SnapshotLock,
+	s *GenerateConfig, targets []string, channel box.SnapshotLockChannel, skipUpload bool) error { //nolint:funlen
+	dir, err := os.MkdirTemp("", "devenv-snapshot-generate-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	// done is closed once a target has finished, successfully or not
+	done := make(map[string]chan struct{})
+	for _, name := range targets {
+		done[name] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	generated := make(map[string]*generatedSnapshot)
+	errs := make(map[string]error)
+
+	var outMu sync.Mutex
+	sem := make(chan struct{}, o.Parallel)
+
+	var wg sync.WaitGroup
+	for _, name := range targets {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer close(done[name])
+
+			err := func() error {
+				var baseDigest string
+				if base, ok := s.Bases[name]; ok {
+					if baseDone, ok := done[base]; ok {
+						select {
+						case <-baseDone:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+
+						mu.Lock()
+						baseGen, baseErr := generated[base], errs[base]
+						mu.Unlock()
+						if baseErr != nil {
+							return fmt.Errorf("base target '%s' failed to generate", base)
+						}
+
+						// Snapshots that weren't uploaded can't be derived from,
+						// the latest uploaded one is used instead
+						if !skipUpload {
+							baseDigest = baseGen.Item.Digest
+						}
+					}
+				}
+
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				defer func() { <-sem }()
+
+				out := &prefixWriter{mu: &outMu, w: os.Stdout, prefix: "[" + name + "] "}
+				gen, err := o.runGenerateProcess(ctx, filepath.Join(dir, name), out, name, channel, baseDigest, skipUpload)
+				out.Flush()
+				if err != nil {
+					if gen != nil {
+						mu.Lock()
+						generated[name] = gen
+						mu.Unlock()
+					}
+					return err
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if !skipUpload {
+					if err := o.recordSnapshot(ctx, s3c, lockfile, channel, gen); err != nil {
+						return err
+					}
+				}
+				generated[name] = gen
+				return nil
+			}()
+			if err != nil {
+				o.log.WithError(err).WithField("snapshot", name).Error("Failed to generate snapshot")
+
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	results := make([]*generatedSnapshot, 0, len(generated))
+	for _, name := range targets {
+		if gen, ok := generated[name]; ok {
+			results = append(results, gen)
+		}
+	}
+	if err := writeGenerateReport(os.Stdout, results); err != nil {
+		return err
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	failures := make([]string, 0, len(errs))
+	for _, name := range targets {
+		if err, ok := errs[name]; ok {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	return fmt.Errorf("failed to generate %d of %d snapshot target(s):\n%s",
+		len(failures), len(targets), strings.Join(failures, "\n"))
+}
+
+// runGenerateProcess generates a single target in a new devenv process,
+// using dir for the kubeconfig and devenv configuration of its cluster.
+func (o *Options) runGenerateProcess(ctx context.Context, dir string, out io.Writer, name string,
+	channel box.SnapshotLockChannel, baseDigest string, skipUpload bool) (*generatedSnapshot, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary directory")
+	}
+
+	resultPath := filepath.Join(dir, "result.json")
+	args := []string{"--skip-update", "snapshot", "generate", "--target", name,
+		"--channel", string(channel), "--result-output", resultPath}
+	if o.Chunked {
+		args = append(args, "--chunked")
+	}
+	if skipUpload {
+		args = append(args, "--skip-upload")
+	}
+	if baseDigest != "" {
+		args = append(args, "--base-digest", baseDigest)
+	}
+
+	cmd := exec.Command(os.Args[0], args...) //nolint:gosec // Why: We're running ourself
+	cmd.Env = append(os.Environ(),
+		kubernetesruntime.KindClusterNameEnvVar+"="+generateClusterName(name),
+		kube.KubeConfigEnvVar+"="+filepath.Join(dir, "kubeconfig.yaml"),
+		config.ConfigDirEnvVar+"="+filepath.Join(dir, "config"),
+	)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	o.log.WithField("snapshot", name).WithField("cluster", generateClusterName(name)).Info("Starting snapshot generation")
+	runErr := runInterruptible(ctx, cmd)
+
+	// Failed targets write a partial result if they got far enough
+	// to deploy applications
+	var gen *generatedSnapshot
+	b, err := os.ReadFile(resultPath)
+	if err == nil {
+		err = json.Unmarshal(b, &gen)
+	}
+	if runErr != nil {
+		if err != nil {
+			gen = nil
+		}
+		return gen, errors.Wrap(runErr, "failed to generate snapshot")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read generation result")
+	}
+
+	o.log.WithField("snapshot", name).WithField("digest", gen.Item.Digest).
+		Infof("Generated snapshot in %s", gen.Duration.Round(time.Second))
+	return gen, nil
+}
+
+// runInterruptible runs cmd, interrupting it instead of killing it when ctx
+// is canceled, so that it destroys its cluster before exiting.
+func runInterruptible(ctx context.Context, cmd *exec.Cmd) error {
+	// Run it in its own process group so ^C only reaches it through ctx,
+	// since a second interrupt kills it without cleaning up
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Signal(os.Interrupt) //nolint:errcheck // Why: Best effort
+		case <-done:
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// deployApps deploys applications into the developer environment in order.
+// Every application is deployed even if deploying one of them fails, the
+// failures are returned together.
+func (o *Options) deployApps(ctx context.Context, rc kubernetesruntime.RuntimeConfig,
+	names []string) ([]appDeployment, error) {
+	// Like 'devenv apps deploy', devspace is only used if it's been opted into
+	useDevspace, _ := strconv.ParseBool(os.Getenv("DEVENV_DEPLOY_USE_DEVSPACE")) //nolint:errcheck // Why: Defaults to false
+
+	results := make([]appDeployment, 0, len(names))
+	failures := make([]string, 0)
+	for _, name := range names {
+		log := o.log.WithField("application", name)
+		log.Info("Deploying application")
+
+		started := time.Now()
+		err := app.Deploy(ctx, log, o.k, o.b, o.r, name, rc, app.DeploymentOptions{UseDevspace: useDevspace})
+		result := appDeployment{App: name, Duration: time.Since(started)}
+		if err != nil {
+			if ctx.Err() != nil {
+				return append(results, result), ctx.Err()
+			}
+
+			log.WithError(err).Error("Failed to deploy application")
+			result.Error = err.Error()
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		} else {
+			log.Infof("Deployed application in %s", result.Duration.Round(time.Second))
+		}
+		results = append(results, result)
+	}
+
+	if len(failures) != 0 {
+		return results, fmt.Errorf("failed to deploy %d of %d application(s):\n%s",
+			len(failures), len(names), strings.Join(failures, "\n"))
+	}
+	return results, nil
+}
+
+// writeGenerateReport writes the applications, and their versions,
+// in every generated snapshot, along with how long they took to deploy
+func writeGenerateReport(w io.Writer, generated []*generatedSnapshot) error {
+	if len(generated) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 10, 0, 5, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tDIGEST\tDURATION\tAPP\tVERSION\tDEPLOY DURATION")
+	for _, gen := range generated {
+		// Deployments are keyed by the name of the app, without the version
+		deployed := make(map[string]time.Duration)
+		for _, d := range gen.Deployments {
+			deployed[strings.SplitN(d.App, "@", 2)[0]] = d.Duration
+		}
+
+		// Failed snapshots only have the applications deployed before
+		// they failed, without their versions
+		if gen.Item == nil {
+			writeFailedDeployments(tw, gen)
+			continue
+		}
+
+		target := []interface{}{gen.Target, gen.Item.Digest, gen.Duration.Round(time.Second)}
+		if len(gen.Apps) == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t-\t-\t-\n", target...)
+		}
+
+		for i, a := range gen.Apps {
+			// Only show the target on the first line of its applications
+			if i != 0 {
+				target = []interface{}{"", "", ""}
+			}
+
+			duration := "-"
+			if d, ok := deployed[a.Name]; ok {
+				duration = d.Round(time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", append(target, a.Name, a.Version, duration)...)
+		}
+	}
+	return tw.Flush()
+}
+
+// writeFailedDeployments writes the applications deployed by a snapshot
+// that failed to generate into a generate report
+func writeFailedDeployments(w io.Writer, gen *generatedSnapshot) {
+	target := []interface{}{gen.Target, "FAILED", gen.Duration.Round(time.Second)}
+	if len(gen.Deployments) == 0 {
+		fmt.Fprintf(w, "%s\t%s\t%s\t-\t-\t-\n", target...)
+	}
+
+	for i, d := range gen.Deployments {
+		if i != 0 {
+			target = []interface{}{"", "", ""}
+		}
+
+		duration := d.Duration.Round(time.Second).String()
+		if d.Error != "" {
+			duration += " (failed)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t-\t%s\n", append(target, d.App, duration)...)
+	}
+}
+
+// prefixWriter writes every line written to it to w, prefixed with prefix,
+// so that the output of processes running at once can be told apart.
+type prefixWriter struct {
+	// mu is shared by every writer of w
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+
+	// buf is the last, incomplete, line written
+	buf []byte
+}
+
+// Write implements io.Writer
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes the last line if it's incomplete
+func (p *prefixWriter) Flush() {
+	if len(p.buf) != 0 {
+		p.writeLine(append(p.buf, '\n')) //nolint:errcheck // Why: Best effort
+		p.buf = nil
+	}
+}
+
+// writeLine writes a prefixed line to w
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+	return err
+}
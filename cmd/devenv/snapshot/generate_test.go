@@ -0,0 +1,144 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getoutreach/devenv/internal/apps"
+	"github.com/getoutreach/gobox/pkg/box"
+	"gotest.tools/v3/assert"
+)
+
+const testGenerateConfig = `
+targets:
+  base:
+    post_restore: base.yaml
+  flagship:
+    base_target: base
+    deploy_apps: [flagship]
+  flagship-e2e:
+    base_target: flagship
+    post_restore: e2e.yaml
+`
+
+func TestParseGenerateConfig(t *testing.T) {
+	s, err := parseGenerateConfig([]byte(testGenerateConfig))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s.Bases, map[string]string{"flagship": "base", "flagship-e2e": "flagship"})
+
+	// Derived targets inherit post-restore manifests
+	assert.Equal(t, s.Targets["flagship"].PostRestore, "base.yaml")
+	assert.Equal(t, s.Targets["flagship-e2e"].PostRestore, "e2e.yaml")
+	assert.DeepEqual(t, s.Targets["flagship"].DeployApps, []string{"flagship"})
+
+	order, err := s.generationOrder(nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, order, []string{"base", "flagship", "flagship-e2e"})
+
+	// Bases that aren't selected aren't generated
+	order, err = s.generationOrder([]string{"flagship-e2e", "base"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, order, []string{"base", "flagship-e2e"})
+
+	_, err = s.generationOrder([]string{"missing"})
+	assert.ErrorContains(t, err, "unknown snapshot target 'missing'")
+
+	_, err = parseGenerateConfig([]byte("targets:\n  a:\n    base_target: missing\n"))
+	assert.ErrorContains(t, err, "derived from unknown target 'missing'")
+
+	_, err = parseGenerateConfig([]byte("targets:\n  a:\n    base_target: b\n  b:\n    base_target: a\n"))
+	assert.ErrorContains(t, err, "is derived from itself")
+}
+
+func TestFindBaseSnapshot(t *testing.T) {
+	lockfile := newTestLockfile()
+
+	itm, err := findBaseSnapshot(lockfile, "base", "rc", "")
+	assert.NilError(t, err)
+	assert.Equal(t, itm.Digest, "3")
+
+	itm, err = findBaseSnapshot(lockfile, "base", "rc", "2")
+	assert.NilError(t, err)
+	assert.Equal(t, itm.Digest, "2")
+
+	_, err = findBaseSnapshot(lockfile, "base", "stable", "2")
+	assert.ErrorContains(t, err, "found with digest '2'")
+
+	_, err = findBaseSnapshot(lockfile, "other", "rc", "")
+	assert.ErrorContains(t, err, "generate it first")
+}
+
+func TestGenerateClusterName(t *testing.T) {
+	assert.Equal(t, generateClusterName("Flagship_E2E"), "devenv-snapshot-flagship-e2e")
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &prefixWriter{mu: &sync.Mutex{}, w: &buf, prefix: "[base] "}
+
+	_, err := w.Write([]byte("hello\nwor"))
+	assert.NilError(t, err)
+	_, err = w.Write([]byte("ld\nlast"))
+	assert.NilError(t, err)
+	w.Flush()
+
+	assert.Equal(t, buf.String(), "[base] hello\n[base] world\n[base] last\n")
+}
+
+func TestWriteGenerateReport(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeGenerateReport(&buf, []*generatedSnapshot{
+		{
+			Target:      "base",
+			Item:        &box.SnapshotLockListItem{Digest: "abc"},
+			Deployments: []appDeployment{{App: "flagship@v1.0.0", Duration: 2 * time.Minute}},
+			Apps:        []apps.App{{Name: "flagship", Version: "v1.0.0"}, {Name: "resourcer", Version: "v0.1.0"}},
+			Duration:    10 * time.Minute,
+		},
+		{
+			Target: "flagship",
+			Deployments: []appDeployment{
+				{App: "flagship", Duration: time.Minute},
+				{App: "outreach-accounts", Duration: 3 * time.Minute, Error: "timed out"},
+			},
+			Duration: 5 * time.Minute,
+			Error:    "failed to deploy 1 of 2 application(s)",
+		},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), ""+
+		"TARGET       DIGEST     DURATION     APP                   VERSION     DEPLOY DURATION\n"+
+		"base         abc        10m0s        flagship              v1.0.0      2m0s\n"+
+		"                                     resourcer             v0.1.0      -\n"+
+		"flagship     FAILED     5m0s         flagship              -           1m0s\n"+
+		"                                     outreach-accounts     -           3m0s (failed)\n")
+}
+
+func TestRunInterruptible(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dir := t.TempDir()
+
+	// The child cleans up when it's interrupted, rather than being killed
+	cmd := exec.Command("sh", "-c", `trap 'touch cleaned-up; exit 1' INT; touch started; while true; do sleep 0.1; done`)
+	cmd.Dir = dir
+
+	go func() {
+		for {
+			if _, err := os.Stat(filepath.Join(dir, "started")); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	assert.ErrorContains(t, runInterruptible(ctx, cmd), "exit status 1")
+	_, err := os.Stat(filepath.Join(dir, "cleaned-up"))
+	assert.NilError(t, err)
+}
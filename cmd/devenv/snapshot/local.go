@@ -0,0 +1,503 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/getoutreach/devenv/cmd/devenv/provision"
+	noncmdsnapshot "github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	"github.com/pkg/errors"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	"github.com/vmware-tanzu/velero/pkg/util/boolptr"
+	"golang.org/x/term"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// localSnapshotLabel is the label on velero backups created
+	// by `devenv snapshot create`
+	localSnapshotLabel = "devenv.outreach.io/local-snapshot"
+
+	// namespacesAnnotation is the annotation on a local snapshot containing
+	// the namespaces that were included in it
+	namespacesAnnotation = "devenv.outreach.io/namespaces"
+
+	// defaultBackupStorageLocation is the velero backup storage location
+	// that stores backups in the in-cluster minio
+	defaultBackupStorageLocation = "default"
+)
+
+// protectedNamespaces are namespaces that can't be deleted, so
+// they're never deleted before a local snapshot is restored.
+var protectedNamespaces = []string{ //nolint:gochecknoglobals // Why: This is a constant list
+	metav1.NamespaceDefault,
+	metav1.NamespaceSystem,
+	metav1.NamespacePublic,
+	"kube-node-lease",
+}
+
+// LocalSnapshot is a personal snapshot of a developer environment, stored
+// in the in-cluster minio.
+type LocalSnapshot struct {
+	// Name is the name of the snapshot
+	Name string `json:"name"`
+
+	// Status is the status of the snapshot, e.g. Completed
+	Status string `json:"status"`
+
+	// Size is the size, in bytes, of the volume data in the snapshot
+	Size int64 `json:"size"`
+
+	// CreatedAt is when the snapshot was created
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Namespaces are the namespaces included in the snapshot
+	Namespaces []string `json:"namespaces"`
+}
+
+// ensureRunning returns an error if the developer environment isn't running
+func (o *Options) ensureRunning(ctx context.Context) (kubernetesruntime.Runtime, error) {
+	conf, err := config.LoadConfig(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load config")
+	}
+
+	kr, err := devenvutil.EnsureDevenvRunning(ctx, conf, o.b)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.k == nil || o.vc == nil {
+		return nil, fmt.Errorf("failed to create kubernetes client")
+	}
+
+	return kr, nil
+}
+
+// ensureSnapshotInfrastructure ensures that the developer environment is running
+// and that velero is able to store backups in the in-cluster minio, deploying
+// them if they were removed after provisioning from a snapshot.
+func (o *Options) ensureSnapshotInfrastructure(ctx context.Context) error {
+	kr, err := o.ensureRunning(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.k.AppsV1().Deployments(noncmdsnapshot.SnapshotNamespace).Get(ctx, "velero", metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		err = o.deploySnapshotInfrastructure(ctx, kr)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to ensure velero is running")
+	}
+
+	o.log.Info("Waiting for snapshot storage to be available")
+	return devenvutil.Backoff(ctx, 5*time.Second, 24, func() error {
+		bsl, err := o.vc.VeleroV1().BackupStorageLocations(noncmdsnapshot.SnapshotNamespace).
+			Get(ctx, defaultBackupStorageLocation, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if bsl.Status.Phase != velerov1api.BackupStorageLocationPhaseAvailable {
+			return fmt.Errorf("backup storage location is %s", bsl.Status.Phase)
+		}
+		return nil
+	}, o.log)
+}
+
+// deploySnapshotInfrastructure deploys velero and minio into the developer environment
+func (o *Options) deploySnapshotInfrastructure(ctx context.Context, kr kubernetesruntime.Runtime) error {
+	o.log.Info("Deploying snapshot infrastructure (this may take awhile...)")
+
+	popts, err := provision.NewOptions(o.log, o.b)
+	if err != nil {
+		return errors.Wrap(err, "failed to create options for provision")
+	}
+	popts.KubernetesRuntime = kr
+
+	return popts.DeploySnapshotInfrastructure(ctx)
+}
+
+// getLocalSnapshot returns the velero backup of a local snapshot
+func (o *Options) getLocalSnapshot(ctx context.Context, name string) (*velerov1api.Backup, error) {
+	backup, err := o.vc.VeleroV1().Backups(noncmdsnapshot.SnapshotNamespace).Get(ctx, name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, fmt.Errorf("snapshot %q not found, see 'devenv snapshot list'", name)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to get snapshot %q", name)
+	}
+
+	if backup.Labels[localSnapshotLabel] != "true" {
+		return nil, fmt.Errorf("%q is not a snapshot created by 'devenv snapshot create'", name)
+	}
+
+	return backup, nil
+}
+
+// backupNamespaces returns the namespaces included in a local snapshot
+func backupNamespaces(backup *velerov1api.Backup) []string {
+	ns := backup.Annotations[namespacesAnnotation]
+	if ns == "" {
+		return []string{}
+	}
+	return strings.Split(ns, ",")
+}
+
+// snapshotNamespaces returns the namespaces to include in a local snapshot, if
+// include is empty this is every namespace except the snapshot infrastructure.
+func (o *Options) snapshotNamespaces(ctx context.Context, include []string) ([]string, error) {
+	if len(include) != 0 {
+		for _, ns := range include {
+			if _, err := o.k.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{}); err != nil {
+				return nil, errors.Wrapf(err, "failed to get namespace %q", ns)
+			}
+		}
+		return include, nil
+	}
+
+	nsList, err := o.k.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list namespaces")
+	}
+
+	namespaces := make([]string, 0, len(nsList.Items))
+	for i := range nsList.Items {
+		ns := nsList.Items[i].Name
+		if ns == noncmdsnapshot.SnapshotNamespace || ns == "minio" {
+			continue
+		}
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// CreateLocal creates a local snapshot of the developer environment. If name is
+// empty, the current time is used. If namespaces is empty, every namespace is
+// included.
+func (o *Options) CreateLocal(ctx context.Context, name string, namespaces []string) error {
+	if name == "" {
+		name = newBackupName()
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+		return fmt.Errorf("invalid snapshot name %q: %s", name, strings.Join(errs, ", "))
+	}
+
+	skip := unrestoredNamespaces()
+	for _, ns := range namespaces {
+		if skip[ns] {
+			return fmt.Errorf("namespace %q can't be restored from a snapshot, so it can't be included in one", ns)
+		}
+	}
+
+	if err := o.ensureSnapshotInfrastructure(ctx); err != nil {
+		return err
+	}
+
+	_, err := o.vc.VeleroV1().Backups(noncmdsnapshot.SnapshotNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return fmt.Errorf("snapshot %q already exists", name)
+	} else if !kerrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to check if snapshot %q exists", name)
+	}
+
+	includedNamespaces, err := o.snapshotNamespaces(ctx, namespaces)
+	if err != nil {
+		return err
+	}
+
+	spec := velerov1api.BackupSpec{
+		StorageLocation: defaultBackupStorageLocation,
+		// Skip helm chart resources, since they've already been rendered
+		ExcludedResources:      []string{"HelmChart"},
+		SnapshotVolumes:        boolptr.True(),
+		DefaultVolumesToRestic: boolptr.True(),
+	}
+	if len(namespaces) != 0 {
+		// Only cluster resources related to the namespaces are included
+		spec.IncludedNamespaces = includedNamespaces
+	} else {
+		// Don't include the snapshot infrastructure, it's deployed before restoring
+		spec.ExcludedNamespaces = []string{noncmdsnapshot.SnapshotNamespace, "minio"}
+		spec.IncludeClusterResources = boolptr.True()
+	}
+
+	o.log.WithField("snapshot", name).Info("Creating snapshot")
+	backup, err := o.createBackup(ctx, &velerov1api.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{localSnapshotLabel: "true"},
+			Annotations: map[string]string{namespacesAnnotation: strings.Join(includedNamespaces, ",")},
+		},
+		Spec: spec,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot")
+	}
+
+	if backup.Status.Phase != velerov1api.BackupPhaseCompleted {
+		msg := fmt.Sprintf("snapshot %q finished with status %s", name, backup.Status.Phase)
+		if len(backup.Status.ValidationErrors) != 0 {
+			msg += ": " + strings.Join(backup.Status.ValidationErrors, ", ")
+		}
+		return fmt.Errorf("%s, see the logs of the velero deployment in the velero namespace", msg)
+	}
+
+	o.log.Infof("Created snapshot %q, restore it with 'devenv snapshot restore %s'", name, name)
+	return nil
+}
+
+// ListLocal returns the local snapshots in the developer environment, newest first
+func (o *Options) ListLocal(ctx context.Context) ([]LocalSnapshot, error) {
+	backups, err := o.vc.VeleroV1().Backups(noncmdsnapshot.SnapshotNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: localSnapshotLabel + "=true",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list snapshots")
+	}
+
+	pvbs, err := o.vc.VeleroV1().PodVolumeBackups(noncmdsnapshot.SnapshotNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list snapshot volumes")
+	}
+
+	sizes := make(map[string]int64)
+	for i := range pvbs.Items {
+		sizes[pvbs.Items[i].Labels[velerov1api.BackupNameLabel]] += pvbs.Items[i].Status.Progress.TotalBytes
+	}
+
+	snapshots := make([]LocalSnapshot, 0, len(backups.Items))
+	for i := range backups.Items {
+		b := &backups.Items[i]
+
+		snapshots = append(snapshots, LocalSnapshot{
+			Name:       b.Name,
+			Status:     string(b.Status.Phase),
+			Size:       sizes[b.Name],
+			CreatedAt:  b.CreationTimestamp.Time,
+			Namespaces: backupNamespaces(b),
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+
+	return snapshots, nil
+}
+
+// writeLocalSnapshots writes local snapshots in the provided format, table or json
+func writeLocalSnapshots(w io.Writer, snapshots []LocalSnapshot, format string) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(snapshots)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSTATUS\tSIZE\tAGE")
+		for i := range snapshots {
+			s := &snapshots[i]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.Status,
+				humanize.IBytes(uint64(s.Size)), duration.HumanDuration(time.Since(s.CreatedAt)))
+		}
+		return tw.Flush()
+	}
+
+	return fmt.Errorf("invalid format %s", format)
+}
+
+// unrestoredNamespaces returns the namespaces that are never replaced when a
+// snapshot is restored, they're either deployed before restoring or can't be deleted.
+func unrestoredNamespaces() map[string]bool {
+	skip := make(map[string]bool)
+	for _, ns := range append(append([]string{}, noncmdsnapshot.RestoreExcludedNamespaces...), protectedNamespaces...) {
+		skip[ns] = true
+	}
+	return skip
+}
+
+// namespacesToReplace returns the namespaces of a snapshot that are deleted
+// before restoring it, velero doesn't replace resources that already exist.
+func namespacesToReplace(namespaces []string) []string {
+	skip := unrestoredNamespaces()
+
+	replace := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if !skip[ns] {
+			replace = append(replace, ns)
+		}
+	}
+
+	return replace
+}
+
+// confirmReplace asks the user to confirm that the namespaces being
+// replaced by a restore can be deleted, unless force is set.
+func (o *Options) confirmReplace(ctx context.Context, namespaces []string, force bool) error {
+	if force || len(namespaces) == 0 {
+		return nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("restoring this snapshot deletes the namespaces %s, pass --force to restore it non-interactively",
+			strings.Join(namespaces, ", "))
+	}
+
+	fmt.Printf("Restoring this snapshot deletes, and then restores, the following namespaces:\n  %s\n",
+		strings.Join(namespaces, "\n  "))
+	fmt.Println("Any changes made to them since the snapshot was created will be lost. Continue?")
+	ok, err := cmdutil.GetYesOrNoInput(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get confirmation")
+	}
+	if !ok {
+		return fmt.Errorf("restore cancelled")
+	}
+
+	return nil
+}
+
+// deleteNamespaces deletes namespaces and waits for them to be removed
+func (o *Options) deleteNamespaces(ctx context.Context, namespaces []string) error {
+	for _, ns := range namespaces {
+		o.log.WithField("namespace", ns).Info("Deleting namespace")
+		err := o.k.CoreV1().Namespaces().Delete(ctx, ns, metav1.DeleteOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete namespace %q", ns)
+		}
+	}
+
+	o.log.Info("Waiting for namespaces to be deleted")
+	return devenvutil.Backoff(ctx, 5*time.Second, 60, func() error {
+		for _, ns := range namespaces {
+			_, err := o.k.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+			if err == nil {
+				return fmt.Errorf("namespace %q is still being deleted", ns)
+			} else if !kerrors.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// RestoreLocal restores a local snapshot into the developer environment. The
+// namespaces in the snapshot are replaced with their state in the snapshot,
+// the user is asked to confirm this unless force is set.
+func (o *Options) RestoreLocal(ctx context.Context, name string, force bool) error {
+	if err := o.ensureSnapshotInfrastructure(ctx); err != nil {
+		return err
+	}
+
+	backup, err := o.getLocalSnapshot(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if backup.Status.Phase != velerov1api.BackupPhaseCompleted {
+		return fmt.Errorf("snapshot %q has status %s, only completed snapshots can be restored", name, backup.Status.Phase)
+	}
+
+	// Snapshots of specific namespaces that are never restored, e.g. ones
+	// created before they were refused, would otherwise silently do nothing
+	if len(backup.Spec.IncludedNamespaces) != 0 {
+		skip := unrestoredNamespaces()
+		for _, ns := range backupNamespaces(backup) {
+			if skip[ns] {
+				o.log.WithField("namespace", ns).Warn("Namespace is in the snapshot, but can't be restored, skipping it")
+			}
+		}
+	}
+
+	namespaces := namespacesToReplace(backupNamespaces(backup))
+	if err := o.confirmReplace(ctx, namespaces, force); err != nil {
+		return err
+	}
+
+	o.log.WithField("namespaces", namespaces).Warn("Replacing namespaces with their state in the snapshot")
+	if err := o.deleteNamespaces(ctx, namespaces); err != nil {
+		return err
+	}
+
+	m, err := noncmdsnapshot.NewManager(o.log, o.b)
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot client")
+	}
+
+	o.log.WithField("snapshot", name).Info("Starting snapshot restore (this may take awhile...)")
+	if err := m.Restore(ctx, name); err != nil {
+		return errors.Wrap(err, "failed to restore snapshot")
+	}
+
+	return devenvutil.WaitForAllPodsToBeReady(ctx, o.k, o.log)
+}
+
+// DeleteLocal deletes a local snapshot, including its data in the in-cluster minio
+func (o *Options) DeleteLocal(ctx context.Context, name string) error {
+	if err := o.ensureSnapshotInfrastructure(ctx); err != nil {
+		return err
+	}
+
+	backup, err := o.getLocalSnapshot(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// Deleting the backup object directly would leave its data behind, and
+	// velero would sync it back from storage.
+	_, err = o.vc.VeleroV1().DeleteBackupRequests(noncmdsnapshot.SnapshotNamespace).Create(ctx, &velerov1api.DeleteBackupRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: name + "-",
+			Labels: map[string]string{
+				velerov1api.BackupNameLabel: label.GetValidName(name),
+				velerov1api.BackupUIDLabel:  string(backup.UID),
+			},
+		},
+		Spec: velerov1api.DeleteBackupRequestSpec{
+			BackupName: name,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to request snapshot deletion")
+	}
+
+	o.log.WithField("snapshot", name).Info("Waiting for snapshot to be deleted")
+	err = devenvutil.Backoff(ctx, 2*time.Second, 60, func() error {
+		_, err := o.vc.VeleroV1().Backups(noncmdsnapshot.SnapshotNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			return fmt.Errorf("snapshot %q is still being deleted", name)
+		} else if !kerrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for snapshot %q to be deleted", name)
+	}
+
+	if backup.Spec.StorageLocation == importStorageLocation(name) {
+		if err := o.removeImport(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	o.log.WithField("snapshot", name).Info("Deleted snapshot")
+	return nil
+}
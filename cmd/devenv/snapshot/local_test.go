@@ -0,0 +1,95 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListLocal(t *testing.T) {
+	now := time.Now()
+	backup := func(name string, created time.Time, local bool) *velerov1api.Backup {
+		b := &velerov1api.Backup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "velero",
+				CreationTimestamp: metav1.NewTime(created),
+				Annotations:       map[string]string{namespacesAnnotation: "devenv,my-database"},
+			},
+			Status: velerov1api.BackupStatus{Phase: velerov1api.BackupPhaseCompleted},
+		}
+		if local {
+			b.Labels = map[string]string{localSnapshotLabel: "true"}
+		}
+		return b
+	}
+	pvb := func(name, backupName string, size int64) *velerov1api.PodVolumeBackup {
+		return &velerov1api.PodVolumeBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "velero",
+				Labels:    map[string]string{velerov1api.BackupNameLabel: backupName},
+			},
+			Status: velerov1api.PodVolumeBackupStatus{
+				Progress: velerov1api.PodVolumeOperationProgress{TotalBytes: size},
+			},
+		}
+	}
+
+	o := &Options{
+		log: logrus.New(),
+		vc: velerofake.NewSimpleClientset(
+			backup("older", now.Add(-3*time.Hour), true),
+			backup("newer", now.Add(-time.Minute), true),
+			backup("generated", now, false),
+			pvb("older-1", "older", 1024),
+			pvb("older-2", "older", 2048),
+			pvb("generated-1", "generated", 4096),
+		),
+	}
+
+	snapshots, err := o.ListLocal(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(snapshots), 2)
+	assert.Equal(t, snapshots[0].Name, "newer")
+	assert.Equal(t, snapshots[0].Size, int64(0))
+	assert.Equal(t, snapshots[1].Name, "older")
+	assert.Equal(t, snapshots[1].Size, int64(3072))
+	assert.DeepEqual(t, snapshots[1].Namespaces, []string{"devenv", "my-database"})
+
+	var buf bytes.Buffer
+	assert.NilError(t, writeLocalSnapshots(&buf, snapshots, "table"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, len(lines), 3)
+	assert.Assert(t, strings.Contains(lines[2], "3.0 KiB"), lines[2])
+	assert.Assert(t, strings.Contains(lines[2], "3h"), lines[2])
+}
+
+func TestNamespacesToReplace(t *testing.T) {
+	assert.DeepEqual(t,
+		namespacesToReplace([]string{"default", "kube-system", "minio", "devenv", "my-database"}),
+		[]string{"devenv", "my-database"},
+	)
+}
+
+func TestCreateLocalRefusesUnrestoredNamespaces(t *testing.T) {
+	o := &Options{log: logrus.New()}
+	for _, ns := range []string{"default", "kube-system", "minio"} {
+		err := o.CreateLocal(context.Background(), "snapshot", []string{"devenv", ns})
+		assert.ErrorContains(t, err, "can't be restored from a snapshot")
+	}
+}
+
+func TestConfirmReplace(t *testing.T) {
+	o := &Options{log: logrus.New()}
+	assert.NilError(t, o.confirmReplace(context.Background(), []string{"devenv"}, true))
+	assert.NilError(t, o.confirmReplace(context.Background(), []string{}, false))
+}
@@ -0,0 +1,594 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/dustin/go-humanize"
+	"github.com/getoutreach/devenv/internal/apps"
+	noncmdsnapshot "github.com/getoutreach/devenv/internal/snapshot"
+	devenvaws "github.com/getoutreach/devenv/pkg/aws"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+const (
+	// lockfileKey is the key of the lockfile of generated snapshots
+	lockfileKey = "automated-snapshots/v2/latest.yaml"
+
+	// chunkGracePeriod is how old an unreferenced chunk has to be before
+	// it's pruned, so chunks uploaded by a snapshot that is still being
+	// generated aren't removed before it's added to the lockfile.
+	chunkGracePeriod = 24 * time.Hour
+)
+
+// RemoteSnapshot is a generated snapshot in the lockfile
+type RemoteSnapshot struct {
+	// Target is the name of the snapshot target
+	Target string `json:"target"`
+
+	// Channel is the channel the snapshot is in
+	Channel box.SnapshotLockChannel `json:"channel"`
+
+	// Index is the position of the snapshot in its channel, 0 is the
+	// latest. It's what 'devenv provision --snapshot-age' takes.
+	Index int `json:"index"`
+
+	// Digest is the digest of the snapshot
+	Digest string `json:"digest"`
+
+	// URI is the key of the snapshot in the snapshot bucket
+	URI string `json:"uri"`
+
+	// Size is the size, in bytes, of the snapshot. For chunked
+	// snapshots this is the size before deduplication.
+	Size int64 `json:"size"`
+
+	// CreatedAt is when the snapshot was generated
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Apps are the applications, and their versions, in the snapshot
+	Apps []apps.App `json:"apps,omitempty"`
+}
+
+// lockfileItem is a snapshot as it's stored in the lockfile, box doesn't know
+// about the applications in a snapshot so they're stored alongside it.
+type lockfileItem struct {
+	box.SnapshotLockListItem `yaml:",inline"`
+
+	// Apps are the applications, and their versions, in the snapshot
+	Apps []apps.App `yaml:"apps,omitempty"`
+}
+
+// lockfileList is a box.SnapshotLockList as it's stored in the lockfile
+type lockfileList struct {
+	Snapshots map[box.SnapshotLockChannel][]*lockfileItem `yaml:"snapshots"`
+}
+
+// lockfileContents is a box.SnapshotLock as it's stored in the lockfile
+type lockfileContents struct {
+	Version     int                                `yaml:"version"`
+	GeneratedAt time.Time                          `yaml:"generatedAt"`
+	Targets     map[string]*box.SnapshotLockTarget `yaml:"targets"`
+	TargetsV2   map[string]*lockfileList           `yaml:"targets_v2"`
+}
+
+// decodeLockfile parses a lockfile, returning the applications
+// in every snapshot by the URI of the snapshot.
+func decodeLockfile(b []byte) (*box.SnapshotLock, map[string][]apps.App, error) {
+	var contents lockfileContents
+	if err := yaml.Unmarshal(b, &contents); err != nil {
+		return nil, nil, err
+	}
+
+	lockfile := &box.SnapshotLock{
+		Version:     contents.Version,
+		GeneratedAt: contents.GeneratedAt,
+		Targets:     contents.Targets,
+	}
+	snapshotApps := make(map[string][]apps.App)
+	for name, t := range contents.TargetsV2 {
+		if lockfile.TargetsV2 == nil {
+			lockfile.TargetsV2 = make(map[string]*box.SnapshotLockList)
+		}
+
+		list := &box.SnapshotLockList{}
+		if t != nil && t.Snapshots != nil {
+			list.Snapshots = make(map[box.SnapshotLockChannel][]*box.SnapshotLockListItem)
+			for c, items := range t.Snapshots {
+				list.Snapshots[c] = make([]*box.SnapshotLockListItem, 0, len(items))
+				for _, itm := range items {
+					list.Snapshots[c] = append(list.Snapshots[c], &itm.SnapshotLockListItem)
+					if len(itm.Apps) != 0 {
+						snapshotApps[itm.URI] = itm.Apps
+					}
+				}
+			}
+		}
+		lockfile.TargetsV2[name] = list
+	}
+
+	return lockfile, snapshotApps, nil
+}
+
+// encodeLockfile serializes a lockfile, storing the applications
+// in every snapshot alongside it.
+func encodeLockfile(lockfile *box.SnapshotLock, snapshotApps map[string][]apps.App) ([]byte, error) {
+	contents := lockfileContents{
+		Version:     lockfile.Version,
+		GeneratedAt: lockfile.GeneratedAt,
+		Targets:     lockfile.Targets,
+	}
+	for name, t := range lockfile.TargetsV2 {
+		if contents.TargetsV2 == nil {
+			contents.TargetsV2 = make(map[string]*lockfileList)
+		}
+
+		list := &lockfileList{}
+		if t != nil && t.Snapshots != nil {
+			list.Snapshots = make(map[box.SnapshotLockChannel][]*lockfileItem)
+			for c, items := range t.Snapshots {
+				list.Snapshots[c] = make([]*lockfileItem, 0, len(items))
+				for _, itm := range items {
+					list.Snapshots[c] = append(list.Snapshots[c], &lockfileItem{
+						SnapshotLockListItem: *itm,
+						Apps:                 snapshotApps[itm.URI],
+					})
+				}
+			}
+		}
+		contents.TargetsV2[name] = list
+	}
+
+	return yaml.Marshal(contents)
+}
+
+// newS3Client creates a client for the snapshot bucket, ensuring
+// there are valid credentials for role first.
+func (o *Options) newS3Client(ctx context.Context, role string) (*s3.Client, error) {
+	copts := devenvaws.DefaultCredentialOptions()
+	if role != "" {
+		copts.Role = role
+	}
+	copts.Log = o.log
+	if err := devenvaws.EnsureValidCredentials(ctx, copts); err != nil {
+		return nil, errors.Wrap(err, "failed to get necessary permissions")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(o.b.DeveloperEnvironmentConfig.SnapshotConfig.Region))
+	if err != nil {
+		return nil, err
+	}
+
+	// use a custom endpoint if provided
+	endpoint := o.b.DeveloperEnvironmentConfig.SnapshotConfig.Endpoint
+	if endpoint != "" {
+		cfg.EndpointResolver = &awsEndpointResolver{ //nolint:staticcheck // Why: using new one doesn't work?
+			endpoint: endpoint,
+			region:   cfg.Region,
+		}
+	}
+	o.log.WithField("region", cfg.Region).WithField("endpoint", endpoint).Info("s3 config")
+
+	return s3.NewFromConfig(cfg), nil
+}
+
+// getLockfile fetches the lockfile of generated snapshots. If allowMissing
+// is set, an empty lockfile is returned when it can't be fetched.
+func (o *Options) getLockfile(ctx context.Context, s3c *s3.Client, allowMissing bool) (*box.SnapshotLock, error) {
+	lockfile := &box.SnapshotLock{}
+	resp, err := s3c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
+		Key:    aws.String(lockfileKey),
+	})
+	if err != nil {
+		if !allowMissing {
+			return nil, errors.Wrap(err, "failed to fetch remote snapshot lockfile")
+		}
+
+		o.log.WithError(err).
+			Warn("Failed to fetch existing remote snapshot lockfile, will generate a new one")
+		o.snapshotApps = make(map[string][]apps.App)
+		return lockfile, nil
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read remote snapshot lockfile")
+	}
+
+	lockfile, o.snapshotApps, err = decodeLockfile(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse remote snapshot lockfile")
+	}
+
+	return lockfile, nil
+}
+
+// putLockfile uploads the lockfile of generated snapshots
+func (o *Options) putLockfile(ctx context.Context, s3c *s3.Client, lockfile *box.SnapshotLock) error {
+	lockfile.GeneratedAt = time.Now().UTC()
+
+	byt, err := encodeLockfile(lockfile, o.snapshotApps)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
+		Key:    aws.String(lockfileKey),
+		Body:   bytes.NewReader(byt),
+	})
+	return errors.Wrap(err, "failed to upload remote snapshot lockfile")
+}
+
+// promoteSnapshot makes a snapshot in the from channel of a target the latest
+// snapshot in the to channel. The latest snapshot in the from channel is used
+// if digest is empty. Returns false if the snapshot is already the latest.
+func promoteSnapshot(lockfile *box.SnapshotLock, target string,
+	from, to box.SnapshotLockChannel, digest string) (*box.SnapshotLockListItem, bool, error) {
+	t, ok := lockfile.TargetsV2[target]
+	if !ok || t.Snapshots == nil {
+		return nil, false, fmt.Errorf("unknown snapshot target '%s'", target)
+	}
+
+	var itm *box.SnapshotLockListItem
+	for _, s := range t.Snapshots[from] {
+		if digest == "" || s.Digest == digest {
+			itm = s
+			break
+		}
+	}
+	if itm == nil {
+		if digest != "" {
+			return nil, false, fmt.Errorf("no snapshot with digest '%s' in channel '%s'", digest, from)
+		}
+		return nil, false, fmt.Errorf("no snapshots found for channel '%s'", from)
+	}
+
+	if latest := t.Snapshots[to]; len(latest) != 0 && latest[0].Digest == itm.Digest {
+		return itm, false, nil
+	}
+
+	promoted := *itm
+	t.Snapshots[to] = append([]*box.SnapshotLockListItem{&promoted}, t.Snapshots[to]...)
+	return itm, true, nil
+}
+
+// pruneLockfile removes all but the latest keep snapshots of every
+// channel of every target, returning the snapshots that were removed.
+func pruneLockfile(lockfile *box.SnapshotLock, keep int) []*box.SnapshotLockListItem {
+	removed := make([]*box.SnapshotLockListItem, 0)
+	for _, t := range lockfile.TargetsV2 {
+		for channel, snapshots := range t.Snapshots {
+			if len(snapshots) <= keep {
+				continue
+			}
+
+			removed = append(removed, snapshots[keep:]...)
+			t.Snapshots[channel] = snapshots[:keep]
+		}
+	}
+
+	return removed
+}
+
+// lockfileURIs returns the URIs of every snapshot in the lockfile
+func lockfileURIs(lockfile *box.SnapshotLock) map[string]bool {
+	uris := make(map[string]bool)
+	for _, t := range lockfile.TargetsV2 {
+		for _, snapshots := range t.Snapshots {
+			for _, s := range snapshots {
+				uris[s.URI] = true
+			}
+		}
+	}
+
+	return uris
+}
+
+// unreferencedURIs returns the URIs of removed snapshots that aren't used by a
+// snapshot in the lockfile, e.g. because they were promoted to another channel.
+func unreferencedURIs(lockfile *box.SnapshotLock, removed []*box.SnapshotLockListItem) []string {
+	referenced := lockfileURIs(lockfile)
+
+	uris := make([]string, 0)
+	for _, s := range removed {
+		// Snapshots generated with --skip-upload have no URI
+		if referenced[s.URI] || s.URI == "" || s.URI == "unknown" {
+			continue
+		}
+
+		referenced[s.URI] = true
+		uris = append(uris, s.URI)
+	}
+	sort.Strings(uris)
+
+	return uris
+}
+
+// getChunkManifest fetches the manifest of a chunked snapshot
+func (o *Options) getChunkManifest(ctx context.Context, s3c *s3.Client, key string) (*noncmdsnapshot.ChunkManifest, error) {
+	resp, err := s3c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch chunk manifest %s", key)
+	}
+	defer resp.Body.Close()
+
+	var manifest noncmdsnapshot.ChunkManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse chunk manifest %s", key)
+	}
+
+	return &manifest, nil
+}
+
+// deleteObject deletes an object from the snapshot bucket
+func (o *Options) deleteObject(ctx context.Context, s3c *s3.Client, key string, dryRun bool) error {
+	o.log.WithField("key", key).WithField("dryRun", dryRun).Info("Deleting snapshot object")
+	if dryRun {
+		return nil
+	}
+
+	_, err := s3c.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
+		Key:    &key,
+	})
+	return errors.Wrapf(err, "failed to delete %s", key)
+}
+
+// pruneChunks deletes chunks that aren't used by any chunked snapshot in the lockfile
+func (o *Options) pruneChunks(ctx context.Context, s3c *s3.Client, lockfile *box.SnapshotLock, dryRun bool) error {
+	referenced := make(map[string]bool)
+	for uri := range lockfileURIs(lockfile) {
+		if !noncmdsnapshot.IsChunked(uri) {
+			continue
+		}
+
+		manifest, err := o.getChunkManifest(ctx, s3c, uri)
+		if err != nil {
+			return err
+		}
+		for digest := range manifest.Digests() {
+			referenced[digest] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-chunkGracePeriod)
+	p := s3.NewListObjectsV2Paginator(s3c, &s3.ListObjectsV2Input{
+		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
+		Prefix: aws.String(noncmdsnapshot.ChunksPrefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list snapshot chunks")
+		}
+
+		for i := range page.Contents {
+			obj := &page.Contents[i]
+			digest := strings.TrimSuffix(path.Base(*obj.Key), ".zst")
+			if referenced[digest] || (obj.LastModified != nil && obj.LastModified.After(cutoff)) {
+				continue
+			}
+
+			if err := o.deleteObject(ctx, s3c, *obj.Key, dryRun); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Promote makes a snapshot in the from channel of a target the latest snapshot
+// in the to channel. The latest snapshot in the from channel is promoted if
+// digest is empty.
+func (o *Options) Promote(ctx context.Context, target string, from, to box.SnapshotLockChannel, digest string) error {
+	s3c, err := o.newS3Client(ctx, o.b.DeveloperEnvironmentConfig.SnapshotConfig.WriteAWSRole)
+	if err != nil {
+		return err
+	}
+
+	lockfile, err := o.getLockfile(ctx, s3c, false)
+	if err != nil {
+		return err
+	}
+
+	itm, changed, err := promoteSnapshot(lockfile, target, from, to, digest)
+	if err != nil {
+		return err
+	}
+
+	log := o.log.WithField("target", target).WithField("digest", itm.Digest)
+	if !changed {
+		log.Infof("Snapshot is already the latest snapshot in channel '%s'", to)
+		return nil
+	}
+
+	if err := o.putLockfile(ctx, s3c, lockfile); err != nil {
+		return err
+	}
+
+	log.Infof("Promoted snapshot from channel '%s' to '%s'", from, to)
+	return nil
+}
+
+// Prune removes all but the latest keep snapshots of every channel of every
+// target from the lockfile, and deletes their archives, or manifests and
+// chunks, from S3 if they're not used by a remaining snapshot.
+func (o *Options) Prune(ctx context.Context, keep int, dryRun bool) error {
+	if keep < 1 {
+		return fmt.Errorf("at least one snapshot must be kept")
+	}
+
+	s3c, err := o.newS3Client(ctx, o.b.DeveloperEnvironmentConfig.SnapshotConfig.WriteAWSRole)
+	if err != nil {
+		return err
+	}
+
+	lockfile, err := o.getLockfile(ctx, s3c, false)
+	if err != nil {
+		return err
+	}
+
+	removed := pruneLockfile(lockfile, keep)
+	uris := unreferencedURIs(lockfile, removed)
+	o.log.WithField("snapshots", len(removed)).WithField("objects", len(uris)).Info("Pruning snapshots")
+
+	// Update the lockfile first so it never references deleted snapshots
+	if len(removed) != 0 && !dryRun {
+		if err := o.putLockfile(ctx, s3c, lockfile); err != nil {
+			return err
+		}
+	}
+
+	for _, uri := range uris {
+		if err := o.deleteObject(ctx, s3c, uri, dryRun); err != nil {
+			return err
+		}
+	}
+
+	return o.pruneChunks(ctx, s3c, lockfile, dryRun)
+}
+
+// snapshotCreatedAt returns when a snapshot was generated, based
+// on the timestamp in its key
+func snapshotCreatedAt(uri string) time.Time {
+	ts, err := strconv.ParseInt(strings.SplitN(path.Base(uri), ".", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ts).UTC()
+}
+
+// snapshotSize returns the size of a snapshot in S3
+func (o *Options) snapshotSize(ctx context.Context, s3c *s3.Client, uri string) (int64, error) {
+	if noncmdsnapshot.IsChunked(uri) {
+		manifest, err := o.getChunkManifest(ctx, s3c, uri)
+		if err != nil {
+			return 0, err
+		}
+
+		var size int64
+		for i := range manifest.Files {
+			size += manifest.Files[i].Size
+		}
+		return size, nil
+	}
+
+	resp, err := s3c.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
+		Key:    &uri,
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get snapshot %s", uri)
+	}
+	return resp.ContentLength, nil
+}
+
+// ListRemote returns the generated snapshots in the lockfile, optionally
+// only those of a target and/or channel.
+func (o *Options) ListRemote(ctx context.Context, target string, channel box.SnapshotLockChannel) ([]RemoteSnapshot, error) {
+	s3c, err := o.newS3Client(ctx, o.b.DeveloperEnvironmentConfig.SnapshotConfig.ReadAWSRole)
+	if err != nil {
+		return nil, err
+	}
+
+	lockfile, err := o.getLockfile(ctx, s3c, false)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]RemoteSnapshot, 0)
+	for name, t := range lockfile.TargetsV2 {
+		if target != "" && name != target {
+			continue
+		}
+
+		for c, items := range t.Snapshots {
+			if channel != "" && c != channel {
+				continue
+			}
+
+			for i, itm := range items {
+				size, err := o.snapshotSize(ctx, s3c, itm.URI)
+				if err != nil {
+					o.log.WithError(err).Warn("Failed to get snapshot size")
+				}
+
+				snapshots = append(snapshots, RemoteSnapshot{
+					Target:    name,
+					Channel:   c,
+					Index:     i,
+					Digest:    itm.Digest,
+					URI:       itm.URI,
+					Size:      size,
+					CreatedAt: snapshotCreatedAt(itm.URI),
+					Apps:      o.snapshotApps[itm.URI],
+				})
+			}
+		}
+	}
+
+	sortRemoteSnapshots(snapshots)
+	return snapshots, nil
+}
+
+// sortRemoteSnapshots sorts snapshots by target and channel, keeping the
+// order of the lockfile, latest first, within each channel
+func sortRemoteSnapshots(snapshots []RemoteSnapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		a, b := &snapshots[i], &snapshots[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		return a.Index < b.Index
+	})
+}
+
+// writeRemoteSnapshots writes snapshots to w in the given format
+func writeRemoteSnapshots(w io.Writer, snapshots []RemoteSnapshot, format string) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(snapshots)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TARGET\tCHANNEL\tINDEX\tDIGEST\tSIZE\tAGE")
+		for i := range snapshots {
+			s := &snapshots[i]
+
+			age := "unknown"
+			if !s.CreatedAt.IsZero() {
+				age = duration.HumanDuration(time.Since(s.CreatedAt))
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", s.Target, s.Channel, s.Index, s.Digest,
+				humanize.IBytes(uint64(s.Size)), age)
+		}
+		return tw.Flush()
+	}
+
+	return fmt.Errorf("invalid format %s", format)
+}
@@ -0,0 +1,109 @@
+package snapshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getoutreach/devenv/internal/apps"
+	"github.com/getoutreach/gobox/pkg/box"
+	"gopkg.in/yaml.v2"
+	"gotest.tools/v3/assert"
+)
+
+func newTestLockfile() *box.SnapshotLock {
+	return &box.SnapshotLock{
+		TargetsV2: map[string]*box.SnapshotLockList{
+			"base": {
+				Snapshots: map[box.SnapshotLockChannel][]*box.SnapshotLockListItem{
+					box.SnapshotLockChannelRC: {
+						{Digest: "3", URI: "automated-snapshots/v2/base/3.tar"},
+						{Digest: "2", URI: "automated-snapshots/v2/base/2.tar"},
+						{Digest: "1", URI: "automated-snapshots/v2/base/1.tar"},
+					},
+					box.SnapshotLockChannelStable: {
+						{Digest: "1", URI: "automated-snapshots/v2/base/1.tar"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestPromoteSnapshot(t *testing.T) {
+	lockfile := newTestLockfile()
+	snapshots := lockfile.TargetsV2["base"].Snapshots
+
+	// Defaults to the latest snapshot
+	itm, changed, err := promoteSnapshot(lockfile, "base", box.SnapshotLockChannelRC, box.SnapshotLockChannelStable, "")
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	assert.Equal(t, itm.Digest, "3")
+	assert.Equal(t, len(snapshots[box.SnapshotLockChannelStable]), 2)
+	assert.Equal(t, snapshots[box.SnapshotLockChannelStable][0].Digest, "3")
+
+	// Promoting the latest snapshot again is a no-op
+	_, changed, err = promoteSnapshot(lockfile, "base", box.SnapshotLockChannelRC, box.SnapshotLockChannelStable, "3")
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+	assert.Equal(t, len(snapshots[box.SnapshotLockChannelStable]), 2)
+
+	_, _, err = promoteSnapshot(lockfile, "base", box.SnapshotLockChannelRC, box.SnapshotLockChannelStable, "4")
+	assert.ErrorContains(t, err, "no snapshot with digest '4'")
+
+	_, _, err = promoteSnapshot(lockfile, "other", box.SnapshotLockChannelRC, box.SnapshotLockChannelStable, "")
+	assert.ErrorContains(t, err, "unknown snapshot target")
+}
+
+func TestPruneLockfile(t *testing.T) {
+	lockfile := newTestLockfile()
+
+	removed := pruneLockfile(lockfile, 1)
+	assert.Equal(t, len(removed), 2)
+	assert.Equal(t, len(lockfile.TargetsV2["base"].Snapshots[box.SnapshotLockChannelRC]), 1)
+
+	// 1.tar is still used by the stable channel
+	assert.DeepEqual(t, unreferencedURIs(lockfile, removed), []string{"automated-snapshots/v2/base/2.tar"})
+}
+
+func TestSnapshotCreatedAt(t *testing.T) {
+	assert.Equal(t, snapshotCreatedAt("automated-snapshots/v2/base/1600000000000000000.manifest.json"),
+		time.Unix(1600000000, 0).UTC())
+	assert.Assert(t, snapshotCreatedAt("unknown").IsZero())
+}
+
+func TestSortRemoteSnapshots(t *testing.T) {
+	// A promoted snapshot is the latest in its channel, even if
+	// it was created before the snapshots after it
+	snapshots := []RemoteSnapshot{
+		{Target: "base", Channel: box.SnapshotLockChannelStable, Index: 1, CreatedAt: time.Unix(2, 0)},
+		{Target: "base", Channel: box.SnapshotLockChannelStable, Index: 0, CreatedAt: time.Unix(1, 0)},
+		{Target: "base", Channel: box.SnapshotLockChannelRC, Index: 0, CreatedAt: time.Unix(3, 0)},
+	}
+	sortRemoteSnapshots(snapshots)
+
+	assert.DeepEqual(t, snapshots, []RemoteSnapshot{
+		{Target: "base", Channel: box.SnapshotLockChannelRC, Index: 0, CreatedAt: time.Unix(3, 0)},
+		{Target: "base", Channel: box.SnapshotLockChannelStable, Index: 0, CreatedAt: time.Unix(1, 0)},
+		{Target: "base", Channel: box.SnapshotLockChannelStable, Index: 1, CreatedAt: time.Unix(2, 0)},
+	})
+}
+
+func TestLockfileApps(t *testing.T) {
+	lockfile := newTestLockfile()
+	snapshotApps := map[string][]apps.App{
+		"automated-snapshots/v2/base/1.tar": {{Name: "flagship", Version: "v1.0.0"}},
+	}
+
+	b, err := encodeLockfile(lockfile, snapshotApps)
+	assert.NilError(t, err)
+
+	// Readers that don't know about apps are still able to parse it
+	var plain *box.SnapshotLock
+	assert.NilError(t, yaml.Unmarshal(b, &plain))
+	assert.DeepEqual(t, plain.TargetsV2, lockfile.TargetsV2)
+
+	decoded, decodedApps, err := decodeLockfile(b)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, decoded.TargetsV2, lockfile.TargetsV2)
+	assert.DeepEqual(t, decodedApps, snapshotApps)
+}
@@ -2,38 +2,36 @@ package snapshot
 
 import (
 	"archive/tar"
-	"bytes"
 	"context"
 	"crypto/md5" //nolint:gosec // Why: just using for digest checking
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	dockerclient "github.com/docker/docker/client"
 	"github.com/getoutreach/devenv/cmd/devenv/destroy"
 	"github.com/getoutreach/devenv/cmd/devenv/provision"
+	"github.com/getoutreach/devenv/internal/apps"
 	noncmdsnapshot "github.com/getoutreach/devenv/internal/snapshot"
-	devenvaws "github.com/getoutreach/devenv/pkg/aws"
+	"github.com/getoutreach/devenv/internal/vault"
 	"github.com/getoutreach/devenv/pkg/cmdutil"
 	"github.com/getoutreach/devenv/pkg/devenvutil"
 	"github.com/getoutreach/devenv/pkg/kube"
 	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
 	"github.com/getoutreach/devenv/pkg/snapshoter"
 	"github.com/getoutreach/gobox/pkg/box"
-	"github.com/minio/minio-go/v7"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
-	"gopkg.in/yaml.v2"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -50,16 +48,48 @@ import (
 var (
 	snapshotLongDesc = `
 		Manage snapshots of your developer environment.
+
+		Snapshots created with 'devenv snapshot create' are personal snapshots of your running developer environment, they're stored in the in-cluster minio and are lost when your developer environment is destroyed, unless they're exported to a file. Restoring a snapshot replaces the namespaces in it with their state when the snapshot was created.
+
+		Snapshots created with 'devenv snapshot generate' are used to provision new developer environments. They're generated into the rc channel, and promoted to the stable channel with 'devenv snapshot promote' once they've been tested.
 	`
 	helpersExample = `
-		# Create a snapshot
+		# Create a snapshot, named after the current time
 		devenv snapshot create
 
-		# Delete a snapshot
-		devenv snapshot delete <date>
+		# Create a named snapshot of a single namespace, e.g. before running a migration
+		devenv snapshot create before-migration --namespace my-database
+
+		# List snapshots
+		devenv snapshot list
 
 		# Restore a snapshot to a existing cluster
-		devenv snapshot restore <date>
+		devenv snapshot restore before-migration
+
+		# Restore a snapshot without being asked to confirm, e.g. in a script
+		devenv snapshot restore before-migration --force
+
+		# Delete a snapshot
+		devenv snapshot delete before-migration
+
+		# Export a snapshot to a file, to share it with someone else
+		devenv snapshot export before-migration -o before-migration.tar.zst
+
+		# Import a snapshot from a file, then restore it
+		devenv snapshot import before-migration.tar.zst
+		devenv snapshot restore before-migration
+
+		# List generated snapshots of a target
+		devenv snapshot ls-remote --target base
+
+		# Promote the latest rc snapshot of a target to stable
+		devenv snapshot promote base --from rc --to stable
+
+		# Delete all but the 5 latest generated snapshots in each channel
+		devenv snapshot prune --keep 5
+
+		# Generate two targets from snapshots.yaml at once, each in its own cluster
+		devenv snapshot generate --target base --target flagship --parallel 2
 	`
 )
 
@@ -70,6 +100,33 @@ type Options struct {
 	d   dockerclient.APIClient
 	b   *box.Config
 	vc  veleroclient.Interface
+
+	// snapshotApps are the applications in generated snapshots by
+	// the URI of the snapshot, it's set by getLockfile
+	snapshotApps map[string][]apps.App
+
+	// Chunked uploads generated snapshots as content-addressed chunks,
+	// rather than a tar archive. Only devenv versions that support
+	// chunked snapshots are able to provision from them.
+	Chunked bool
+
+	// Targets are the targets to generate, defaults to every target
+	Targets []string
+
+	// Parallel is the number of targets that are generated at once. When
+	// greater than one, every target is generated in its own kind cluster,
+	// leaving the current developer environment untouched.
+	Parallel int
+
+	// ResultOutput is a file to write the result of generating a single
+	// target to instead of updating the lockfile. It's used by parallel
+	// generation, where only the parent process updates the lockfile.
+	ResultOutput string
+
+	// BaseDigest is the digest of the snapshot of its base target that a
+	// derived target is generated from, defaults to the latest snapshot of
+	// the base target in the channel being generated.
+	BaseDigest string
 }
 
 func NewOptions(log logrus.FieldLogger, b *box.Config) (*Options, error) {
@@ -104,12 +161,151 @@ func NewOptions(log logrus.FieldLogger, b *box.Config) (*Options, error) {
 	return opts, nil
 }
 
+// newLocalOptions creates options for the commands that manage local snapshots
+func newLocalOptions(log logrus.FieldLogger) (*Options, error) {
+	b, err := box.LoadBox()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load box configuration")
+	}
+
+	return NewOptions(log, b)
+}
+
 func NewCmdSnapshot(log logrus.FieldLogger) *cli.Command { //nolint:funlen
 	return &cli.Command{
 		Name:        "snapshot",
 		Usage:       "Manage snapshots of your developer environment",
 		Description: cmdutil.NewDescription(snapshotLongDesc, helpersExample),
 		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Create a snapshot of your developer environment",
+				ArgsUsage: "[name]",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "namespace",
+						Usage: "Only include a specific namespace in the snapshot, can be repeated",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+					return o.CreateLocal(c.Context, c.Args().First(), c.StringSlice("namespace"))
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "List snapshots of your developer environment",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Change the output format, valid options are: table, json",
+						Value:   "table",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+
+					if _, err := o.ensureRunning(c.Context); err != nil {
+						return err
+					}
+
+					snapshots, err := o.ListLocal(c.Context)
+					if err != nil {
+						return err
+					}
+					return writeLocalSnapshots(os.Stdout, snapshots, c.String("output"))
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "Restore a snapshot into your developer environment",
+				ArgsUsage: "<name>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Don't ask for confirmation before replacing the namespaces in the snapshot",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return fmt.Errorf("expected exactly one snapshot name")
+					}
+
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+					return o.RestoreLocal(c.Context, c.Args().First(), c.Bool("force"))
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a snapshot of your developer environment",
+				ArgsUsage: "<name>",
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return fmt.Errorf("expected exactly one snapshot name")
+					}
+
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+					return o.DeleteLocal(c.Context, c.Args().First())
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "Export a snapshot to a file, which can be imported into another developer environment",
+				ArgsUsage: "<name>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "File to write the snapshot to, defaults to <name>.tar.zst",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return fmt.Errorf("expected exactly one snapshot name")
+					}
+					name := c.Args().First()
+
+					output := c.String("output")
+					if output == "" {
+						output = name + ".tar.zst"
+					}
+
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+					return o.Export(c.Context, name, output)
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Import a snapshot from a file created by 'devenv snapshot export'",
+				ArgsUsage: "<file>",
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return fmt.Errorf("expected exactly one file")
+					}
+
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+					return o.Import(c.Context, c.Args().First())
+				},
+			},
 			{
 				Name:        "generate",
 				Description: "Generate a snapshot from a snapshot definition",
@@ -124,6 +320,29 @@ func NewCmdSnapshot(log logrus.FieldLogger) *cli.Command { //nolint:funlen
 						Value: string(box.SnapshotLockChannelRC),
 						Usage: "Which channel this snapshot should be uploaded to",
 					},
+					&cli.BoolFlag{
+						Name:  "chunked",
+						Usage: "Upload snapshots as compressed, content-addressed chunks so unchanged data is only uploaded once",
+					},
+					&cli.StringSliceFlag{
+						Name:  "target",
+						Usage: "Only generate a specific target, can be repeated",
+					},
+					&cli.IntFlag{
+						Name:  "parallel",
+						Value: 1,
+						Usage: "Number of targets to generate at once, each in its own cluster",
+					},
+					&cli.StringFlag{
+						Name:   "result-output",
+						Usage:  "Write the result of generating a single target to a file instead of updating the lockfile",
+						Hidden: true,
+					},
+					&cli.StringFlag{
+						Name:   "base-digest",
+						Usage:  "Digest of the base target snapshot to generate a derived target from",
+						Hidden: true,
+					},
 				},
 				Action: func(c *cli.Context) error {
 					b, err := box.LoadBox()
@@ -136,18 +355,105 @@ func NewCmdSnapshot(log logrus.FieldLogger) *cli.Command { //nolint:funlen
 						return err
 					}
 
-					byt, err := os.ReadFile("snapshots.yaml")
+					s, err := LoadGenerateConfig("snapshots.yaml")
 					if err != nil {
 						return err
 					}
 
-					var s *box.SnapshotGenerateConfig
-					err = yaml.Unmarshal(byt, &s)
+					o.Chunked = c.Bool("chunked")
+					o.Targets = c.StringSlice("target")
+					o.Parallel = c.Int("parallel")
+					o.ResultOutput = c.String("result-output")
+					o.BaseDigest = c.String("base-digest")
+
+					return o.Generate(c.Context, s, c.Bool("skip-upload"), box.SnapshotLockChannel(c.String("channel")))
+				},
+			},
+			{
+				Name:      "promote",
+				Usage:     "Promote a generated snapshot of a target from one channel to another",
+				ArgsUsage: "<target>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from",
+						Value: string(box.SnapshotLockChannelRC),
+						Usage: "Channel to promote the snapshot from",
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Value: string(box.SnapshotLockChannelStable),
+						Usage: "Channel to promote the snapshot to",
+					},
+					&cli.StringFlag{
+						Name:  "digest",
+						Usage: "Digest of the snapshot to promote, defaults to the latest snapshot in the from channel",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return fmt.Errorf("expected exactly one snapshot target")
+					}
+
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+					return o.Promote(c.Context, c.Args().First(), box.SnapshotLockChannel(c.String("from")),
+						box.SnapshotLockChannel(c.String("to")), c.String("digest"))
+				},
+			},
+			{
+				Name:  "prune",
+				Usage: "Delete all but the latest generated snapshots of every channel of every target",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:     "keep",
+						Usage:    "Number of snapshots to keep in each channel",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print what would be deleted, without deleting anything",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					o, err := newLocalOptions(log)
+					if err != nil {
+						return err
+					}
+					return o.Prune(c.Context, c.Int("keep"), c.Bool("dry-run"))
+				},
+			},
+			{
+				Name:  "ls-remote",
+				Usage: "List generated snapshots",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "target",
+						Usage: "Only list snapshots of a specific target",
+					},
+					&cli.StringFlag{
+						Name:  "channel",
+						Usage: "Only list snapshots in a specific channel",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Change the output format, valid options are: table, json",
+						Value:   "table",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					o, err := newLocalOptions(log)
 					if err != nil {
 						return err
 					}
 
-					return o.Generate(c.Context, s, c.Bool("skip-upload"), box.SnapshotLockChannel(c.String("channel")))
+					snapshots, err := o.ListRemote(c.Context, c.String("target"), box.SnapshotLockChannel(c.String("channel")))
+					if err != nil {
+						return err
+					}
+					return writeRemoteSnapshots(os.Stdout, snapshots, c.String("output"))
 				},
 			},
 		},
@@ -170,100 +476,120 @@ func (a *awsEndpointResolver) ResolveEndpoint(_, _ string) (aws.Endpoint, error)
 	}, nil
 }
 
-func (o *Options) Generate(ctx context.Context, s *box.SnapshotGenerateConfig,
+func (o *Options) Generate(ctx context.Context, s *GenerateConfig,
 	skipUpload bool, channel box.SnapshotLockChannel) error { //nolint:funlen
-	o.log.WithField("snapshots", len(s.Targets)).Info("Generating Snapshots")
-
-	copts := devenvaws.DefaultCredentialOptions()
-	if o.b.DeveloperEnvironmentConfig.SnapshotConfig.WriteAWSRole != "" {
-		copts.Role = o.b.DeveloperEnvironmentConfig.SnapshotConfig.WriteAWSRole
+	targets, err := s.generationOrder(o.Targets)
+	if err != nil {
+		return err
 	}
-	copts.Log = o.log
-	err := devenvaws.EnsureValidCredentials(ctx, copts)
+
+	o.log.WithField("snapshots", len(targets)).Info("Generating Snapshots")
+
+	s3c, err := o.newS3Client(ctx, o.b.DeveloperEnvironmentConfig.SnapshotConfig.WriteAWSRole)
 	if err != nil {
-		return errors.Wrap(err, "failed to get necessary permissions")
+		return err
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(o.b.DeveloperEnvironmentConfig.SnapshotConfig.Region))
+	lockfile, err := o.getLockfile(ctx, s3c, true)
 	if err != nil {
 		return err
 	}
 
-	// use a custom endpoint if provided
-	endpoint := o.b.DeveloperEnvironmentConfig.SnapshotConfig.Endpoint
-	if endpoint != "" {
-		cfg.EndpointResolver = &awsEndpointResolver{ //nolint:staticcheck // Why: using new one doesn't work?
-			endpoint: endpoint,
-			region:   cfg.Region,
+	if o.ResultOutput != "" {
+		if len(targets) != 1 {
+			return fmt.Errorf("expected exactly one target when writing the generation result")
 		}
-	}
-	o.log.WithField("region", cfg.Region).WithField("endpoint", endpoint).Info("s3 config")
 
-	s3c := s3.NewFromConfig(cfg)
+		// Partial results of failed targets are written too, so that the
+		// parent process is able to report what was deployed
+		gen, err := o.generateSnapshot(ctx, s3c, lockfile, s, targets[0], channel, skipUpload) //nolint:govet // Why: OK shadowing err
+		if gen == nil {
+			return err
+		}
 
-	lockfile := &box.SnapshotLock{}
-	resp, err := s3c.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
-		Key:    aws.String("automated-snapshots/v2/latest.yaml"),
-	})
-	if err == nil {
-		defer resp.Body.Close()
-		err = yaml.NewDecoder(resp.Body).Decode(&lockfile)
-		if err != nil {
-			return errors.Wrap(err, "failed to parse remote snapshot lockfile")
+		b, merr := json.Marshal(gen)
+		if merr != nil {
+			return errors.Wrap(merr, "failed to marshal generation result")
+		}
+		if werr := os.WriteFile(o.ResultOutput, b, 0o600); werr != nil {
+			return errors.Wrap(werr, "failed to write generation result")
 		}
-	} else {
-		o.log.WithError(err).
-			Warn("Failed to fetch existing remote snapshot lockfile, will generate a new one")
+		return err
 	}
 
-	if lockfile.TargetsV2 == nil {
-		lockfile.TargetsV2 = make(map[string]*box.SnapshotLockList)
+	if o.Parallel > 1 {
+		return o.generateParallel(ctx, s3c, lockfile, s, targets, channel, skipUpload)
 	}
 
-	for name, t := range s.Targets {
+	generated := make([]*generatedSnapshot, 0, len(targets))
+	for _, name := range targets {
 		//nolint:govet // Why: We're OK shadowing err
-		itm, err := o.generateSnapshot(ctx, s3c, name, t, skipUpload)
+		gen, err := o.generateSnapshot(ctx, s3c, lockfile, s, name, channel, skipUpload)
+		if err == nil && !skipUpload {
+			// The lockfile is updated after every target so that targets derived
+			// from it are able to restore its snapshot
+			err = o.recordSnapshot(ctx, s3c, lockfile, channel, gen)
+		}
 		if err != nil {
-			return err
+			if gen != nil {
+				generated = append(generated, gen)
+			}
+			writeGenerateReport(os.Stdout, generated) //nolint:errcheck // Why: Best effort
+			return errors.Wrapf(err, "failed to generate snapshot target '%s'", name)
 		}
+		generated = append(generated, gen)
+	}
 
-		if _, ok := lockfile.TargetsV2[name]; !ok {
-			lockfile.TargetsV2[name] = &box.SnapshotLockList{}
-		}
+	return writeGenerateReport(os.Stdout, generated)
+}
 
-		if lockfile.TargetsV2[name].Snapshots == nil {
-			lockfile.TargetsV2[name].Snapshots = make(map[box.SnapshotLockChannel][]*box.SnapshotLockListItem)
-		}
+// recordSnapshot makes a generated snapshot the latest snapshot of its
+// target in a channel and uploads the lockfile
+func (o *Options) recordSnapshot(ctx context.Context, s3c *s3.Client, lockfile *box.SnapshotLock,
+	channel box.SnapshotLockChannel, gen *generatedSnapshot) error {
+	addLockfileItem(lockfile, gen.Target, channel, gen.Item)
+	o.snapshotApps[gen.Item.URI] = gen.Apps
+	return o.putLockfile(ctx, s3c, lockfile)
+}
 
-		if _, ok := lockfile.TargetsV2[name].Snapshots[channel]; !ok {
-			lockfile.TargetsV2[name].Snapshots[channel] = make([]*box.SnapshotLockListItem, 0)
-		}
+// addLockfileItem makes a snapshot the latest snapshot of a target in a channel
+func addLockfileItem(lockfile *box.SnapshotLock, name string, channel box.SnapshotLockChannel, itm *box.SnapshotLockListItem) {
+	if lockfile.TargetsV2 == nil {
+		lockfile.TargetsV2 = make(map[string]*box.SnapshotLockList)
+	}
 
-		// Make this the latest version
-		lockfile.TargetsV2[name].Snapshots[channel] = append(
-			[]*box.SnapshotLockListItem{itm}, lockfile.TargetsV2[name].Snapshots[channel]...,
-		)
+	if _, ok := lockfile.TargetsV2[name]; !ok {
+		lockfile.TargetsV2[name] = &box.SnapshotLockList{}
 	}
 
-	// Don't generate a lock if we're not uploading
-	if skipUpload {
-		return nil
+	if lockfile.TargetsV2[name].Snapshots == nil {
+		lockfile.TargetsV2[name].Snapshots = make(map[box.SnapshotLockChannel][]*box.SnapshotLockListItem)
 	}
 
-	lockfile.GeneratedAt = time.Now().UTC()
+	lockfile.TargetsV2[name].Snapshots[channel] = append(
+		[]*box.SnapshotLockListItem{itm}, lockfile.TargetsV2[name].Snapshots[channel]...,
+	)
+}
 
-	byt, err := yaml.Marshal(lockfile)
+// postRestoreArchivePath is the well-known path of the post-restore
+// manifests in a snapshot
+const postRestoreArchivePath = "post-restore/manifests.yaml"
+
+// writeArchiveFile writes a file into a tar archive
+func writeArchiveFile(tw *tar.Writer, name string, contents []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(contents)),
+		Mode:     0o644,
+		ModTime:  time.Now(),
+	})
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to write tar header")
 	}
 
-	_, err = s3c.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &o.b.DeveloperEnvironmentConfig.SnapshotConfig.Bucket,
-		Key:    aws.String(filepath.Join("automated-snapshots", "v2", "latest.yaml")),
-		Body:   bytes.NewReader(byt),
-	})
-	return err
+	_, err = tw.Write(contents)
+	return errors.Wrapf(err, "failed to write %s", name)
 }
 
 //nolint:funlen,gocritic
@@ -275,8 +601,11 @@ func (o *Options) uploadSnapshot(ctx context.Context, s3c *s3.Client,
 	}
 	defer os.Remove(tmpFile.Name())
 
+	// The digest is stored in the lockfile, the MD5 is only used by S3 to
+	// verify the upload.
+	digest := noncmdsnapshot.NewDigester()
 	hash := md5.New() //nolint:gosec // Why: We're just creating a digest
-	tw := tar.NewWriter(io.MultiWriter(tmpFile, hash))
+	tw := tar.NewWriter(io.MultiWriter(tmpFile, digest, hash))
 
 	o.k, err = kube.GetKubeClient()
 	if err != nil {
@@ -289,39 +618,9 @@ func (o *Options) uploadSnapshot(ctx context.Context, s3c *s3.Client,
 	}
 
 	o.log.Info("creating tar archive")
-	for obj := range mc.ListObjects(ctx, noncmdsnapshot.SnapshotNamespace, minio.ListObjectsOptions{Recursive: true}) {
-		// Skip empty keys
-		if strings.EqualFold(obj.Key, "") {
-			continue
-		}
-
-		sObj, err := mc.GetObject(ctx, noncmdsnapshot.SnapshotNamespace, obj.Key, minio.GetObjectOptions{}) //nolint:govet
-		if err != nil {
-			return "", "", errors.Wrap(err, "failed to get object from local S3")
-		}
-
-		info, err := sObj.Stat()
-		if err != nil {
-			return "", "", errors.Wrap(err, "failed to stat object")
-		}
-
-		err = tw.WriteHeader(&tar.Header{
-			Typeflag:   tar.TypeReg,
-			Name:       info.Key,
-			Size:       info.Size,
-			Mode:       0o755,
-			ModTime:    info.LastModified,
-			AccessTime: info.LastModified,
-			ChangeTime: info.LastModified,
-		})
-		if err != nil {
-			return "", "", errors.Wrap(err, "failed to write tar header")
-		}
-
-		_, err = io.Copy(tw, sObj)
-		if err != nil {
-			return "", "", errors.Wrap(err, "failed to download object from local S3")
-		}
+	aw := noncmdsnapshot.NewArchiveWriter(tw)
+	if err := snapshoter.WriteArchive(ctx, aw, mc.Client, noncmdsnapshot.SnapshotNamespace, "", ""); err != nil { //nolint:govet // Why: OK shadowing err
+		return "", "", err
 	}
 
 	// If we have post-restore manifests, then include them in the archive at a well-known
@@ -331,6 +630,7 @@ func (o *Options) uploadSnapshot(ctx context.Context, s3c *s3.Client,
 		if err != nil {
 			return "", "", errors.Wrap(err, "failed to open post-restore file")
 		}
+		defer f.Close()
 
 		inf, err := f.Stat()
 		if err != nil {
@@ -341,19 +641,19 @@ func (o *Options) uploadSnapshot(ctx context.Context, s3c *s3.Client,
 		if err != nil {
 			return "", "", errors.Wrap(err, "failed to create tar header")
 		}
-		header.Name = "post-restore/manifests.yaml"
+		header.Name = postRestoreArchivePath
 
-		err = tw.WriteHeader(header)
-		if err != nil {
-			return "", "", errors.Wrap(err, "failed to write tar header")
-		}
-
-		_, err = io.Copy(tw, f)
-		if err != nil {
+		if err := aw.WriteFile(header, f); err != nil { //nolint:govet // Why: OK shadowing err
 			return "", "", errors.Wrap(err, "failed to write post-restore file to archive")
 		}
 	}
 
+	// Checksums are written last, after every file has been checksummed
+	// as it was written into the archive
+	if err := aw.Close(); err != nil { //nolint:govet // Why: OK shadowing err
+		return "", "", err
+	}
+
 	if err := tw.Close(); err != nil { //nolint:govet // Why: we're OK shadowing err
 		return "", "", err
 	}
@@ -382,18 +682,43 @@ func (o *Options) uploadSnapshot(ctx context.Context, s3c *s3.Client,
 		return "", "", err
 	}
 
-	return hashStr, key, nil
+	return digest.Digest(), key, nil
 }
 
-//nolint:funlen
-func (o *Options) generateSnapshot(ctx context.Context, s3c *s3.Client,
-	name string, t *box.SnapshotTarget, skipUpload bool) (*box.SnapshotLockListItem, error) {
+//nolint:funlen,gocyclo
+func (o *Options) generateSnapshot(ctx context.Context, s3c *s3.Client, lockfile *box.SnapshotLock,
+	s *GenerateConfig, name string, channel box.SnapshotLockChannel, skipUpload bool) (*generatedSnapshot, error) {
 	o.log.WithField("snapshot", name).Info("Generating Snapshot")
+	started := time.Now()
+	t := s.Targets[name]
+
+	// Derived targets start from a snapshot of their base target
+	var baseItm *box.SnapshotLockListItem
+	if base := s.Bases[name]; base != "" {
+		var err error
+		baseItm, err = findBaseSnapshot(lockfile, base, channel, o.BaseDigest)
+		if err != nil {
+			return nil, err
+		}
+		o.log.WithField("base", base).WithField("digest", baseItm.Digest).Info("Deriving snapshot from base target")
+	}
 
 	destroyOpts, err := destroy.NewOptions(o.log, o.b)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create destroy command")
 	}
+
+	// Clusters other than the default one only exist to generate this
+	// snapshot, so they're destroyed once it's been generated
+	if kubernetesruntime.GetKindClusterName() != kubernetesruntime.KindClusterName {
+		destroyOpts.KubernetesRuntime, err = kubernetesruntime.GetRuntime("kind")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create kind runtime")
+		}
+		destroyOpts.KubernetesRuntime.Configure(o.log, o.b)
+		destroyOpts.CurrentClusterName = kubernetesruntime.GetKindClusterName()
+		defer destroyOpts.Run(context.Background()) //nolint:errcheck // Why: Best effort
+	}
 	destroyOpts.Run(ctx) //nolint:errcheck
 
 	os.Setenv("DEVENV_SNAPSHOT_GENERATION", "true") //nolint:errcheck
@@ -408,22 +733,48 @@ func (o *Options) generateSnapshot(ctx context.Context, s3c *s3.Client,
 		return nil, errors.Wrap(err, "failed to create kind runtime")
 	}
 	popts.Base = true
+	if baseItm != nil {
+		popts.Base = false
+		popts.SnapshotTarget = s.Bases[name]
+		popts.SnapshotChannel = channel
+		popts.SnapshotDigest = baseItm.Digest
+	}
 
 	if err := popts.Run(ctx); err != nil {
 		return nil, errors.Wrap(err, "failed to provision devenv")
 	}
 
+	// Need to create a new Kubernetes client that uses the new cluster
+	clients, err := NewOptions(o.log, o.b)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new clients")
+	}
+	o.k, o.r, o.vc = clients.k, clients.r, clients.vc
+
+	if o.b.DeveloperEnvironmentConfig.VaultConfig.Enabled && len(t.DeployApps)+len(t.PostDeployApps) != 0 {
+		if err := vault.EnsureLoggedIn(ctx, o.log, o.b, o.k); err != nil { //nolint:govet // Why: We're OK shadowing err.
+			return nil, errors.Wrap(err, "failed to refresh vault authentication")
+		}
+	}
+
+	// failed returns the applications that were deployed before generating
+	// the snapshot failed along with the error, so they're still reported
+	var deployments []appDeployment
+	failed := func(err error) (*generatedSnapshot, error) {
+		return &generatedSnapshot{
+			Target:      name,
+			Deployments: deployments,
+			Duration:    time.Since(started),
+			Error:       err.Error(),
+		}, err
+	}
+
 	if len(t.DeployApps) != 0 {
 		o.log.Info("Deploying applications into devenv")
-		for _, app := range t.DeployApps {
-			o.log.WithField("application", app).Info("Deploying application")
-			cmd := exec.CommandContext(ctx, os.Args[0], "--skip-update", "apps", "deploy", app) //nolint:gosec
-			cmd.Stderr = os.Stderr
-			cmd.Stdout = os.Stdout
-			cmd.Stdin = os.Stdin
-			if err := cmd.Run(); err != nil { //nolint:govet // Why: We're OK shadowing err.
-				return nil, errors.Wrap(err, "failed to deploy application")
-			}
+		results, err := o.deployApps(ctx, popts.KubernetesRuntime.GetConfig(), t.DeployApps) //nolint:govet // Why: We're OK shadowing err.
+		deployments = append(deployments, results...)
+		if err != nil {
+			return failed(err)
 		}
 	}
 
@@ -431,68 +782,109 @@ func (o *Options) generateSnapshot(ctx context.Context, s3c *s3.Client,
 		o.log.Info("Running snapshot generation command")
 		err = cmdutil.RunKubernetesCommand(ctx, "", false, "/bin/bash", "-c", t.Command)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to run snapshot supplied command")
+			return failed(errors.Wrap(err, "failed to run snapshot supplied command"))
 		}
 	}
 
 	if len(t.PostDeployApps) != 0 {
 		o.log.Info("Deploying applications into devenv")
-		for _, app := range t.PostDeployApps {
-			o.log.WithField("application", app).Info("Deploying application")
-			cmd := exec.CommandContext(ctx, os.Args[0], "--skip-update", "apps", "deploy", app) //nolint:gosec
-			cmd.Stderr = os.Stderr
-			cmd.Stdout = os.Stdout
-			cmd.Stdin = os.Stdin
-			if err := cmd.Run(); err != nil { //nolint:govet // Why: We're OK shadowing err.
-				return nil, errors.Wrap(err, "failed to deploy application")
-			}
+		results, err := o.deployApps(ctx, popts.KubernetesRuntime.GetConfig(), t.PostDeployApps) //nolint:govet // Why: We're OK shadowing err.
+		deployments = append(deployments, results...)
+		if err != nil {
+			return failed(err)
 		}
 	}
 
-	// Need to create a new Kubernetes client that uses the new cluster
-	o, err = NewOptions(o.log, o.b)
+	err = devenvutil.WaitForAllPodsToBeReady(ctx, o.k, o.log)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create new clients")
+		return failed(err)
 	}
 
-	err = devenvutil.WaitForAllPodsToBeReady(ctx, o.k, o.log)
+	// Every application deployed into the devenv is recorded, including ones
+	// deployed by the command and dependencies of the deployed applications
+	deployed, err := apps.NewKubernetesConfigmapClient(o.k, "").List(ctx)
 	if err != nil {
-		return nil, err
+		return failed(errors.Wrap(err, "failed to list deployed applications"))
 	}
+	sort.Slice(deployed, func(i, j int) bool { return deployed[i].Name < deployed[j].Name })
 
 	veleroBackupName, err := o.CreateSnapshot(ctx)
 	if err != nil {
-		return nil, err
+		return failed(err)
 	}
 
 	hash := "unknown"
 	key := "unknown"
-	if !skipUpload {
+	if !skipUpload && o.Chunked {
+		hash, key, err = o.uploadChunkedSnapshot(ctx, s3c, name, t)
+		if err != nil {
+			return failed(errors.Wrap(err, "failed to upload snapshot"))
+		}
+	} else if !skipUpload {
 		hash, key, err = o.uploadSnapshot(ctx, s3c, name, t)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to upload snapshot")
+			return failed(errors.Wrap(err, "failed to upload snapshot"))
 		}
 	}
 
-	return &box.SnapshotLockListItem{
-		Digest:           hash,
-		URI:              key,
-		Config:           t,
-		VeleroBackupName: veleroBackupName,
+	return &generatedSnapshot{
+		Target: name,
+		Item: &box.SnapshotLockListItem{
+			Digest:           hash,
+			URI:              key,
+			Config:           t,
+			VeleroBackupName: veleroBackupName,
+		},
+		Deployments: deployments,
+		Apps:        deployed,
+		Duration:    time.Since(started),
 	}, nil
 }
 
-func (o *Options) CreateSnapshot(ctx context.Context) (string, error) { //nolint:funlen
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+// CreateSnapshot creates a velero backup of the entire developer
+// environment, returning its name.
+func (o *Options) CreateSnapshot(ctx context.Context) (string, error) {
+	backup, err := o.createBackup(ctx, &velerov1api.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: newBackupName(),
+		},
+		Spec: velerov1api.BackupSpec{
+			// Don't include velero, we need to install it before the backup. Skip minio because it's the snapshot backend
+			ExcludedNamespaces: []string{"velero", "minio"},
+			// Skip helm chart resources, since they've already been rendered at
+			// this point.
+			ExcludedResources:       []string{"HelmChart"},
+			SnapshotVolumes:         boolptr.True(),
+			DefaultVolumesToRestic:  boolptr.True(),
+			IncludeClusterResources: boolptr.True(),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
 
-	updates := make(chan *velerov1api.Backup)
-	backupInformer := velerov1.NewBackupInformer(o.vc, noncmdsnapshot.SnapshotNamespace, 0, nil)
+	return backup.Name, nil
+}
 
-	// Create DNS1133 compliant backup name.
-	backupName := strings.ToLower(
+// backupTimeout is how long to wait for a velero backup to finish before
+// giving up on it, e.g. when velero isn't running.
+const backupTimeout = 30 * time.Minute
+
+// newBackupName returns a DNS1133 compliant backup name based on the current time
+func newBackupName() string {
+	return strings.ToLower(
 		strings.ReplaceAll(time.Now().Format(time.RFC3339), ":", "-"),
 	)
+}
+
+// createBackup creates a velero backup and waits for it to finish, returning
+// the backup in its final state.
+func (o *Options) createBackup(ctx context.Context, b *velerov1api.Backup) (*velerov1api.Backup, error) { //nolint:funlen
+	ctx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+
+	updates := make(chan *velerov1api.Backup)
+	backupInformer := velerov1.NewBackupInformer(o.vc, noncmdsnapshot.SnapshotNamespace, 0, nil)
 
 	backupInformer.AddEventHandler(
 		cache.FilteringResourceEventHandler{
@@ -501,7 +893,7 @@ func (o *Options) CreateSnapshot(ctx context.Context) (string, error) { //nolint
 				if !ok {
 					return false
 				}
-				return backup.Name == backupName
+				return backup.Name == b.Name
 			},
 			Handler: cache.ResourceEventHandlerFuncs{
 				UpdateFunc: func(_, obj interface{}) {
@@ -509,37 +901,29 @@ func (o *Options) CreateSnapshot(ctx context.Context) (string, error) { //nolint
 					if !ok {
 						return
 					}
-					updates <- backup
+					select {
+					case updates <- backup:
+					case <-ctx.Done():
+					}
 				},
 				DeleteFunc: func(obj interface{}) {
 					backup, ok := obj.(*velerov1api.Backup)
 					if !ok {
 						return
 					}
-					updates <- backup
+					select {
+					case updates <- backup:
+					case <-ctx.Done():
+					}
 				},
 			},
 		},
 	)
 	go backupInformer.Run(ctx.Done())
 
-	_, err := o.vc.VeleroV1().Backups(noncmdsnapshot.SnapshotNamespace).Create(ctx, &velerov1api.Backup{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: backupName,
-		},
-		Spec: velerov1api.BackupSpec{
-			// Don't include velero, we need to install it before the backup. Skip minio because it's the snapshot backend
-			ExcludedNamespaces: []string{"velero", "minio"},
-			// Skip helm chart resources, since they've already been rendered at
-			// this point.
-			ExcludedResources:       []string{"HelmChart"},
-			SnapshotVolumes:         boolptr.True(),
-			DefaultVolumesToRestic:  boolptr.True(),
-			IncludeClusterResources: boolptr.True(),
-		},
-	}, metav1.CreateOptions{})
+	_, err := o.vc.VeleroV1().Backups(noncmdsnapshot.SnapshotNamespace).Create(ctx, b, metav1.CreateOptions{})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	o.log.Info("Waiting for snapshot to finish being created...")
@@ -547,15 +931,15 @@ func (o *Options) CreateSnapshot(ctx context.Context) (string, error) { //nolint
 	for {
 		select {
 		case <-ctx.Done():
-			return "", ctx.Err()
+			return nil, errors.Wrap(ctx.Err(), "timed out waiting for snapshot to be created")
 		case backup, ok := <-updates:
 			if !ok {
-				return "", fmt.Errorf("failed to create snapshot")
+				return nil, fmt.Errorf("failed to create snapshot")
 			}
 
 			if backup.Status.Phase != velerov1api.BackupPhaseNew && backup.Status.Phase != velerov1api.BackupPhaseInProgress {
 				o.log.Infof("Created snapshot finished with status: %s", backup.Status.Phase)
-				return backupName, nil
+				return backup, nil
 			}
 		}
 	}
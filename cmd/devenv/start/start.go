@@ -119,6 +119,11 @@ func (o *Options) Run(ctx context.Context) error { //nolint:funlen
 		return err
 	}
 
+	// Restore any workloads that were scaled down by 'devenv stop'
+	if err := devenvutil.ResumeWorkloads(ctx, k, o.log); err != nil {
+		return errors.Wrap(err, "failed to scale up workloads")
+	}
+
 	if err := devenvutil.WaitForAllPodsToBeReady(ctx, k, o.log); err != nil {
 		return err
 	}
@@ -0,0 +1,248 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/kubernetestunnelruntime"
+	"github.com/getoutreach/localizer/pkg/localizer"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// dnsLookupTimeout is the timeout for a single DNS lookup
+	dnsLookupTimeout = 2 * time.Second
+
+	// maxDNSHosts is the maximum number of ingress hostnames, and
+	// localizer service names, that are checked.
+	maxDNSHosts = 10
+)
+
+// Resolver resolves hostnames to addresses, this is satisfied by
+// *net.Resolver and can be stubbed out, e.g. in e2e tests.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSFailure is a hostname that failed to resolve to the expected address
+type DNSFailure struct {
+	// Host is the hostname that was resolved
+	Host string `json:"host"`
+
+	// Expected is the address the host was expected to resolve to,
+	// if empty any address is accepted.
+	Expected string `json:"expected,omitempty"`
+
+	// Addresses are the addresses the host resolved to
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Err is the error that occurred when resolving the host, if any
+	Err string `json:"error,omitempty"`
+}
+
+// String returns a human readable description of the failure
+func (f *DNSFailure) String() string {
+	if f.Err != "" {
+		return fmt.Sprintf("%s: %s", f.Host, f.Err)
+	}
+
+	if len(f.Addresses) == 0 {
+		return fmt.Sprintf("%s: no addresses", f.Host)
+	}
+
+	return fmt.Sprintf("%s: resolved to %s, expected %s", f.Host, strings.Join(f.Addresses, ","), f.Expected)
+}
+
+// DNSError is returned by CheckLocalDNSResolution when one, or
+// more, hostnames didn't resolve to their expected addresses
+type DNSError struct {
+	Failures []DNSFailure
+}
+
+// Error implements the error interface
+func (e *DNSError) Error() string {
+	failures := make([]string, len(e.Failures))
+	for i := range e.Failures {
+		failures[i] = e.Failures[i].String()
+	}
+	return strings.Join(failures, "; ")
+}
+
+// dnsCheck is a hostname that should resolve to an address
+type dnsCheck struct {
+	host string
+
+	// expected is the address host should resolve to, if
+	// empty any address is accepted
+	expected string
+}
+
+// resolve checks that a hostname resolves to its expected address,
+// returning a DNSFailure if it doesn't.
+func resolve(ctx context.Context, r Resolver, c dnsCheck) *DNSFailure {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	addrs, err := r.LookupHost(ctx, c.host)
+	if err != nil {
+		return &DNSFailure{Host: c.host, Expected: c.expected, Err: err.Error()}
+	}
+
+	if len(addrs) == 0 {
+		return &DNSFailure{Host: c.host, Expected: c.expected}
+	}
+
+	if c.expected == "" {
+		return nil
+	}
+
+	for _, a := range addrs {
+		if a == c.expected {
+			return nil
+		}
+	}
+
+	return &DNSFailure{Host: c.host, Expected: c.expected, Addresses: addrs}
+}
+
+// ingressDNSChecks returns checks for the hostnames of ingresses, which
+// are written to /etc/hosts by 30-etc-hosts.sh, resolving to the ingress
+// controller.
+func (o *Options) ingressDNSChecks(ctx context.Context) ([]dnsCheck, error) {
+	ip, err := kube.IngressControllerIP(ctx, o.k)
+	if errors.Is(err, kube.ErrIngressControllerNoIP) || kerrors.IsNotFound(err) {
+		// Nothing to check until the ingress controller is deployed and exposed
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ingresses, err := o.k.NetworkingV1().Ingresses(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list ingresses")
+	}
+
+	hosts := make(map[string]bool)
+	for i := range ingresses.Items {
+		for j := range ingresses.Items[i].Spec.Rules {
+			host := ingresses.Items[i].Spec.Rules[j].Host
+			if host == "" || strings.Contains(host, "*") {
+				continue
+			}
+			hosts[host] = true
+		}
+	}
+
+	checks := make([]dnsCheck, 0, len(hosts))
+	for host := range hosts {
+		checks = append(checks, dnsCheck{host: host, expected: ip})
+	}
+
+	return checks, nil
+}
+
+// localizerDNSChecks returns checks for the names of services
+// tunneled by localizer resolving to their tunnel IPs.
+func (o *Options) localizerDNSChecks(ctx context.Context) ([]dnsCheck, error) {
+	if !localizer.IsRunning() {
+		return nil, nil
+	}
+
+	services, err := kubernetestunnelruntime.ListServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]dnsCheck, 0, len(services))
+	for _, s := range services {
+		if s == nil || s.Ip == "" {
+			continue
+		}
+
+		checks = append(checks, dnsCheck{
+			host:     fmt.Sprintf("%s.%s.svc.cluster.local", s.Name, s.Namespace),
+			expected: s.Ip,
+		})
+	}
+
+	return checks, nil
+}
+
+// limitDNSChecks returns a stable subset of at most maxDNSHosts checks
+func limitDNSChecks(checks []dnsCheck) []dnsCheck {
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].host < checks[j].host
+	})
+
+	if len(checks) > maxDNSHosts {
+		return checks[:maxDNSHosts]
+	}
+	return checks
+}
+
+// localhostDNSCheck checks that localhost resolves, without it
+// nothing in the developer environment is reachable
+//
+//nolint:gochecknoglobals // Why: It's a constant check
+var localhostDNSCheck = dnsCheck{host: "localhost"}
+
+// clusterDNSChecks returns the hostnames, of ingresses and services tunneled
+// by localizer, that should be resolvable when the developer environment is healthy.
+func (o *Options) clusterDNSChecks(ctx context.Context) []dnsCheck {
+	// Without a Kubernetes client we can't determine what should resolve
+	if o.k == nil {
+		return nil
+	}
+
+	ingressChecks, err := o.ingressDNSChecks(ctx)
+	if err != nil {
+		o.log.WithError(err).Warn("failed to determine ingress hostnames, skipping their DNS checks")
+	}
+	checks := limitDNSChecks(ingressChecks)
+
+	localizerChecks, err := o.localizerDNSChecks(ctx)
+	if err != nil {
+		o.log.WithError(err).Warn("failed to determine localizer services, skipping their DNS checks")
+	}
+	return append(checks, limitDNSChecks(localizerChecks)...)
+}
+
+// resolveAll runs checks concurrently, returning the failures in the
+// order of the checks
+func resolveAll(ctx context.Context, r Resolver, checks []dnsCheck) []DNSFailure {
+	results := make([]*DNSFailure, len(checks))
+
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = resolve(ctx, r, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failures []DNSFailure
+	for _, f := range results {
+		if f != nil {
+			failures = append(failures, *f)
+		}
+	}
+	return failures
+}
+
+// getResolver returns the resolver to use for DNS checks
+func (o *Options) getResolver() Resolver {
+	if o.Resolver != nil {
+		return o.Resolver
+	}
+	return net.DefaultResolver
+}
@@ -0,0 +1,113 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	dockerclient "github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return addrs, nil
+}
+
+func TestCheckLocalDNSResolution(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	log.Out = io.Discard
+
+	k := fake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "ingress-nginx-controller",
+				Namespace:   "nginx-ingress",
+				Annotations: map[string]string{"devenv.outreach.io/local-ip": "10.0.0.1"},
+			},
+		},
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec: networkingv1.IngressSpec{
+				Rules: []networkingv1.IngressRule{
+					{Host: "app.outreach-dev.com"},
+					{Host: "stale.outreach-dev.com"},
+					{Host: "missing.outreach-dev.com"},
+					{Host: "*.outreach-dev.com"},
+				},
+			},
+		},
+	)
+
+	o := &Options{
+		log: log,
+		k:   k,
+		Resolver: stubResolver{
+			"localhost":              {"127.0.0.1"},
+			"app.outreach-dev.com":   {"10.0.0.1"},
+			"stale.outreach-dev.com": {"127.0.0.1"},
+		},
+	}
+
+	err := o.CheckLocalDNSResolution(ctx)
+	dnsErr, ok := err.(*DNSError)
+	assert.Assert(t, ok, "expected a *DNSError, got %v", err)
+	assert.DeepEqual(t, dnsErr.Failures, []DNSFailure{
+		{Host: "missing.outreach-dev.com", Expected: "10.0.0.1", Err: "no such host missing.outreach-dev.com"},
+		{Host: "stale.outreach-dev.com", Expected: "10.0.0.1", Addresses: []string{"127.0.0.1"}},
+	})
+
+	o.Resolver.(stubResolver)["missing.outreach-dev.com"] = []string{"10.0.0.1"}
+	o.Resolver.(stubResolver)["stale.outreach-dev.com"] = []string{"10.0.0.1"}
+	assert.NilError(t, o.CheckLocalDNSResolution(ctx))
+}
+
+func TestGetStatusOnlyRequiresLocalhost(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	log.Out = io.Discard
+
+	k := fake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "ingress-nginx-controller",
+				Namespace:   "nginx-ingress",
+				Annotations: map[string]string{"devenv.outreach.io/local-ip": "10.0.0.1"},
+			},
+		},
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "missing.outreach-dev.com"}}},
+		},
+	)
+
+	o := &Options{
+		log:      log,
+		k:        k,
+		d:        &dockerclient.Client{},
+		Resolver: stubResolver{"localhost": {"127.0.0.1"}},
+	}
+
+	// Ingress hostnames failing to resolve are only warnings
+	status, err := o.GetStatus(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, status.Status, Running)
+
+	delete(o.Resolver.(stubResolver), "localhost")
+	status, err = o.GetStatus(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, status.Status, Degraded)
+	assert.Equal(t, status.Reason, "local DNS resolution is failing: localhost: no such host localhost")
+}
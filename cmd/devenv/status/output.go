@@ -0,0 +1,289 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getoutreach/devenv/internal/apps"
+	"github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	"github.com/getoutreach/devenv/pkg/kubernetestunnelruntime"
+	"github.com/getoutreach/gobox/pkg/app"
+	"github.com/getoutreach/localizer/pkg/localizer"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Output is the machine readable status of a developer environment
+type Output struct {
+	Status
+
+	// DevenvVersion is the version of the devenv CLI
+	DevenvVersion string `json:"devenvVersion"`
+
+	// Runtime is the status reported by the runtime of the current
+	// context, including its nodes, if one could be found.
+	Runtime *kubernetesruntime.RuntimeStatus `json:"runtime,omitempty"`
+
+	// Nodes are the nodes in the developer environment. These are the
+	// nodes reported by the runtime, or, if it didn't report any, e.g.
+	// because it isn't accessible, the nodes listed from Kubernetes.
+	Nodes []kubernetesruntime.NodeStatus `json:"nodes,omitempty"`
+
+	// Namespaces are the namespaces, and their deployments, in the
+	// developer environment. This is filtered by the namespace options.
+	Namespaces []NamespaceInfo `json:"namespaces,omitempty"`
+
+	// Tunnels are the services tunneled by localizer, this is
+	// empty if localizer isn't running.
+	Tunnels []TunnelInfo `json:"tunnels,omitempty"`
+
+	// Apps are the apps deployed in the developer environment
+	Apps []apps.App `json:"apps,omitempty"`
+
+	// Snapshot is the snapshot the developer environment was provisioned
+	// from, this is empty if it wasn't provisioned from a snapshot.
+	Snapshot *snapshot.Info `json:"snapshot,omitempty"`
+
+	// DNSWarnings are the ingress hostnames, and localizer service names,
+	// that don't resolve to their expected addresses.
+	DNSWarnings []DNSFailure `json:"dnsWarnings,omitempty"`
+}
+
+// NamespaceInfo is information about a namespace in the developer environment
+type NamespaceInfo struct {
+	// Name is the name of the namespace
+	Name string `json:"name"`
+
+	// Deployments are the deployments in the namespace
+	Deployments []DeploymentInfo `json:"deployments"`
+}
+
+// DeploymentInfo is information about a deployment
+type DeploymentInfo struct {
+	// Name is the name of the deployment
+	Name string `json:"name"`
+
+	// Replicas is the number of desired replicas
+	Replicas int32 `json:"replicas"`
+
+	// ReadyReplicas is the number of ready replicas
+	ReadyReplicas int32 `json:"readyReplicas"`
+
+	// Conditions are the conditions of the deployment that are true,
+	// e.g. Available
+	Conditions []string `json:"conditions"`
+
+	// Tunnel is the localizer tunnel for this deployment, if it has one
+	Tunnel *TunnelInfo `json:"tunnel,omitempty"`
+}
+
+// TunnelInfo is information about a service tunneled by localizer
+type TunnelInfo struct {
+	Namespace    string   `json:"namespace"`
+	Name         string   `json:"name"`
+	Status       string   `json:"status"`
+	StatusReason string   `json:"statusReason,omitempty"`
+	Endpoint     string   `json:"endpoint,omitempty"`
+	IP           string   `json:"ip,omitempty"`
+	Ports        []string `json:"ports,omitempty"`
+}
+
+// NotRunningError is returned by Run when the developer
+// environment isn't running
+type NotRunningError struct {
+	Status *Status
+}
+
+// Error implements the error interface
+func (e *NotRunningError) Error() string {
+	if e.Status.Reason != "" {
+		return fmt.Sprintf("developer environment is %s: %s", e.Status.Status, e.Status.Reason)
+	}
+	return fmt.Sprintf("developer environment is %s", e.Status.Status)
+}
+
+// getTunnels returns the services tunneled by localizer, if localizer
+// isn't running, or can't be reached, nil is returned.
+func (o *Options) getTunnels(ctx context.Context) []TunnelInfo {
+	if !localizer.IsRunning() {
+		return nil
+	}
+
+	services, err := kubernetestunnelruntime.ListServices(ctx)
+	if err != nil {
+		o.log.WithError(err).Warn("failed to call localizer list rpc, will not include localizer information in response.")
+		//nolint:lll // Why: Not much we can do here
+		o.log.Warn("if you need localizer information, the following and then rerun:\n\tsudo kill $(pgrep localizer)\n\tsudo rm -f /var/run/localizer.sock\n\tdevenv tunnel")
+		return nil
+	}
+
+	tunnels := make([]TunnelInfo, 0, len(services))
+	for _, s := range services {
+		if s == nil {
+			// Shouldn't ever happen, but panic insurance.
+			continue
+		}
+
+		tunnels = append(tunnels, TunnelInfo{
+			Namespace:    s.Namespace,
+			Name:         s.Name,
+			Status:       s.Status,
+			StatusReason: s.StatusReason,
+			Endpoint:     s.Endpoint,
+			IP:           s.Ip,
+			Ports:        s.Ports,
+		})
+	}
+
+	return tunnels
+}
+
+// getNodes returns the nodes reported by the runtime, falling back to
+// listing them from Kubernetes if the runtime didn't report any.
+func (o *Options) getNodes(ctx context.Context, rs *kubernetesruntime.RuntimeStatus) ([]kubernetesruntime.NodeStatus, error) {
+	if rs != nil && len(rs.Nodes) != 0 {
+		return rs.Nodes, nil
+	}
+
+	var cluster kubernetesruntime.RuntimeStatus
+	if err := kubernetesruntime.GetClusterStatus(ctx, o.k, o.metricsClient(), &cluster); err != nil {
+		return nil, err
+	}
+	return cluster.Nodes, nil
+}
+
+// includeNamespace returns true if a namespace should be included
+// based on the namespace options
+func (o *Options) includeNamespace(name string) bool {
+	if name == "kube-system" && !o.IncludeKubeSystem {
+		return false
+	}
+
+	if o.AllNamespaces {
+		return true
+	}
+
+	for _, ns := range o.Namespaces {
+		if strings.EqualFold(strings.TrimSpace(ns), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getNamespaces returns information about the namespaces, and their
+// deployments, included by the namespace options. Namespaces without
+// deployments are skipped.
+func (o *Options) getNamespaces(ctx context.Context, tunnels []TunnelInfo) ([]NamespaceInfo, error) {
+	namespaces, err := o.k.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list namespaces")
+	}
+
+	infos := make([]NamespaceInfo, 0)
+	for i := range namespaces.Items {
+		name := namespaces.Items[i].Name
+		if !o.includeNamespace(name) {
+			continue
+		}
+
+		deployments, err := o.k.AppsV1().Deployments(name).List(ctx, metav1.ListOptions{}) //nolint:govet // Why: OK w/ err shadow
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list deployments in %s", name)
+		}
+
+		// Skip namespaces who have 0 deployments.
+		if len(deployments.Items) == 0 {
+			continue
+		}
+
+		info := NamespaceInfo{Name: name, Deployments: make([]DeploymentInfo, 0, len(deployments.Items))}
+		for j := range deployments.Items {
+			d := &deployments.Items[j]
+
+			di := DeploymentInfo{
+				Name:          d.Name,
+				ReadyReplicas: d.Status.ReadyReplicas,
+				Conditions:    make([]string, 0),
+			}
+			if d.Spec.Replicas != nil {
+				di.Replicas = *d.Spec.Replicas
+			}
+			for k := range d.Status.Conditions {
+				if d.Status.Conditions[k].Status == corev1.ConditionTrue {
+					di.Conditions = append(di.Conditions, string(d.Status.Conditions[k].Type))
+				}
+			}
+			for k := range tunnels {
+				if tunnels[k].Name == d.Name {
+					di.Tunnel = &tunnels[k]
+				}
+			}
+
+			info.Deployments = append(info.Deployments, di)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// GetOutput returns the full status of the developer environment. Information
+// that can't be retrieved, e.g. because the developer environment isn't
+// running, is omitted.
+func (o *Options) GetOutput(ctx context.Context) (*Output, error) {
+	status, err := o.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Output{
+		Status:        *status,
+		DevenvVersion: app.Info().Version,
+	}
+
+	out.Runtime, err = o.getRuntimeStatus(ctx)
+	if err != nil {
+		o.log.WithError(err).Warn("failed to get runtime status")
+	}
+
+	// Only include Kubernetes information if we're able to reach it
+	if o.k == nil || status.Status == Unprovisioned || status.Status == Unknown {
+		return out, nil
+	}
+
+	out.Nodes, err = o.getNodes(ctx, out.Runtime)
+	if err != nil {
+		o.log.WithError(err).Warn("failed to get node information")
+	}
+
+	out.Tunnels = o.getTunnels(ctx)
+
+	out.Namespaces, err = o.getNamespaces(ctx, out.Tunnels)
+	if err != nil {
+		o.log.WithError(err).Warn("failed to get namespace information")
+	}
+
+	out.Apps, err = apps.NewKubernetesConfigmapClient(o.k, "").List(ctx)
+	if err != nil {
+		o.log.WithError(err).Warn("failed to get deployed apps")
+	}
+	sort.Slice(out.Apps, func(i, j int) bool {
+		return out.Apps[i].Name < out.Apps[j].Name
+	})
+
+	out.Snapshot, err = snapshot.GetInfo(ctx, o.k)
+	if err != nil && !kerrors.IsNotFound(errors.Cause(err)) {
+		o.log.WithError(err).Warn("failed to get snapshot information")
+	}
+
+	out.DNSWarnings = resolveAll(ctx, o.getResolver(), o.clusterDNSChecks(ctx))
+
+	return out, nil
+}
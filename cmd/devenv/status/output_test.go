@@ -0,0 +1,47 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetNodesFallsBackToKubernetes(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	log.Out = io.Discard
+
+	o := &Options{
+		log: log,
+		k:   fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "from-kubernetes"}}),
+	}
+
+	// The runtime's nodes are used when it reports them
+	nodes, err := o.getNodes(ctx, &kubernetesruntime.RuntimeStatus{
+		Nodes: []kubernetesruntime.NodeStatus{{Name: "from-runtime"}},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(nodes), 1)
+	assert.Equal(t, nodes[0].Name, "from-runtime")
+
+	// Otherwise, e.g. if the runtime isn't accessible, they're listed from Kubernetes
+	for _, rs := range []*kubernetesruntime.RuntimeStatus{nil, {}} {
+		nodes, err = o.getNodes(ctx, rs)
+		assert.NilError(t, err)
+		assert.Equal(t, len(nodes), 1)
+		assert.Equal(t, nodes[0].Name, "from-kubernetes")
+	}
+
+	var buf bytes.Buffer
+	o.writeTable(&buf, &Output{Nodes: nodes})
+	assert.Assert(t, strings.Contains(buf.String(), `Node "from-kubernetes" Information`), buf.String())
+}
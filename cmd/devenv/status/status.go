@@ -2,39 +2,37 @@ package status
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"strings"
 	"text/tabwriter"
-	"time"
 
 	dockerclient "github.com/docker/docker/client"
 	"github.com/getoutreach/devenv/pkg/cmdutil"
-	"github.com/getoutreach/devenv/pkg/containerruntime"
+	"github.com/getoutreach/devenv/pkg/config"
 	"github.com/getoutreach/devenv/pkg/kube"
-	"github.com/getoutreach/gobox/pkg/app"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	devenvstatus "github.com/getoutreach/devenv/pkg/status"
+	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/getoutreach/gobox/pkg/trace"
-	localizerapi "github.com/getoutreach/localizer/api"
-	"github.com/getoutreach/localizer/pkg/localizer"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/grpclog"
-	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+	"sigs.k8s.io/yaml"
 )
 
 const (
-	Degraded      = "degraded"
-	Unprovisioned = "unprovisioned"
-	Running       = "running"
-	Stopped       = "stopped"
-	Unknown       = "unknown"
+	Degraded      = devenvstatus.Degraded
+	Unprovisioned = devenvstatus.Unprovisioned
+	Running       = devenvstatus.Running
+	Stopped       = devenvstatus.Stopped
+	Unknown       = devenvstatus.Unknown
 )
 
 //nolint:gochecknoglobals
@@ -47,13 +45,23 @@ var (
 	statusExample = `
 		# View the status of the developer environment
 		devenv status
+
+		# View the status of the developer environment as JSON
+		devenv status -o json
+
+		# View the status of the developer environment, including all namespaces, as YAML
+		devenv status -a -o yaml
+
+		# Keep watching the "bento1a" namespace for pod, deployment and warning event changes
+		devenv status --watch -n bento1a
 	`
 )
 
 type Options struct {
-	log logrus.FieldLogger
-	k   kubernetes.Interface
-	d   dockerclient.APIClient
+	log  logrus.FieldLogger
+	k    kubernetes.Interface
+	conf *rest.Config
+	d    dockerclient.APIClient
 
 	// Quiet denotes if we should output text or not
 	Quiet bool
@@ -69,19 +77,32 @@ type Options struct {
 	// IncludeKubeSystem is a flag that denotes whether or not to
 	// include kube-system in the output of the status command.
 	IncludeKubeSystem bool
+
+	// Output is the format to output the status in, if empty
+	// human readable text is output.
+	Output string
+
+	// Watch streams changes to pods, deployments and Warning events
+	// in the included namespaces after the status is output.
+	Watch bool
+
+	// Resolver is used to check local DNS resolution, if
+	// not set the system resolver is used.
+	Resolver Resolver
 }
 
 func NewOptions(log logrus.FieldLogger) (*Options, error) {
 	//nolint:errcheck // Why: We handle errors
-	k, _ := kube.GetKubeClient()
+	k, conf, _ := kube.GetKubeClientWithConfig()
 
 	//nolint:errcheck // Why: We handle errors
 	d, _ := dockerclient.NewClientWithOpts(dockerclient.FromEnv)
 
 	return &Options{
-		d:   d,
-		k:   k,
-		log: log,
+		d:    d,
+		k:    k,
+		conf: conf,
+		log:  log,
 	}, nil
 }
 
@@ -111,6 +132,17 @@ func NewCmdStatus(log logrus.FieldLogger) *cli.Command {
 				Aliases: []string{"a"},
 				Usage:   "Displays all namespaces in the output.",
 			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format, one of: table, json, yaml",
+				Value:   "table",
+			},
+			&cli.BoolFlag{
+				Name:    "watch",
+				Aliases: []string{"w"},
+				Usage:   "Keep watching for pod, deployment and Warning event changes in the included namespaces",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			o, err := NewOptions(log)
@@ -122,27 +154,16 @@ func NewCmdStatus(log logrus.FieldLogger) *cli.Command {
 			o.Namespaces = c.StringSlice("namespace")
 			o.IncludeKubeSystem = c.Bool("kube-system")
 			o.AllNamespaces = c.Bool("all-namespaces")
+			o.Output = c.String("output")
+			o.Watch = c.Bool("watch")
 
 			return o.Run(c.Context)
 		},
 	}
 }
 
-type Status struct {
-	// Status is the status of the cluster in text format, eventually
-	// will be enum of: running, stopped, unprovisioned, degraded, or unknown
-	Status string
-
-	// Reason is included when a status may need potential
-	// explanation. For now this is just non-running or stopped statuses
-	Reason string
-
-	// KubernetesVersion is the version of the developer environment
-	KubernetesVersion string
-
-	// Version is the version of the developer environment
-	Version string
-}
+// Status is the status of a developer environment, see devenvstatus.Status
+type Status = devenvstatus.Status
 
 // GetStatus determines the status of a developer environment
 // nolint:funlen
@@ -178,10 +199,11 @@ func (o *Options) GetStatus(ctx context.Context) (*Status, error) {
 		return status, nil
 	}
 
-	err = o.CheckLocalDNSResolution(ctx)
-	if err != nil {
+	// Only localhost is required, ingress and localizer DNS failures are
+	// reported as warnings by GetOutput
+	if f := resolve(ctx, o.getResolver(), localhostDNSCheck); f != nil {
 		status.Status = Degraded
-		status.Reason = errors.Wrap(err, "local DNS resolution is failing").Error()
+		status.Reason = errors.Wrap(&DNSError{Failures: []DNSFailure{*f}}, "local DNS resolution is failing").Error()
 		return status, nil
 	}
 
@@ -193,210 +215,199 @@ func (o *Options) GetStatus(ctx context.Context) (*Status, error) {
 	return status, nil
 }
 
-func (o *Options) CheckLocalDNSResolution(ctx context.Context) error { //nolint:funlen
+// CheckLocalDNSResolution checks that localhost, the hostnames of ingresses and
+// the names of services tunneled by localizer resolve to their expected addresses.
+// If any don't, a *DNSError is returned containing each failure.
+func (o *Options) CheckLocalDNSResolution(ctx context.Context) error {
 	ctx = trace.StartCall(ctx, "status.CheckLocalDNSResolution")
 	defer trace.EndCall(ctx)
 
-	addrs, err := net.LookupHost("localhost")
-	if err != nil {
-		return errors.Wrap(err, "localhost lookup failed")
-	}
-
-	if len(addrs) == 0 {
-		return fmt.Errorf("localhost had no addresses")
+	checks := append([]dnsCheck{localhostDNSCheck}, o.clusterDNSChecks(ctx)...)
+	if failures := resolveAll(ctx, o.getResolver(), checks); len(failures) != 0 {
+		return &DNSError{Failures: failures}
 	}
 
 	return nil
 }
 
-func (o *Options) kubernetesInfo(ctx context.Context, w io.Writer) error { //nolint:funlen,gocyclo
-	nodes, err := o.k.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+// getRuntimeStatus returns the status of the runtime of the current
+// context, if the runtime isn't accessible nil is returned.
+func (o *Options) getRuntimeStatus(ctx context.Context) (*kubernetesruntime.RuntimeStatus, error) {
+	b, err := box.LoadBox()
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "failed to load box configuration")
 	}
 
-	namespaces, err := o.k.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	conf, err := config.LoadConfig(ctx)
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "failed to load config")
 	}
 
-	var localizerResp *localizerapi.ListResponse
-	if localizer.IsRunning() {
-		// Turn off info and warning level logging for gRPC because it's nosiy and we handle it
-		// from a higher level anyways.
-		grpclog.SetLoggerV2(grpclog.NewLoggerV2(io.Discard, io.Discard, os.Stdout))
-
-		// We block on the connection, so only try for 2 seconds before moving on. This should
-		// be fine if localizer is actually running because its communicating over the local
-		// network.
-		gCtx, cancel := context.WithTimeout(ctx, time.Second*2)
-
-		client, closer, err := localizer.Connect(gCtx,
-			grpc.WithBlock(), grpc.WithTransportCredentials(insecure.NewCredentials())) //nolint:govet // Why: It's okay to shadow the error here.
-		if err == nil {
-			defer closer()
-
-			if localizerResp, err = client.List(ctx, &localizerapi.ListRequest{}); err != nil {
-				// Fail silently, we warn below.
-				localizerResp = nil
-			}
-		}
-
-		if localizerResp == nil {
-			//nolint:lll // Why: Not much we can do here
-			o.log.WithError(err).Warn("failed to call localizer list rpc, will not include localizer information in response.")
-			//nolint:lll // Why: Not much we can do here
-			o.log.Warn("if you need localizer information, the following and then rerun:\n\tsudo kill $(pgrep localizer)\n\tsudo rm -f /var/run/localizer.sock\n\tdevenv tunnel")
-		}
+	r, err := kubernetesruntime.GetRuntimeFromContext(conf, b)
+	if err != nil {
+		return nil, err
+	}
+	r.Configure(o.log, b)
 
-		// Cancel just for the sake of cancelling.
-		cancel()
+	if isAccessible, err := r.IsAccessible(ctx); err != nil { //nolint:govet // Why: OK w/ err shadow
+		return nil, errors.Wrapf(err, "failed to check runtime %s availability", r.GetConfig().Name)
+	} else if !isAccessible {
+		return nil, nil
 	}
 
-	for i := range nodes.Items {
-		if nodes.Items[i].Name != containerruntime.ContainerName {
-			continue
+	rs := r.Status(ctx)
+	if rs.Status.Status == Running && o.k != nil {
+		if err := kubernetesruntime.GetClusterStatus(ctx, o.k, o.metricsClient(), &rs); err != nil { //nolint:govet // Why: OK w/ err shadow
+			o.log.WithError(err).Warn("failed to get cluster node information")
 		}
+	}
 
-		capacity := &nodes.Items[i].Status.Capacity
-		allocatable := &nodes.Items[i].Status.Allocatable
+	return &rs, nil
+}
 
-		fmt.Fprintf(w, "\nNode \"%s\" Information:\n---\n", containerruntime.ContainerName)
+// metricsClient returns a metrics-server client, metrics-server is
+// optional so nil is returned if one can't be created.
+func (o *Options) metricsClient() metricsclient.Interface {
+	if o.conf == nil {
+		return nil
+	}
 
-		fmt.Fprintln(w, "Resources (capacity/allocatable):")
-		fmt.Fprintf(w, "\tCPU: %s/%s\n", capacity.Cpu(), allocatable.Cpu())
-		fmt.Fprintf(w, "\tMemory: %s/%s\n", capacity.Memory(), allocatable.Memory())
-		fmt.Fprintf(w, "\tStorage (Ephemeral): %s/%s\n", capacity.StorageEphemeral(), allocatable.StorageEphemeral())
-		fmt.Fprintf(w, "\tPods: %s/%s\n", capacity.Pods(), allocatable.Pods())
+	mc, err := metricsclient.NewForConfig(o.conf)
+	if err != nil {
+		return nil
+	}
+	return mc
+}
 
-		fmt.Fprintln(w, "Conditions:")
-		for j := range nodes.Items[i].Status.Conditions {
-			//nolint:lll // Why: Not much we can do here
-			fmt.Fprintf(w, "\t%s: %s (%s)\n", nodes.Items[i].Status.Conditions[j].Type, nodes.Items[i].Status.Conditions[j].Status, nodes.Items[i].Status.Conditions[j].Message)
-		}
+// writeTable writes the status in a human readable format
+func (o *Options) writeTable(w io.Writer, out *Output) { //nolint:funlen
+	fmt.Fprintln(w, "Overall Status:\n---")
+	fmt.Fprintf(w, "Status: %s\n", out.Status.Status)
+	fmt.Fprintf(w, "Devenv Version: %s\n", out.DevenvVersion)
+	if out.Reason != "" {
+		fmt.Fprintf(w, "Reason: %s\n", out.Reason)
+	}
 
-		fmt.Fprintf(w, "Images Deployed: %d\n", len(nodes.Items[i].Status.Images))
-		break
+	if out.Version != "" {
+		fmt.Fprintf(w, "Running devenv Version: %s\n", out.Version)
+	}
+	if out.KubernetesVersion != "" {
+		fmt.Fprintf(w, "Kubernetes Version: %s\n", out.KubernetesVersion)
+	}
+	if out.Snapshot != nil {
+		fmt.Fprintf(w, "Snapshot: %s (%s) %s\n", out.Snapshot.Target, out.Snapshot.Channel, out.Snapshot.Digest)
 	}
 
-	for i := range namespaces.Items {
-		if namespaces.Items[i].Name == "kube-system" {
-			if !o.IncludeKubeSystem {
-				continue
-			}
+	if len(out.DNSWarnings) != 0 {
+		fmt.Fprintln(w, "\nDNS Warnings:\n---")
+		for i := range out.DNSWarnings {
+			fmt.Fprintln(w, out.DNSWarnings[i].String())
 		}
+	}
 
-		var included bool
-		if o.AllNamespaces {
-			included = true
-		} else {
-			for j := range o.Namespaces {
-				if strings.EqualFold(strings.TrimSpace(o.Namespaces[j]), namespaces.Items[i].Name) {
-					included = true
-					break
-				}
-			}
-		}
+	for i := range out.Nodes {
+		n := &out.Nodes[i]
 
-		if !included {
-			continue
-		}
+		fmt.Fprintf(w, "\nNode \"%s\" Information:\n---\n", n.Name)
 
-		deployments, err := o.k.AppsV1().Deployments(namespaces.Items[i].Name).
-			List(ctx, metav1.ListOptions{}) //nolint:govet // why: it's okay to shadow the error variable here
-		if err != nil {
-			return err
+		fmt.Fprintln(w, "Resources (capacity/allocatable):")
+		fmt.Fprintf(w, "\tCPU: %s/%s\n", n.Capacity.Cpu(), n.Allocatable.Cpu())
+		fmt.Fprintf(w, "\tMemory: %s/%s\n", n.Capacity.Memory(), n.Allocatable.Memory())
+		fmt.Fprintf(w, "\tStorage (Ephemeral): %s/%s\n", n.Capacity.StorageEphemeral(), n.Allocatable.StorageEphemeral())
+		fmt.Fprintf(w, "\tPods: %s/%s\n", n.Capacity.Pods(), n.Allocatable.Pods())
+
+		if len(n.Usage) != 0 {
+			fmt.Fprintln(w, "Usage:")
+			fmt.Fprintf(w, "\tCPU: %s\n", n.Usage.Cpu())
+			fmt.Fprintf(w, "\tMemory: %s\n", n.Usage.Memory())
 		}
 
-		// Skip namespaces who have 0 deployments.
-		if len(deployments.Items) == 0 {
-			continue
+		fmt.Fprintln(w, "Conditions:")
+		for j := range n.Conditions {
+			fmt.Fprintf(w, "\t%s: %s (%s)\n", n.Conditions[j].Type, n.Conditions[j].Status, n.Conditions[j].Message)
 		}
 
-		fmt.Fprintf(w, "\n\nNamespace \"%s\" Deployments:\n---\n", namespaces.Items[i].Name)
-
-		for j := range deployments.Items {
-			fmt.Fprintf(w, "%s [ ", deployments.Items[j].Name)
-
-			for k := range deployments.Items[j].Status.Conditions {
-				if deployments.Items[j].Status.Conditions[k].Status == v1.ConditionTrue {
-					fmt.Fprintf(w, "%s ", deployments.Items[j].Status.Conditions[k].Type)
-				}
+		if len(n.Taints) != 0 {
+			fmt.Fprintln(w, "Taints:")
+			for _, t := range n.Taints {
+				fmt.Fprintf(w, "\t%s\n", t)
 			}
+		}
 
-			fmt.Fprint(w, "]\n")
+		fmt.Fprintf(w, "Images Deployed: %d\n", n.Images)
+	}
 
-			if localizerResp != nil {
-				for k := range localizerResp.Services {
-					if localizerResp.Services[k] == nil {
-						// Shouldn't ever happen, but panic insurance.
-						continue
-					}
+	if len(out.Apps) != 0 {
+		fmt.Fprintln(w, "\nDeployed Apps:\n---")
+		for i := range out.Apps {
+			fmt.Fprintf(w, "%s\t%s\n", out.Apps[i].Name, out.Apps[i].Version)
+		}
+	}
 
-					service := localizerResp.Services[k]
+	for i := range out.Namespaces {
+		ns := &out.Namespaces[i]
 
-					if localizerResp.Services[k].Name == deployments.Items[j].Name {
-						fmt.Fprintf(w, "-> Status: %s [%s] <localizer>\n", service.Status, service.StatusReason)
-						fmt.Fprintf(w, "-> Endpoint: %s <localizer>\n", service.Endpoint)
-						fmt.Fprintf(w, "-> IP: %s <localizer>\n", service.Ip)
-						fmt.Fprintf(w, "-> Ports: %s <localizer>\n", service.Ports)
-					}
-				}
+		fmt.Fprintf(w, "\n\nNamespace \"%s\" Deployments:\n---\n", ns.Name)
+		for j := range ns.Deployments {
+			d := &ns.Deployments[j]
+			fmt.Fprintf(w, "%s [ %s ]\n", d.Name, strings.Join(d.Conditions, " "))
+
+			if d.Tunnel != nil {
+				fmt.Fprintf(w, "-> Status: %s [%s] <localizer>\n", d.Tunnel.Status, d.Tunnel.StatusReason)
+				fmt.Fprintf(w, "-> Endpoint: %s <localizer>\n", d.Tunnel.Endpoint)
+				fmt.Fprintf(w, "-> IP: %s <localizer>\n", d.Tunnel.IP)
+				fmt.Fprintf(w, "-> Ports: %s <localizer>\n", d.Tunnel.Ports)
 			}
 		}
 	}
-
-	return nil
 }
 
-func (o *Options) Run(ctx context.Context) error { //nolint:funlen,gocyclo
-	target := io.Writer(os.Stdout)
-	if o.Quiet {
-		target = io.Discard
-	}
-
-	w := tabwriter.NewWriter(target, 10, 0, 5, ' ', 0)
-
-	status, err := o.GetStatus(ctx)
+// Run runs the status command, if the developer environment
+// isn't running a *NotRunningError is returned. With Watch, changes
+// are streamed until ctx is canceled.
+func (o *Options) Run(ctx context.Context) error {
+	out, err := o.GetOutput(ctx)
 	if err != nil {
 		return err
 	}
 
-	fmt.Fprintln(w, "Overall Status:\n---")
-	fmt.Fprintf(w, "Status: %s\n", status.Status)
-	fmt.Fprintf(w, "Devenv Version: %s\n", app.Info().Version)
-	if status.Reason != "" {
-		fmt.Fprintf(w, "Reason: %s\n", status.Reason)
-	}
-
-	if status.Version != "" {
-		fmt.Fprintf(w, "Running devenv Version: %s\n", status.Version)
-	}
-	if status.KubernetesVersion != "" {
-		fmt.Fprintf(w, "Kubernetes Version: %s\n", status.KubernetesVersion)
+	target := io.Writer(os.Stdout)
+	if o.Quiet {
+		target = io.Discard
 	}
-	// Only show Kubernetes info if we were able to make a client
-	if o.k != nil {
-		fmt.Fprintln(w, "\ndevenv kubectl top nodes output:\n---")
 
-		err = cmdutil.RunKubernetesCommand(ctx, "", false, "kubectl", "top", "nodes")
-		if err != nil {
-			o.log.WithError(err).Warn("kubectl metrics unavailable currently, check again later")
+	switch o.Output {
+	case "json":
+		enc := json.NewEncoder(target)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return errors.Wrap(err, "failed to encode status")
 		}
-
-		err = o.kubernetesInfo(ctx, w)
+	case "yaml":
+		b, err := yaml.Marshal(out)
 		if err != nil {
+			return errors.Wrap(err, "failed to encode status")
+		}
+		if _, err := target.Write(b); err != nil {
 			return err
 		}
+	case "", "table":
+		w := tabwriter.NewWriter(target, 10, 0, 5, ' ', 0)
+		o.writeTable(w, out)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output format '%s'", o.Output)
 	}
 
-	if err := w.Flush(); err != nil { //nolint:govet // We're. OK. Shadowing. Error.
-		return err
+	if out.Status.Status != Running {
+		return &NotRunningError{Status: &out.Status}
 	}
 
-	if status.Status != "running" {
-		os.Exit(1) //nolint:gocritic
+	if o.Watch {
+		return o.WatchChanges(ctx, target)
 	}
 
-	return err
+	return nil
 }
@@ -0,0 +1,290 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+// WatchEvent is a change in the developer environment streamed by --watch
+type WatchEvent struct {
+	// Time is when the change was observed
+	Time time.Time `json:"time"`
+
+	// Kind is the kind of the resource that changed, e.g. Pod
+	Kind string `json:"kind"`
+
+	// Namespace is the namespace of the resource that changed
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the resource that changed
+	Name string `json:"name"`
+
+	// Message describes the change
+	Message string `json:"message"`
+}
+
+// podPhaseChange returns a message describing the phase transition
+// of a pod, or false if the phase didn't change.
+func podPhaseChange(oldPod, newPod *corev1.Pod) (string, bool) {
+	if oldPod.Status.Phase == newPod.Status.Phase {
+		return "", false
+	}
+
+	msg := fmt.Sprintf("phase %s -> %s", oldPod.Status.Phase, newPod.Status.Phase)
+	if newPod.Status.Reason != "" {
+		msg += fmt.Sprintf(" (%s)", newPod.Status.Reason)
+	}
+	return msg, true
+}
+
+// deploymentConditionChanges returns messages describing the conditions
+// of a deployment that were added, changed status or removed.
+func deploymentConditionChanges(oldDeploy, newDeploy *appsv1.Deployment) []string {
+	oldConditions := make(map[appsv1.DeploymentConditionType]corev1.ConditionStatus)
+	for i := range oldDeploy.Status.Conditions {
+		oldConditions[oldDeploy.Status.Conditions[i].Type] = oldDeploy.Status.Conditions[i].Status
+	}
+
+	msgs := make([]string, 0)
+	for i := range newDeploy.Status.Conditions {
+		c := &newDeploy.Status.Conditions[i]
+
+		oldStatus, ok := oldConditions[c.Type]
+		delete(oldConditions, c.Type)
+		if ok && oldStatus == c.Status {
+			continue
+		}
+		if !ok {
+			oldStatus = corev1.ConditionUnknown
+		}
+
+		msg := fmt.Sprintf("condition %s %s -> %s", c.Type, oldStatus, c.Status)
+		if c.Reason != "" {
+			msg += fmt.Sprintf(" (%s)", c.Reason)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	removed := make([]string, 0, len(oldConditions))
+	for t := range oldConditions {
+		removed = append(removed, fmt.Sprintf("condition %s removed", t))
+	}
+	sort.Strings(removed)
+
+	return append(msgs, removed...)
+}
+
+// warningEvent converts a Kubernetes event into a WatchEvent if it is a
+// Warning that occurred after since.
+func warningEvent(e *corev1.Event, since time.Time) (WatchEvent, bool) {
+	// Event timestamps are only precise to the second
+	t := kube.EventTime(e)
+	if e.Type != corev1.EventTypeWarning || t.Before(since.Truncate(time.Second)) {
+		return WatchEvent{}, false
+	}
+
+	msg := fmt.Sprintf("%s: %s", e.Reason, e.Message)
+	if e.Count > 1 {
+		msg += fmt.Sprintf(" (x%d)", e.Count)
+	}
+
+	return WatchEvent{
+		Time:      t,
+		Kind:      e.InvolvedObject.Kind,
+		Namespace: e.Namespace,
+		Name:      e.InvolvedObject.Name,
+		Message:   msg,
+	}, true
+}
+
+// createdAfter returns true if an object was created after since, this
+// is used to ignore the objects an informer lists when it starts.
+func createdAfter(obj metav1.Object, since time.Time) bool {
+	// Creation timestamps are only precise to the second
+	return !obj.GetCreationTimestamp().Time.Before(since.Truncate(time.Second))
+}
+
+// watchHandlers returns event handlers for pods, deployments and events that
+// send changes in the included namespaces to events.
+//nolint:funlen // Why: Handlers are simple, splitting them up doesn't help
+func (o *Options) watchHandlers(ctx context.Context, since time.Time,
+	events chan<- WatchEvent) (pods, deployments, warnings cache.ResourceEventHandler) {
+	send := func(e WatchEvent) {
+		if !o.includeNamespace(e.Namespace) {
+			return
+		}
+
+		select {
+		case events <- e:
+		case <-ctx.Done():
+		}
+	}
+
+	pods = cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p, ok := obj.(*corev1.Pod)
+			if !ok || !createdAfter(p, since) {
+				return
+			}
+			send(WatchEvent{Time: time.Now(), Kind: "Pod", Namespace: p.Namespace, Name: p.Name,
+				Message: fmt.Sprintf("created (phase %s)", p.Status.Phase)})
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			newPod, ok := newObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+
+			if msg, changed := podPhaseChange(oldPod, newPod); changed {
+				send(WatchEvent{Time: time.Now(), Kind: "Pod", Namespace: newPod.Namespace, Name: newPod.Name, Message: msg})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			p, ok := obj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			send(WatchEvent{Time: time.Now(), Kind: "Pod", Namespace: p.Namespace, Name: p.Name, Message: "deleted"})
+		},
+	}
+
+	deployments = cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			d, ok := obj.(*appsv1.Deployment)
+			if !ok || !createdAfter(d, since) {
+				return
+			}
+			send(WatchEvent{Time: time.Now(), Kind: "Deployment", Namespace: d.Namespace, Name: d.Name, Message: "created"})
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldDeploy, ok := oldObj.(*appsv1.Deployment)
+			if !ok {
+				return
+			}
+			newDeploy, ok := newObj.(*appsv1.Deployment)
+			if !ok {
+				return
+			}
+
+			for _, msg := range deploymentConditionChanges(oldDeploy, newDeploy) {
+				send(WatchEvent{Time: time.Now(), Kind: "Deployment", Namespace: newDeploy.Namespace, Name: newDeploy.Name, Message: msg})
+			}
+		},
+	}
+
+	onEvent := func(obj interface{}) {
+		e, ok := obj.(*corev1.Event)
+		if !ok {
+			return
+		}
+		if we, ok := warningEvent(e, since); ok {
+			send(we)
+		}
+	}
+	warnings = cache.ResourceEventHandlerFuncs{
+		AddFunc: onEvent,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldEvent, ok := oldObj.(*corev1.Event)
+			if !ok {
+				return
+			}
+			newEvent, ok := newObj.(*corev1.Event)
+			if !ok {
+				return
+			}
+
+			// Resyncs, and other no-op updates, aren't new occurrences
+			if oldEvent.Count == newEvent.Count && kube.EventTime(oldEvent).Equal(kube.EventTime(newEvent)) {
+				return
+			}
+			onEvent(newEvent)
+		},
+	}
+
+	return pods, deployments, warnings
+}
+
+// writeWatchEvent writes a WatchEvent in the configured output format
+func (o *Options) writeWatchEvent(w io.Writer, e *WatchEvent) error {
+	switch o.Output {
+	case "json":
+		// One event per line, so the output can be streamed into e.g. jq
+		return json.NewEncoder(w).Encode(e)
+	case "yaml":
+		b, err := yaml.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "---\n%s", b)
+		return err
+	default:
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s\n", e.Time.Format("15:04:05"), e.Kind, e.Namespace, e.Name, e.Message)
+		return err
+	}
+}
+
+// WatchChanges streams pod phase transitions, deployment condition changes and
+// Warning events in the included namespaces to w until ctx is canceled.
+func (o *Options) WatchChanges(ctx context.Context, w io.Writer) error {
+	if !o.AllNamespaces && len(o.Namespaces) == 0 {
+		o.log.Warn("No namespaces selected, use --namespace or --all-namespaces to watch for changes")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	since := time.Now()
+	events := make(chan WatchEvent, 100)
+	pods, deployments, warnings := o.watchHandlers(ctx, since, events)
+
+	factory := informers.NewSharedInformerFactory(o.k, 0)
+	factory.Core().V1().Pods().Informer().AddEventHandler(pods)
+	factory.Apps().V1().Deployments().Informer().AddEventHandler(deployments)
+	factory.Core().V1().Events().Informer().AddEventHandler(warnings)
+
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			// Canceling while starting isn't an error
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to watch %v", informerType)
+		}
+	}
+
+	if o.Output == "" || o.Output == "table" {
+		fmt.Fprintln(w, "\nWatching for changes, press Ctrl+C to exit:\n---")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-events:
+			if err := o.writeWatchEvent(w, &e); err != nil {
+				return errors.Wrap(err, "failed to write event")
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodPhaseChange(t *testing.T) {
+	oldPod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}}
+	newPod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}}
+
+	msg, changed := podPhaseChange(oldPod, newPod)
+	assert.Assert(t, changed)
+	assert.Equal(t, msg, "phase Pending -> Failed (Evicted)")
+
+	_, changed = podPhaseChange(newPod, newPod)
+	assert.Assert(t, !changed)
+}
+
+func TestDeploymentConditionChanges(t *testing.T) {
+	oldDeploy := &appsv1.Deployment{Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+		{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue},
+		{Type: appsv1.DeploymentReplicaFailure, Status: corev1.ConditionTrue},
+	}}}
+	newDeploy := &appsv1.Deployment{Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse, Reason: "MinimumReplicasUnavailable"},
+		{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue},
+	}}}
+
+	assert.DeepEqual(t, deploymentConditionChanges(oldDeploy, newDeploy), []string{
+		"condition Available True -> False (MinimumReplicasUnavailable)",
+		"condition ReplicaFailure removed",
+	})
+	assert.DeepEqual(t, deploymentConditionChanges(newDeploy, newDeploy), []string{})
+}
+
+func TestWarningEvent(t *testing.T) {
+	since := time.Now()
+	e := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "app"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "app-1234"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		Count:          3,
+		LastTimestamp:  metav1.NewTime(since.Add(time.Second)),
+	}
+
+	we, ok := warningEvent(e, since)
+	assert.Assert(t, ok)
+	assert.Equal(t, we.Kind, "Pod")
+	assert.Equal(t, we.Namespace, "app")
+	assert.Equal(t, we.Name, "app-1234")
+	assert.Equal(t, we.Message, "BackOff: Back-off restarting failed container (x3)")
+
+	// Events that occurred before the watch started are ignored
+	e.LastTimestamp = metav1.NewTime(since.Add(-time.Minute))
+	_, ok = warningEvent(e, since)
+	assert.Assert(t, !ok)
+
+	e.LastTimestamp = metav1.NewTime(since.Add(time.Second))
+	e.Type = corev1.EventTypeNormal
+	_, ok = warningEvent(e, since)
+	assert.Assert(t, !ok)
+}
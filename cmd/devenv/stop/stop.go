@@ -6,6 +6,8 @@ import (
 	"github.com/getoutreach/devenv/pkg/cmdutil"
 	"github.com/getoutreach/devenv/pkg/config"
 	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -16,15 +18,23 @@ import (
 var (
 	stopLongDesc = `
 		Stop stops your developer environment. This includes your Kubernetes leader node, and the containers it created.
+
+		For local developer environments, workloads are gracefully scaled down before the node is stopped so that databases are able to flush their data. They are scaled back up by 'devenv start'.
 	`
 	stopExample = `
 		# Stop your running developer environment
 		devenv stop
+
+		# Stop your running developer environment without scaling down workloads first
+		devenv stop --force
 	`
 )
 
 type Options struct {
 	log logrus.FieldLogger
+
+	// Force skips gracefully scaling down workloads before stopping
+	Force bool
 }
 
 func NewOptions(log logrus.FieldLogger) (*Options, error) {
@@ -38,12 +48,18 @@ func NewCmdStop(log logrus.FieldLogger) *cli.Command {
 		Name:        "stop",
 		Usage:       "Stop your running developer environment",
 		Description: cmdutil.NewDescription(stopLongDesc, stopExample),
-		Flags:       []cli.Flag{},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Stop without gracefully scaling down workloads first",
+			},
+		},
 		Action: func(c *cli.Context) error {
 			o, err := NewOptions(log)
 			if err != nil {
 				return err
 			}
+			o.Force = c.Bool("force")
 
 			return o.Run(c.Context)
 		},
@@ -71,6 +87,18 @@ func (o *Options) Run(ctx context.Context) error {
 		return err
 	}
 
+	if !o.Force && kr.GetConfig().Type == kubernetesruntime.RuntimeTypeLocal {
+		k, err := kube.GetKubeClient()
+		if err != nil {
+			return errors.Wrap(err, "failed to create kubernetes client")
+		}
+
+		o.log.Info("Scaling down workloads ...")
+		if err := devenvutil.SuspendWorkloads(ctx, k, o.log); err != nil {
+			return errors.Wrap(err, "failed to scale down workloads, use --force to skip")
+		}
+	}
+
 	o.log.Info("Stopping Developer Environment ...")
 	if err := kr.Stop(ctx); err != nil {
 		return errors.Wrap(err, "failed to stop developer environment")
@@ -0,0 +1,106 @@
+package supportbundle
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// redacted replaces secrets in support bundles
+const redacted = "REDACTED"
+
+// secretKey matches keys whose values are secrets, e.g. ngrok's authtoken,
+// VAULT_TOKEN or AWS_SECRET_ACCESS_KEY, optionally quoted.
+const secretKey = `"?[A-Za-z0-9_.-]*(?:token|secret|password|passwd|access[_-]?key|private[_-]?key|api[_-]?key|credentials?)[A-Za-z0-9_.-]*"?`
+
+// secretKeyPattern matches secret keys followed by a value on the same line
+// in YAML, JSON, or environment variable (KEY=value) form.
+//nolint:gochecknoglobals // Why: Compiled once
+var secretKeyPattern = regexp.MustCompile(
+	`(?i)(` + secretKey + `[ \t]*[:=][ \t]*)("[^"\n]*"|'[^'\n]*'|[^\s,}]+)`)
+
+// secretBlockPattern matches YAML secret keys whose values are on the lines
+// after them, i.e. block scalars ("password: |") or nested mappings.
+//nolint:gochecknoglobals // Why: Compiled once
+var secretBlockPattern = regexp.MustCompile(
+	`(?i)^([ \t-]*)(` + secretKey + `[ \t]*:)[ \t]*(?:[|>][-+0-9]*)?[ \t]*(?:#.*)?$`)
+
+// secretValuePatterns match secrets by their format, regardless of where they are
+//nolint:gochecknoglobals // Why: Compiled once
+var secretValuePatterns = []*regexp.Regexp{
+	// AWS access key IDs
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`),
+
+	// Vault tokens
+	regexp.MustCompile(`\bhv[sbr]\.[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`\bs\.[A-Za-z0-9]{24}\b`),
+
+	// ngrok auth tokens
+	regexp.MustCompile(`\b[0-9][A-Za-z0-9]{20,}_[A-Za-z0-9]{15,}\b`),
+}
+
+// Redact removes secrets from data
+func Redact(data []byte) []byte {
+	// Multi-line values are redacted first, as their block scalar
+	// indicators would otherwise be redacted as if they were the value
+	data = redactBlocks(data)
+
+	data = secretKeyPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		sub := secretKeyPattern.FindSubmatch(match)
+		value := sub[2]
+
+		// Keep quoting intact, so structured files are still valid
+		switch value[0] {
+		case '"', '\'':
+			return append(append(append([]byte{}, sub[1]...), value[0]), append([]byte(redacted), value[0])...)
+		}
+		return append(append([]byte{}, sub[1]...), []byte(redacted)...)
+	})
+
+	for _, p := range secretValuePatterns {
+		data = p.ReplaceAll(data, []byte(redacted))
+	}
+
+	return data
+}
+
+// redactBlocks replaces the values of YAML secret keys that span multiple
+// lines, i.e. block scalars and nested mappings, with a single redacted value.
+func redactBlocks(data []byte) []byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(lines); i++ {
+		sub := secretBlockPattern.FindSubmatch(bytes.TrimRight(lines[i], "\r\n"))
+		if sub == nil {
+			out = append(out, lines[i]...)
+			continue
+		}
+
+		// The value is every line after the key that's indented more than
+		// it, blank lines after the value aren't part of it
+		indent := len(sub[1])
+		end := i + 1
+		for j := i + 1; j < len(lines); j++ {
+			content := bytes.TrimLeft(lines[j], " \t")
+			if len(bytes.TrimSpace(content)) == 0 {
+				continue
+			}
+			if len(lines[j])-len(content) <= indent {
+				break
+			}
+			end = j + 1
+		}
+
+		// Keys without a value on the lines after them are empty
+		if end == i+1 {
+			out = append(out, lines[i]...)
+			continue
+		}
+
+		out = append(append(append(out, sub[1]...), sub[2]...), " "+redacted...)
+		if bytes.HasSuffix(lines[end-1], []byte("\n")) {
+			out = append(out, '\n')
+		}
+		i = end - 1
+	}
+	return out
+}
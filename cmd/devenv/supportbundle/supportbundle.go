@@ -0,0 +1,337 @@
+// Package supportbundle implements the support-bundle devenv command
+package supportbundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getoutreach/devenv/cmd/devenv/status"
+	"github.com/getoutreach/devenv/internal/apps"
+	"github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/gobox/pkg/app"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+//nolint:gochecknoglobals
+var (
+	supportBundleLongDesc = `
+		Support-bundle gathers information about your developer environment into a tarball that can be attached to a support request.
+
+		This includes the devenv version and configuration, the status of the runtime, nodes, pods and localizer, events, deployed apps, snapshot and Velero information, and recent devenv invocations. Secrets, e.g. tokens and AWS keys, are redacted.
+	`
+	supportBundleExample = `
+		# Create a support bundle in the current directory
+		devenv support-bundle
+
+		# Create a support bundle at a specific path
+		devenv support-bundle --output /tmp/devenv.tar.gz
+	`
+)
+
+// Options are the options for the support-bundle command
+type Options struct {
+	log  logrus.FieldLogger
+	k    kubernetes.Interface
+	conf *rest.Config
+
+	// Output is the path to write the support bundle to
+	Output string
+}
+
+// NewOptions creates a new options struct for the support-bundle command.
+// A support bundle is still useful when Kubernetes isn't reachable, so
+// failing to create a client isn't an error.
+func NewOptions(log logrus.FieldLogger) (*Options, error) {
+	//nolint:errcheck // Why: We handle a nil client
+	k, conf, _ := kube.GetKubeClientWithConfig()
+
+	return &Options{
+		log:  log,
+		k:    k,
+		conf: conf,
+	}, nil
+}
+
+// NewCmdSupportBundle creates a new cli.Command for the support-bundle command
+func NewCmdSupportBundle(log logrus.FieldLogger) *cli.Command {
+	return &cli.Command{
+		Name:        "support-bundle",
+		Usage:       "Gather redacted information about your developer environment for a support request",
+		Description: cmdutil.NewDescription(supportBundleLongDesc, supportBundleExample),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Path to write the support bundle to, defaults to devenv-support-bundle-<time>.tar.gz",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			o, err := NewOptions(log)
+			if err != nil {
+				return err
+			}
+			o.Output = c.String("output")
+
+			return o.Run(c.Context)
+		},
+	}
+}
+
+// collector gathers a file for the support bundle
+type collector struct {
+	// name is the name of the file in the support bundle
+	name string
+
+	// fn returns the contents of the file
+	fn func(ctx context.Context) ([]byte, error)
+
+	// needsKube denotes that the collector requires a Kubernetes client
+	needsKube bool
+}
+
+// collectors returns the collectors used to gather a support bundle
+func (o *Options) collectors(out *status.Output) []collector {
+	return []collector{
+		{name: "version.txt", fn: o.version},
+		{name: "config.yaml", fn: o.config},
+		{name: "box.yaml", fn: o.box},
+		{name: "status.yaml", fn: func(context.Context) ([]byte, error) { return yaml.Marshal(out.Status) }},
+		{name: "runtime.yaml", fn: func(context.Context) ([]byte, error) { return yaml.Marshal(out.Runtime) }},
+		{name: "localizer.yaml", fn: func(context.Context) ([]byte, error) { return yaml.Marshal(out.Tunnels) }},
+		{name: "traces.yaml", fn: o.traces},
+		{name: "pods.yaml", fn: o.pods, needsKube: true},
+		{name: "events.yaml", fn: o.events, needsKube: true},
+		{name: "apps.yaml", fn: o.apps, needsKube: true},
+		{name: "snapshot-configmap.yaml", fn: o.snapshotConfigMap, needsKube: true},
+		{name: "velero.yaml", fn: o.velero, needsKube: true},
+	}
+}
+
+// version returns the version of devenv and the host it's running on
+func (o *Options) version(context.Context) ([]byte, error) {
+	return []byte(fmt.Sprintf("devenv: %s\nos: %s\narch: %s\n", app.Info().Version, runtime.GOOS, runtime.GOARCH)), nil
+}
+
+// config returns the devenv config file
+func (o *Options) config(context.Context) ([]byte, error) {
+	dir, err := config.GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "config.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []byte("# config.yaml doesn't exist, the default context is used\n"), nil
+	}
+	return b, err
+}
+
+// box returns the devenv section of the box configuration
+func (o *Options) box(context.Context) ([]byte, error) {
+	b, err := box.LoadBox()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load box configuration")
+	}
+
+	return yaml.Marshal(b.DeveloperEnvironmentConfig)
+}
+
+// traces returns recent devenv invocations
+func (o *Options) traces(context.Context) ([]byte, error) {
+	traces, err := devenvutil.RecentTraces()
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(traces)
+}
+
+// pods returns the state of every pod, by namespace
+func (o *Options) pods(ctx context.Context) ([]byte, error) {
+	pods, err := o.k.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+
+	byNamespace := make(map[string][]*corev1.Pod)
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		byNamespace[p.Namespace] = append(byNamespace[p.Namespace], p)
+	}
+
+	states := make(map[string]map[string]interface{}, len(byNamespace))
+	for ns, nsPods := range byNamespace {
+		states[ns] = devenvutil.PodsStateInfo(nsPods)
+	}
+
+	return yaml.Marshal(states)
+}
+
+// events returns every event, oldest first
+func (o *Options) events(ctx context.Context) ([]byte, error) {
+	events, err := o.k.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list events")
+	}
+
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+	})
+
+	return yaml.Marshal(events.Items)
+}
+
+// apps returns the apps registry
+func (o *Options) apps(ctx context.Context) ([]byte, error) {
+	deployedApps, err := apps.NewKubernetesConfigmapClient(o.k, "").List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(deployedApps)
+}
+
+// snapshotConfigMap returns the configmap describing the
+// snapshot the developer environment was provisioned from
+func (o *Options) snapshotConfigMap(ctx context.Context) ([]byte, error) {
+	cm, err := o.k.CoreV1().ConfigMaps("devenv").Get(ctx, snapshot.InfoConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get snapshot configmap")
+	}
+
+	return yaml.Marshal(cm)
+}
+
+// velero returns the Velero backups and restores
+func (o *Options) velero(ctx context.Context) ([]byte, error) {
+	vc, err := veleroclient.NewForConfig(o.conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create velero client")
+	}
+
+	backups, err := vc.VeleroV1().Backups(snapshot.SnapshotNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list velero backups")
+	}
+
+	restores, err := vc.VeleroV1().Restores(snapshot.SnapshotNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list velero restores")
+	}
+
+	return yaml.Marshal(map[string]interface{}{
+		"backups":  backups.Items,
+		"restores": restores.Items,
+	})
+}
+
+// getStatus returns the status of the developer environment, including all namespaces
+func (o *Options) getStatus(ctx context.Context) (*status.Output, error) {
+	sopts, err := status.NewOptions(o.log)
+	if err != nil {
+		return nil, err
+	}
+	sopts.AllNamespaces = true
+	sopts.IncludeKubeSystem = true
+
+	return sopts.GetOutput(ctx)
+}
+
+// Run runs the support-bundle command
+func (o *Options) Run(ctx context.Context) error {
+	name := "devenv-support-bundle-" + time.Now().Format("20060102-150405")
+	if o.Output == "" {
+		o.Output = name + ".tar.gz"
+	}
+
+	o.log.Info("Gathering developer environment information ...")
+	out, err := o.getStatus(ctx)
+	if err != nil {
+		o.log.WithError(err).Warn("Failed to get developer environment status")
+		out = &status.Output{}
+	}
+
+	// Only talk to Kubernetes if it's reachable, otherwise every
+	// collector would wait for it to time out.
+	kubeReachable := o.k != nil && out.Status.Status != status.Unprovisioned && out.Status.Status != status.Unknown
+
+	f, err := os.Create(o.Output)
+	if err != nil {
+		return errors.Wrap(err, "failed to create support bundle")
+	}
+	defer f.Close()
+
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+
+	failures := make([]string, 0)
+	for _, c := range o.collectors(out) {
+		if c.needsKube && !kubeReachable {
+			failures = append(failures, fmt.Sprintf("%s: kubernetes isn't reachable", c.name))
+			continue
+		}
+
+		b, err := c.fn(ctx)
+		if err != nil {
+			o.log.WithError(err).WithField("file", c.name).Warn("Failed to gather information")
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+			continue
+		}
+
+		if err := writeFile(tw, name+"/"+c.name, Redact(b)); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) != 0 {
+		if err := writeFile(tw, name+"/errors.txt", Redact([]byte(strings.Join(failures, "\n")+"\n"))); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "failed to write support bundle")
+	}
+	if err := gzw.Close(); err != nil {
+		return errors.Wrap(err, "failed to write support bundle")
+	}
+
+	o.log.WithField("path", o.Output).Info("Created support bundle, please review it before sharing")
+	return nil
+}
+
+// writeFile writes a file into a tarball
+func writeFile(tw *tar.Writer, name string, b []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(b)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return errors.Wrapf(err, "failed to write %s to support bundle", name)
+	}
+
+	_, err := tw.Write(b)
+	return errors.Wrapf(err, "failed to write %s to support bundle", name)
+}
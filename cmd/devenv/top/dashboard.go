@@ -0,0 +1,392 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/getoutreach/devenv/internal/apps"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/kubernetestunnelruntime"
+	localizerapi "github.com/getoutreach/localizer/api"
+	"github.com/getoutreach/localizer/pkg/localizer"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+const (
+	// maxRestarts is the maximum number of restarting containers shown
+	maxRestarts = 10
+
+	// maxEvents is the maximum number of warning events shown
+	maxEvents = 10
+)
+
+// dashboard contains the state of the dashboard. Kubernetes resources are
+// watched through informers, everything else is refreshed by refresh.
+type dashboard struct {
+	k  kubernetes.Interface
+	mc metricsclient.Interface
+
+	nodes  corelisters.NodeLister
+	pods   corelisters.PodLister
+	events corelisters.EventLister
+
+	// mu protects the fields below, which are set by refresh
+	mu sync.Mutex
+
+	// nodeUsage is the resource usage of each node, this is
+	// nil if metrics-server is unavailable.
+	nodeUsage map[string]corev1.ResourceList
+
+	// localizerRunning denotes if localizer was running
+	localizerRunning bool
+
+	// tunnels are the services tunneled by localizer
+	tunnels []*localizerapi.ListService
+
+	// apps are the applications deployed in the devenv
+	apps []apps.App
+
+	// errs are errors that occurred during the last refresh
+	errs []string
+}
+
+// newDashboard creates a dashboard that uses listers from the provided
+// informer factory. The informers must be started before rendering.
+func newDashboard(k kubernetes.Interface, mc metricsclient.Interface, factory informers.SharedInformerFactory) *dashboard {
+	return &dashboard{
+		k:      k,
+		mc:     mc,
+		nodes:  factory.Core().V1().Nodes().Lister(),
+		pods:   factory.Core().V1().Pods().Lister(),
+		events: factory.Core().V1().Events().Lister(),
+	}
+}
+
+// refresh refreshes the information that isn't watched through informers
+func (d *dashboard) refresh(ctx context.Context) {
+	var errs []string
+
+	var nodeUsage map[string]corev1.ResourceList
+	if d.mc != nil {
+		nodeUsage, _ = kube.NodeUsage(ctx, d.mc) //nolint:errcheck // Why: Usage is hidden without metrics-server
+	}
+
+	running := localizer.IsRunning()
+	var tunnels []*localizerapi.ListService
+	if running {
+		var err error
+		if tunnels, err = kubernetestunnelruntime.ListServices(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	deployedApps, err := apps.NewKubernetesConfigmapClient(d.k, "").List(ctx)
+	if err != nil {
+		errs = append(errs, errors.Wrap(err, "failed to list apps").Error())
+	}
+	sort.Slice(deployedApps, func(i, j int) bool {
+		return deployedApps[i].Name < deployedApps[j].Name
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nodeUsage = nodeUsage
+	d.localizerRunning = running
+	d.tunnels = tunnels
+	d.apps = deployedApps
+	d.errs = errs
+}
+
+// screen is a buffer of lines to be drawn on the terminal
+type screen struct {
+	lines []string
+}
+
+// header adds a section header
+func (s *screen) header(title string) {
+	if len(s.lines) != 0 {
+		s.lines = append(s.lines, "")
+	}
+	s.lines = append(s.lines, color.New(color.Bold, color.FgCyan).Sprint(title))
+}
+
+// line adds a line of text
+func (s *screen) line(format string, args ...interface{}) {
+	s.lines = append(s.lines, fmt.Sprintf(format, args...))
+}
+
+// columns adds a row of columns, padded to the provided widths
+func (s *screen) columns(widths []int, cols ...string) {
+	var sb strings.Builder
+	for i, c := range cols {
+		if i == len(cols)-1 || i >= len(widths) {
+			sb.WriteString(c)
+			break
+		}
+		fmt.Fprintf(&sb, "%-*s ", widths[i], truncate(c, widths[i]))
+	}
+	s.lines = append(s.lines, sb.String())
+}
+
+// truncate truncates a string to n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(r[:n])
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// formatUsage formats a used/total quantity pair
+func formatUsage(used, total *resource.Quantity, memory bool) string {
+	format := func(q *resource.Quantity) string {
+		if q == nil {
+			return "-"
+		}
+		if memory {
+			return fmt.Sprintf("%dMi", q.Value()/(1024*1024))
+		}
+		return fmt.Sprintf("%dm", q.MilliValue())
+	}
+
+	if used == nil || total.IsZero() {
+		return format(used) + "/" + format(total)
+	}
+
+	return fmt.Sprintf("%s/%s (%d%%)", format(used), format(total), used.MilliValue()*100/total.MilliValue())
+}
+
+// age returns a human readable time since t
+func age(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return duration.HumanDuration(time.Since(t))
+}
+
+// namespaceSummary is the status of the pods in a namespace
+type namespaceSummary struct {
+	Namespace string
+	Running   int
+	Pending   int
+	Failed    int
+	Succeeded int
+}
+
+// summarizeNamespaces returns the status of pods in each namespace
+func summarizeNamespaces(pods []*corev1.Pod) []*namespaceSummary {
+	byNamespace := make(map[string]*namespaceSummary)
+	for _, p := range pods {
+		s, ok := byNamespace[p.Namespace]
+		if !ok {
+			s = &namespaceSummary{Namespace: p.Namespace}
+			byNamespace[p.Namespace] = s
+		}
+
+		switch p.Status.Phase {
+		case corev1.PodRunning:
+			s.Running++
+		case corev1.PodSucceeded:
+			s.Succeeded++
+		case corev1.PodFailed:
+			s.Failed++
+		case corev1.PodPending, corev1.PodUnknown:
+			s.Pending++
+		}
+	}
+
+	summaries := make([]*namespaceSummary, 0, len(byNamespace))
+	for _, s := range byNamespace {
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Namespace < summaries[j].Namespace
+	})
+
+	return summaries
+}
+
+// restartingContainer is a container that has restarted
+type restartingContainer struct {
+	Namespace string
+	Pod       string
+	Container string
+	Restarts  int32
+
+	// Reason is why the container last terminated
+	Reason string
+}
+
+// findRestartingContainers returns all containers that have restarted,
+// sorted by the number of restarts.
+func findRestartingContainers(pods []*corev1.Pod) []*restartingContainer {
+	restarting := make([]*restartingContainer, 0)
+	for _, p := range pods {
+		for i := range p.Status.ContainerStatuses {
+			cs := &p.Status.ContainerStatuses[i]
+			if cs.RestartCount == 0 {
+				continue
+			}
+
+			rc := &restartingContainer{
+				Namespace: p.Namespace,
+				Pod:       p.Name,
+				Container: cs.Name,
+				Restarts:  cs.RestartCount,
+			}
+			if cs.State.Waiting != nil {
+				rc.Reason = cs.State.Waiting.Reason
+			} else if cs.LastTerminationState.Terminated != nil {
+				rc.Reason = cs.LastTerminationState.Terminated.Reason
+			}
+			restarting = append(restarting, rc)
+		}
+	}
+
+	sort.SliceStable(restarting, func(i, j int) bool {
+		return restarting[i].Restarts > restarting[j].Restarts
+	})
+
+	return restarting
+}
+
+// render renders the dashboard, returning the lines to draw
+func (d *dashboard) render() ([]string, error) { //nolint:funlen,gocyclo
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s := &screen{}
+
+	nodes, err := d.nodes.List(labels.Everything())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	pods, err := d.pods.List(labels.Everything())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+
+	events, err := d.events.List(labels.Everything())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list events")
+	}
+
+	s.header("NODES")
+	nodeWidths := []int{30, 8, 22}
+	s.columns(nodeWidths, "NAME", "STATUS", "CPU", "MEMORY")
+	for _, n := range nodes {
+		status := "NotReady"
+		for i := range n.Status.Conditions {
+			if n.Status.Conditions[i].Type == corev1.NodeReady && n.Status.Conditions[i].Status == corev1.ConditionTrue {
+				status = "Ready"
+			}
+		}
+
+		var cpu, mem *resource.Quantity
+		if usage, ok := d.nodeUsage[n.Name]; ok {
+			cpu, mem = usage.Cpu(), usage.Memory()
+		}
+		s.columns(nodeWidths, n.Name, status,
+			formatUsage(cpu, n.Status.Allocatable.Cpu(), false), formatUsage(mem, n.Status.Allocatable.Memory(), true))
+	}
+
+	s.header("NAMESPACES")
+	nsWidths := []int{40, 8, 8, 8}
+	s.columns(nsWidths, "NAMESPACE", "RUNNING", "PENDING", "FAILED", "COMPLETED")
+	for _, ns := range summarizeNamespaces(pods) {
+		s.columns(nsWidths, ns.Namespace, fmt.Sprint(ns.Running), fmt.Sprint(ns.Pending),
+			fmt.Sprint(ns.Failed), fmt.Sprint(ns.Succeeded))
+	}
+
+	s.header("RESTARTING CONTAINERS")
+	restarting := findRestartingContainers(pods)
+	if len(restarting) == 0 {
+		s.line("No containers have restarted")
+	} else {
+		rWidths := []int{60, 8}
+		s.columns(rWidths, "CONTAINER", "RESTARTS", "REASON")
+		for i, rc := range restarting {
+			if i == maxRestarts {
+				s.line("... and %d more", len(restarting)-maxRestarts)
+				break
+			}
+			s.columns(rWidths, rc.Namespace+"/"+rc.Pod+"/"+rc.Container, fmt.Sprint(rc.Restarts), rc.Reason)
+		}
+	}
+
+	s.header("RECENT WARNING EVENTS")
+	warnings := make([]*corev1.Event, 0)
+	for _, e := range events {
+		if e.Type == corev1.EventTypeWarning {
+			warnings = append(warnings, e)
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		return kube.EventTime(warnings[i]).After(kube.EventTime(warnings[j]))
+	})
+	if len(warnings) == 0 {
+		s.line("No warning events")
+	} else {
+		eWidths := []int{6, 50, 20}
+		s.columns(eWidths, "AGE", "OBJECT", "REASON", "MESSAGE")
+		for i, e := range warnings {
+			if i == maxEvents {
+				break
+			}
+			object := e.Namespace + "/" + strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name
+			s.columns(eWidths, age(kube.EventTime(e)), object, e.Reason, strings.TrimSpace(e.Message))
+		}
+	}
+
+	s.header("TUNNELS")
+	switch {
+	case !d.localizerRunning:
+		s.line("localizer is not running, run 'devenv tunnel' to create tunnels")
+	case len(d.tunnels) == 0:
+		s.line("No services are tunneled")
+	default:
+		tWidths := []int{50, 10, 16}
+		s.columns(tWidths, "SERVICE", "STATUS", "IP", "PORTS")
+		for _, t := range d.tunnels {
+			if t == nil {
+				continue
+			}
+			s.columns(tWidths, t.Namespace+"/"+t.Name, t.Status, t.Ip, strings.Join(t.Ports, ","))
+		}
+	}
+
+	s.header("APPS")
+	if len(d.apps) == 0 {
+		s.line("No apps are deployed")
+	} else {
+		aWidths := []int{40, 42}
+		s.columns(aWidths, "APP", "VERSION", "DEPLOYED")
+		for i := range d.apps {
+			s.columns(aWidths, d.apps[i].Name, d.apps[i].Version, age(d.apps[i].DeployedAt))
+		}
+	}
+
+	for _, e := range d.errs {
+		s.line("error: %s", e)
+	}
+
+	return s.lines, nil
+}
@@ -0,0 +1,47 @@
+package top
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindRestartingContainers(t *testing.T) {
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "healthy"},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "app"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "crashing"},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name:         "app",
+						RestartCount: 2,
+						LastTerminationState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"},
+						},
+					},
+					{
+						Name:         "sidecar",
+						RestartCount: 5,
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	restarting := findRestartingContainers(pods)
+	assert.DeepEqual(t, restarting, []*restartingContainer{
+		{Namespace: "b", Pod: "crashing", Container: "sidecar", Restarts: 5, Reason: "CrashLoopBackOff"},
+		{Namespace: "b", Pod: "crashing", Container: "app", Restarts: 2, Reason: "OOMKilled"},
+	})
+}
@@ -0,0 +1,246 @@
+// Package top implements the top devenv command
+package top
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/devenvutil"
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+//nolint:gochecknoglobals
+var (
+	topLongDesc = `
+		Top shows a live dashboard of your developer environment. This includes node resources, the status of pods in each namespace, restarting containers, recent warning events, localizer tunnels and deployed apps.
+
+		Press 'q' to exit.
+	`
+	topExample = `
+		# Show a live dashboard of your developer environment
+		devenv top
+	`
+)
+
+const (
+	// refreshInterval is how often information that isn't
+	// watched, e.g. resource usage, is refreshed
+	refreshInterval = 5 * time.Second
+
+	// drawInterval is the minimum time between draws, this
+	// batches changes when many resources change at once
+	drawInterval = 250 * time.Millisecond
+
+	// Terminal escape sequences used to draw the dashboard
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	exitAltScreen  = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+)
+
+// Options holds the options for the top command
+type Options struct {
+	log  logrus.FieldLogger
+	k    kubernetes.Interface
+	conf *rest.Config
+}
+
+// NewOptions creates a new Options instance for the top command
+func NewOptions(log logrus.FieldLogger) (*Options, error) {
+	k, conf, err := kube.GetKubeClientWithConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kubernetes client")
+	}
+
+	return &Options{
+		log:  log,
+		k:    k,
+		conf: conf,
+	}, nil
+}
+
+// NewCmdTop creates a new command for the top subcommand
+func NewCmdTop(log logrus.FieldLogger) *cli.Command {
+	return &cli.Command{
+		Name:        "top",
+		Usage:       "Show a live dashboard of your developer environment",
+		Description: cmdutil.NewDescription(topLongDesc, topExample),
+		Action: func(c *cli.Context) error {
+			o, err := NewOptions(log)
+			if err != nil {
+				return err
+			}
+
+			return o.Run(c.Context)
+		},
+	}
+}
+
+// draw draws the dashboard onto the terminal, lines that don't
+// fit into the terminal are cut off.
+func draw(d *dashboard, contextName string) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	lines, err := d.render()
+	if err != nil {
+		lines = []string{"error: " + err.Error()}
+	}
+
+	title := color.New(color.Bold).Sprintf("devenv top - %s - %s", contextName, time.Now().Format("15:04:05"))
+	lines = append([]string{title, "Press 'q' to exit", ""}, lines...)
+	lines = fitLines(lines, width, height)
+
+	// The terminal is in raw mode, so we need to return the cursor
+	// to the start of each line ourselves.
+	fmt.Fprint(os.Stdout, clearScreen+strings.Join(lines, "\r\n"))
+}
+
+// fitLines cuts off the lines that don't fit into a terminal of the
+// given size, replacing them with a line saying how many were cut off.
+func fitLines(lines []string, width, height int) []string {
+	// At least one line is always shown, along with how many lines
+	// were cut off
+	if height < 2 {
+		height = 2
+	}
+
+	if len(lines) > height {
+		lines = append(lines[:height-1], fmt.Sprintf("... %d more lines, resize your terminal to see them", len(lines)-height+1))
+	}
+
+	for i := range lines {
+		// Lines with escape sequences are headers, which are always short
+		if !strings.Contains(lines[i], "\x1b") {
+			lines[i] = truncate(lines[i], width)
+		}
+	}
+
+	return lines
+}
+
+// waitForQuit calls cancel once the user presses 'q' or Ctrl+C
+func waitForQuit(cancel context.CancelFunc) {
+	defer cancel()
+
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return
+		}
+
+		// 3 is Ctrl+C, which isn't sent as a signal in raw mode
+		switch buf[0] {
+		case 'q', 'Q', 3:
+			return
+		}
+	}
+}
+
+// Run runs the top command
+func (o *Options) Run(ctx context.Context) error { //nolint:funlen
+	b, err := box.LoadBox()
+	if err != nil {
+		return errors.Wrap(err, "failed to load box configuration")
+	}
+
+	conf, err := config.LoadConfig(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load config")
+	}
+
+	if _, err := devenvutil.EnsureDevenvRunning(ctx, conf, b); err != nil { //nolint:govet // Why: OK w/ err shadow
+		return err
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("devenv top requires an interactive terminal, use 'devenv status' instead")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// metrics-server is optional, usage is hidden without it
+	var mc metricsclient.Interface
+	if c, err := metricsclient.NewForConfig(o.conf); err == nil { //nolint:govet // Why: OK w/ err shadow
+		mc = c
+	}
+
+	factory := informers.NewSharedInformerFactory(o.k, 0)
+	d := newDashboard(o.k, mc, factory)
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	}
+	factory.Core().V1().Nodes().Informer().AddEventHandler(handler)
+	factory.Core().V1().Pods().Informer().AddEventHandler(handler)
+	factory.Core().V1().Events().Informer().AddEventHandler(handler)
+
+	o.log.Info("Loading developer environment information ...")
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to watch %v", informerType)
+		}
+	}
+	d.refresh(ctx)
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return errors.Wrap(err, "failed to configure terminal")
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state) //nolint:errcheck // Why: Best effort
+
+	fmt.Fprint(os.Stdout, enterAltScreen)
+	defer fmt.Fprint(os.Stdout, exitAltScreen)
+
+	go waitForQuit(cancel)
+
+	refresh := time.NewTicker(refreshInterval)
+	defer refresh.Stop()
+
+	draw(d, conf.CurrentContext)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-refresh.C:
+			d.refresh(ctx)
+		case <-changed:
+			// Wait for more changes to come in before drawing
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(drawInterval):
+			}
+		}
+
+		draw(d, conf.CurrentContext)
+	}
+}
@@ -0,0 +1,54 @@
+package top
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFitLines(t *testing.T) {
+	tests := map[string]struct {
+		lines    []string
+		width    int
+		height   int
+		expected []string
+	}{
+		"fits": {
+			lines:    []string{"a", "b"},
+			width:    80,
+			height:   2,
+			expected: []string{"a", "b"},
+		},
+		"too many lines": {
+			lines:    []string{"a", "b", "c", "d"},
+			width:    80,
+			height:   3,
+			expected: []string{"a", "b", "... 2 more lines, resize your terminal to see them"},
+		},
+		"too long lines": {
+			lines:    []string{"abcdef"},
+			width:    4,
+			height:   3,
+			expected: []string{"abc…"},
+		},
+		"one line terminal": {
+			lines:    []string{"a", "b", "c"},
+			width:    80,
+			height:   1,
+			expected: []string{"a", "... 2 more lines, resize your terminal to see them"},
+		},
+		"zero size terminal": {
+			lines:    []string{"a", "b", "c"},
+			width:    80,
+			height:   0,
+			expected: []string{"a", "... 2 more lines, resize your terminal to see them"},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.DeepEqual(t, fitLines(tc.lines, tc.width, tc.height), tc.expected)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// chunkCacheMaxAge is how long chunks that aren't part of the current
+// snapshot are kept in the chunk cache. The cache is shared by every
+// cluster, so chunks of other snapshots may still be in use.
+const chunkCacheMaxAge = 7 * 24 * time.Hour
+
+// chunkCacheDir returns the directory the chunks of snapshots are cached in
+func (s *SnapshotUploader) chunkCacheDir() string {
+	if s.conf.ChunkCacheDir != "" {
+		return s.conf.ChunkCacheDir
+	}
+	return filepath.Join(os.TempDir(), "snapshot-chunks")
+}
+
+// cachePath returns the path of a chunk in the chunk cache
+func (s *SnapshotUploader) cachePath(digest string) string {
+	return filepath.Join(s.chunkCacheDir(), digest+".zst")
+}
+
+// DownloadManifest downloads the manifest of a chunked snapshot
+func (s *SnapshotUploader) DownloadManifest(ctx context.Context) error {
+	s.log.Info("Downloading chunk manifest")
+	obj, err := s.source.GetObject(ctx, s.conf.Source.Bucket, s.conf.Source.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch chunk manifest")
+	}
+	defer obj.Close()
+
+	byt, err := io.ReadAll(obj)
+	if err != nil {
+		return errors.Wrap(err, "failed to download chunk manifest")
+	}
+
+	digest := snapshot.NewDigesterFor(s.conf.Source.Digest)
+	digest.Write(byt) //nolint:errcheck // Why: hashes never return errors
+	if digest.Digest() != s.conf.Source.Digest {
+		return fmt.Errorf("downloaded chunk manifest failed checksum validation")
+	}
+
+	var manifest snapshot.ChunkManifest
+	if err := json.Unmarshal(byt, &manifest); err != nil {
+		return errors.Wrap(err, "failed to parse chunk manifest")
+	}
+	s.manifest = &manifest
+
+	return nil
+}
+
+// fetchChunk downloads a chunk from the source bucket, verifies
+// it and stores it in the chunk cache.
+func (s *SnapshotUploader) fetchChunk(ctx context.Context, dec *zstd.Decoder, digest string) error {
+	obj, err := s.source.GetObject(ctx, s.conf.Source.Bucket, snapshot.ChunkKey(digest), minio.GetObjectOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch chunk %s", digest)
+	}
+	defer obj.Close()
+
+	compressed, err := io.ReadAll(obj)
+	if err != nil {
+		return errors.Wrapf(err, "failed to download chunk %s", digest)
+	}
+
+	if _, err := snapshot.DecompressChunk(dec, digest, compressed); err != nil { //nolint:govet // Why: OK shadowing err
+		return err
+	}
+
+	// Chunks are written into place atomically, as the cache may be
+	// shared with other uploaders running at the same time
+	f, err := os.CreateTemp(s.chunkCacheDir(), "chunk-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create chunk file")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(compressed)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to cache chunk %s", digest)
+	}
+	return errors.Wrapf(os.Rename(f.Name(), s.cachePath(digest)), "failed to cache chunk %s", digest)
+}
+
+// fetchMissingChunks downloads the chunks of the snapshot that aren't in the chunk cache
+func (s *SnapshotUploader) fetchMissingChunks(ctx context.Context, dec *zstd.Decoder, digests map[string]bool) error {
+	if err := os.MkdirAll(s.chunkCacheDir(), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create chunk cache")
+	}
+
+	now := time.Now()
+	fetched := 0
+	for digest := range digests {
+		// Cached chunks are marked as used, so they aren't pruned
+		if err := os.Chtimes(s.cachePath(digest), now, now); err == nil {
+			continue
+		}
+
+		if err := s.fetchChunk(ctx, dec, digest); err != nil {
+			return err
+		}
+		fetched++
+	}
+	s.log.Infof("Fetched %d chunks, %d were already downloaded", fetched, len(digests)-fetched)
+
+	return nil
+}
+
+// writeChunks writes the decompressed chunks of a file, from the chunk cache, into w
+func (s *SnapshotUploader) writeChunks(dec *zstd.Decoder, f *snapshot.ChunkedFile, w io.Writer) error {
+	for _, digest := range f.Chunks {
+		compressed, err := os.ReadFile(s.cachePath(digest))
+		if err != nil {
+			return errors.Wrapf(err, "failed to read chunk %s", digest)
+		}
+
+		// Chunks are verified again, in case the cache was corrupted
+		chunk, err := snapshot.DecompressChunk(dec, digest, compressed)
+		if err != nil {
+			os.Remove(s.cachePath(digest)) //nolint:errcheck // Why: Best effort
+			return err
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneChunkCache removes chunks that aren't part of the current snapshot,
+// and haven't been used by another snapshot recently, from the chunk cache
+func (s *SnapshotUploader) pruneChunkCache(digests map[string]bool) error {
+	entries, err := os.ReadDir(s.chunkCacheDir())
+	if err != nil {
+		return errors.Wrap(err, "failed to list chunk cache")
+	}
+
+	for _, e := range entries {
+		if digests[strings.TrimSuffix(e.Name(), ".zst")] {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < chunkCacheMaxAge {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.chunkCacheDir(), e.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "failed to remove chunk %s", e.Name())
+		}
+	}
+
+	return nil
+}
+
+// UploadChunkedContents extracts the files of a chunked snapshot into the
+// configured destination bucket, only fetching chunks that aren't cached.
+func (s *SnapshotUploader) UploadChunkedContents(ctx context.Context) error {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create zstd decoder")
+	}
+	defer dec.Close()
+
+	digests := s.manifest.Digests()
+	if err := s.fetchMissingChunks(ctx, dec, digests); err != nil {
+		return err
+	}
+
+	for i := range s.manifest.Files {
+		f := &s.manifest.Files[i]
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(s.writeChunks(dec, f, pw))
+		}()
+
+		_, err := s.dest.PutObject(ctx, s.conf.Dest.Bucket, f.Name, pr, f.Size, minio.PutObjectOptions{
+			SendContentMd5: true,
+		})
+		pr.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to upload file '%s'", f.Name)
+		}
+	}
+
+	if err := s.pruneChunkCache(digests); err != nil {
+		s.log.WithError(err).Warn("failed to prune chunk cache")
+	}
+
+	return nil
+}
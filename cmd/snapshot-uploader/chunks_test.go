@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/internal/snapshot/snapshottest"
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+)
+
+func TestChunkCache(t *testing.T) {
+	ctx := context.Background()
+	enc, err := zstd.NewWriter(nil)
+	assert.NilError(t, err)
+	dec, err := zstd.NewReader(nil)
+	assert.NilError(t, err)
+	defer dec.Close()
+
+	chunk := func(contents string) (string, []byte) {
+		return snapshot.ChunkDigest([]byte(contents)), enc.EncodeAll([]byte(contents), nil)
+	}
+	fetched, fetchedData := chunk("fetched")
+	cached, cachedData := chunk("cached")
+	recent, recentData := chunk("recent")
+	old, oldData := chunk("old")
+
+	source := &snapshottest.S3{}
+	sourceClient := snapshottest.NewS3Client(t, source)
+	_, err = sourceClient.PutObject(ctx, "source", snapshot.ChunkKey(fetched),
+		bytes.NewReader(fetchedData), int64(len(fetchedData)), minio.PutObjectOptions{})
+	assert.NilError(t, err)
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	s := &SnapshotUploader{
+		conf: &snapshot.Config{
+			Source:        &snapshot.S3Config{Bucket: "source"},
+			ChunkCacheDir: t.TempDir(),
+		},
+		source: sourceClient,
+		log:    log,
+	}
+
+	// Chunks already in the cache, e.g. from another cluster, aren't downloaded again
+	lastWeek := time.Now().Add(-2 * chunkCacheMaxAge)
+	for digest, data := range map[string][]byte{cached: cachedData, recent: recentData, old: oldData} {
+		assert.NilError(t, os.WriteFile(s.cachePath(digest), data, 0o600))
+		assert.NilError(t, os.Chtimes(s.cachePath(digest), lastWeek, lastWeek))
+	}
+	assert.NilError(t, os.Chtimes(s.cachePath(recent), time.Now(), time.Now()))
+
+	digests := map[string]bool{fetched: true, cached: true}
+	assert.NilError(t, s.fetchMissingChunks(ctx, dec, digests))
+
+	var buf bytes.Buffer
+	f := &snapshot.ChunkedFile{Chunks: []string{cached, fetched}}
+	assert.NilError(t, s.writeChunks(dec, f, &buf))
+	assert.Equal(t, buf.String(), "cachedfetched")
+
+	// Only chunks that haven't been used recently by any snapshot are pruned
+	assert.NilError(t, s.pruneChunkCache(digests))
+	entries, err := os.ReadDir(s.chunkCacheDir())
+	assert.NilError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	expected := []string{filepath.Base(s.cachePath(cached)), filepath.Base(s.cachePath(fetched)), filepath.Base(s.cachePath(recent))}
+	sort.Strings(names)
+	sort.Strings(expected)
+	assert.DeepEqual(t, names, expected)
+}
@@ -0,0 +1,436 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: This file contains a parallel, resumable, downloader for
+// snapshot archives.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/getoutreach/gobox/pkg/async"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// downloadPartSize is the size of the ranges a snapshot is downloaded in
+	downloadPartSize = 64 * 1024 * 1024
+
+	// downloadConcurrency is the number of ranges downloaded at once
+	downloadConcurrency = 4
+
+	// downloadRetries is the number of times a range is retried before
+	// the download is considered failed
+	downloadRetries = 5
+
+	// downloadBackoff is the time waited before the first retry, it's
+	// doubled for every retry after that
+	downloadBackoff = time.Second
+
+	// progressInterval is how often download progress is logged
+	progressInterval = 10 * time.Second
+)
+
+// downloadState is stored next to a partial download so that the download
+// can be resumed, e.g. when the uploader is restarted after failing.
+type downloadState struct {
+	ETag      string `json:"etag"`
+	Size      int64  `json:"size"`
+	PartSize  int64  `json:"part_size"`
+	Completed []bool `json:"completed"`
+}
+
+// downloader downloads an object into a file as parallel ranged requests,
+// retrying failed ranges and resuming downloads from a previous run.
+type downloader struct {
+	client *minio.Client
+	bucket string
+	key    string
+	path   string
+	log    logrus.FieldLogger
+
+	partSize         int64
+	concurrency      int
+	retries          int
+	backoff          time.Duration
+	progressInterval time.Duration
+
+	// set by Open
+	f *os.File
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	state downloadState
+
+	// contiguous is the number of bytes, from the start of the
+	// file, that have been downloaded
+	contiguous int64
+
+	// downloaded is the number of bytes that have been downloaded
+	downloaded int64
+
+	// finished is set once Download returns, err is the error it returned
+	finished bool
+	err      error
+}
+
+// newDownloader creates a downloader for an object that's downloaded into path
+func newDownloader(client *minio.Client, bucket, key, path string, log logrus.FieldLogger) *downloader {
+	d := &downloader{
+		client:           client,
+		bucket:           bucket,
+		key:              key,
+		path:             path,
+		log:              log,
+		partSize:         downloadPartSize,
+		concurrency:      downloadConcurrency,
+		retries:          downloadRetries,
+		backoff:          downloadBackoff,
+		progressInterval: progressInterval,
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// statePath returns the path the download state is stored at
+func (d *downloader) statePath() string {
+	return d.path + ".state"
+}
+
+// parts returns the number of parts the object is downloaded in
+func (d *downloader) parts() int {
+	return int((d.state.Size + d.state.PartSize - 1) / d.state.PartSize)
+}
+
+// partRange returns the range of bytes, [start, end), of a part
+func (d *downloader) partRange(i int) (start, end int64) {
+	start = int64(i) * d.state.PartSize
+	end = start + d.state.PartSize
+	if end > d.state.Size {
+		end = d.state.Size
+	}
+	return start, end
+}
+
+// Open prepares the file that the object is downloaded into, resuming
+// a previous download of the same object if one exists.
+func (d *downloader) Open(ctx context.Context) error {
+	info, err := d.client.StatObject(ctx, d.bucket, d.key, minio.StatObjectOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get snapshot information")
+	}
+
+	f, err := os.OpenFile(d.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open download file")
+	}
+	d.f = f
+
+	var state downloadState
+	if b, err := os.ReadFile(d.statePath()); err == nil { //nolint:govet // Why: OK shadowing err
+		if err := json.Unmarshal(b, &state); err != nil {
+			d.log.WithError(err).Warn("Ignoring invalid partial download state")
+		}
+	}
+
+	// Only resume if the object hasn't changed and the partial download still exists
+	resume := state.ETag == info.ETag && state.Size == info.Size && state.PartSize == d.partSize
+	if fi, err := f.Stat(); err != nil || fi.Size() != state.Size { //nolint:govet // Why: OK shadowing err
+		resume = false
+	}
+
+	d.state = state
+	if !resume {
+		d.state = downloadState{ETag: info.ETag, Size: info.Size, PartSize: d.partSize}
+		d.state.Completed = make([]bool, d.parts())
+		if err := d.f.Truncate(0); err != nil {
+			return errors.Wrap(err, "failed to truncate download file")
+		}
+	}
+	if err := d.f.Truncate(d.state.Size); err != nil {
+		return errors.Wrap(err, "failed to allocate download file")
+	}
+
+	for i, completed := range d.state.Completed {
+		if completed {
+			start, end := d.partRange(i)
+			d.downloaded += end - start
+		}
+	}
+	d.advance()
+	if d.downloaded != 0 {
+		d.log.Infof("Resuming download, %s of %s already downloaded",
+			humanize.IBytes(uint64(d.downloaded)), humanize.IBytes(uint64(d.state.Size)))
+	}
+
+	return nil
+}
+
+// advance updates contiguous to the end of the downloaded
+// parts at the start of the file, d.mu must be held.
+func (d *downloader) advance() {
+	for i := int(d.contiguous / d.state.PartSize); i < len(d.state.Completed) && d.state.Completed[i]; i++ {
+		_, d.contiguous = d.partRange(i)
+	}
+}
+
+// saveState stores the download state so the download can be resumed, d.mu must be held.
+func (d *downloader) saveState() error {
+	b, err := json.Marshal(d.state)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that partial writes
+	// never leave an invalid state behind
+	tmp := d.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.statePath())
+}
+
+// completePart marks a part as downloaded
+func (d *downloader) completePart(i int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.state.Completed[i] = true
+	d.advance()
+	d.cond.Broadcast()
+
+	return errors.Wrap(d.saveState(), "failed to save download state")
+}
+
+// addProgress records that n bytes have been downloaded
+func (d *downloader) addProgress(n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.downloaded += n
+}
+
+// reportProgress logs the progress of the download until ctx is canceled
+func (d *downloader) reportProgress(ctx context.Context) {
+	t := time.NewTicker(d.progressInterval)
+	defer t.Stop()
+
+	d.mu.Lock()
+	last := d.downloaded
+	d.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		d.mu.Lock()
+		downloaded := d.downloaded
+		d.mu.Unlock()
+
+		rate := float64(downloaded-last) / d.progressInterval.Seconds()
+		last = downloaded
+
+		d.log.WithField("downloaded", downloaded).WithField("total", d.state.Size).Infof(
+			"Downloaded %s of %s (%.1f%%) at %s/s", humanize.IBytes(uint64(downloaded)),
+			humanize.IBytes(uint64(d.state.Size)), float64(downloaded)/float64(d.state.Size)*100,
+			humanize.IBytes(uint64(rate)))
+	}
+}
+
+// offsetWriter writes into a file starting at an offset
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+// Write implements io.Writer
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// fetchRange downloads the range [start, end) of the object into the file,
+// returning the number of bytes downloaded even if it fails.
+func (d *downloader) fetchRange(ctx context.Context, start, end int64) (int64, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(start, end-1); err != nil {
+		return 0, err
+	}
+
+	// Ensure the object hasn't changed since the download started
+	if err := opts.SetMatchETag(d.state.ETag); err != nil {
+		return 0, err
+	}
+
+	obj, err := d.client.GetObject(ctx, d.bucket, d.key, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer obj.Close()
+
+	w := &offsetWriter{f: d.f, off: start}
+	n, err := io.Copy(w, io.LimitReader(obj, end-start))
+	d.addProgress(n)
+	if err == nil && n != end-start {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// downloadPart downloads a part of the object, retrying from where
+// it left off if the download fails.
+func (d *downloader) downloadPart(ctx context.Context, i int) error {
+	start, end := d.partRange(i)
+	for attempt := 0; ; attempt++ {
+		n, err := d.fetchRange(ctx, start, end)
+		start += n
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= d.retries {
+			return errors.Wrapf(err, "failed to download part %d after %d attempts", i, attempt+1)
+		}
+
+		backoff := d.backoff << attempt
+		d.log.WithError(err).WithField("part", i).Warnf("Failed to download part, retrying in %s", backoff)
+		async.Sleep(ctx, backoff)
+	}
+
+	return d.completePart(i)
+}
+
+// Download downloads the parts of the object that haven't already been
+// downloaded. Open must be called first.
+func (d *downloader) Download(ctx context.Context) (err error) {
+	defer func() {
+		d.mu.Lock()
+		d.finished = true
+		d.err = err
+		if d.err == nil && d.contiguous != d.state.Size {
+			d.err = fmt.Errorf("download finished with missing parts")
+		}
+		d.cond.Broadcast()
+		d.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parts := make(chan int)
+	go func() {
+		defer close(parts)
+		for i, completed := range d.state.Completed {
+			if completed {
+				continue
+			}
+
+			select {
+			case parts <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go d.reportProgress(ctx)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, d.concurrency)
+	for i := 0; i < d.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range parts {
+				if err := d.downloadPart(ctx, part); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// The first error is the cause of any others, e.g. context canceled
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d.log.Infof("Downloaded %s", humanize.IBytes(uint64(d.state.Size)))
+	return nil
+}
+
+// Reader returns a reader of the downloaded file that reads parts, in order,
+// as soon as they're downloaded. This allows the file to be verified while
+// it's being downloaded. Open must be called first.
+func (d *downloader) Reader() io.Reader {
+	return &downloadReader{d: d}
+}
+
+// Failed returns true if Download has returned an error
+func (d *downloader) Failed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.finished && d.err != nil
+}
+
+// Remove removes the downloaded file and the download state
+func (d *downloader) Remove() {
+	if d.f != nil {
+		d.f.Close() //nolint:errcheck // Why: Best effort
+	}
+	os.Remove(d.path)        //nolint:errcheck // Why: Best effort
+	os.Remove(d.statePath()) //nolint:errcheck // Why: Best effort
+}
+
+// downloadReader reads the contiguous downloaded bytes of a downloader
+type downloadReader struct {
+	d   *downloader
+	off int64
+}
+
+// Read implements io.Reader
+func (r *downloadReader) Read(p []byte) (int, error) {
+	d := r.d
+
+	d.mu.Lock()
+	for r.off >= d.contiguous && !d.finished {
+		d.cond.Wait()
+	}
+	available := d.contiguous - r.off
+	err := d.err
+	d.mu.Unlock()
+
+	if available <= 0 {
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > available {
+		p = p[:available]
+	}
+	n, err := d.f.ReadAt(p, r.off)
+	r.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+)
+
+// fakeS3 is a minimal S3 stand-in that serves a single object,
+// dropping the connection of the first request for each range in drop.
+type fakeS3 struct {
+	data []byte
+
+	mu       sync.Mutex
+	requests []string
+	drop     map[string]bool
+}
+
+// truncatingWriter aborts the response after limit bytes
+type truncatingWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *truncatingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		w.ResponseWriter.Write(p[:w.limit]) //nolint:errcheck // Why: aborting anyways
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rng := r.Header.Get("Range")
+
+	s.mu.Lock()
+	drop := s.drop[rng]
+	delete(s.drop, rng)
+	if r.Method == http.MethodGet {
+		s.requests = append(s.requests, rng)
+	}
+	s.mu.Unlock()
+
+	if drop {
+		w = &truncatingWriter{ResponseWriter: w, limit: 10}
+	}
+
+	w.Header().Set("ETag", `"fake-etag"`)
+	http.ServeContent(w, r, "", time.Unix(1600000000, 0), bytes.NewReader(s.data))
+}
+
+func newTestDownloader(t *testing.T, s *fakeS3, path string) *downloader {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	assert.NilError(t, err)
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Region: "us-east-1",
+	})
+	assert.NilError(t, err)
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	d := newDownloader(client, "bucket", "snapshot.tar", path, log)
+	d.partSize = 1024
+	d.backoff = time.Millisecond
+	return d
+}
+
+func TestDownloaderRetriesDroppedConnections(t *testing.T) {
+	data := make([]byte, 10*1024+100)
+	rand.New(rand.NewSource(1)).Read(data) //nolint:gosec // Why: just test data
+
+	s := &fakeS3{data: data, drop: map[string]bool{"bytes=0-1023": true, "bytes=5120-6143": true}}
+	d := newTestDownloader(t, s, filepath.Join(t.TempDir(), "snapshot"))
+	assert.NilError(t, d.Open(context.Background()))
+
+	// Read while downloading, like verification does
+	read := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(d.Reader()) //nolint:errcheck // Why: compared below
+		read <- b
+	}()
+
+	assert.NilError(t, d.Download(context.Background()))
+	assert.DeepEqual(t, <-read, data)
+
+	// The dropped ranges are resumed from where they left off
+	assert.Assert(t, contains(s.requests, "bytes=10-1023"))
+	assert.Assert(t, contains(s.requests, "bytes=5130-6143"))
+
+	b, err := os.ReadFile(d.path)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, b, data)
+}
+
+func TestDownloaderResumes(t *testing.T) {
+	data := make([]byte, 4*1024)
+	rand.New(rand.NewSource(2)).Read(data) //nolint:gosec // Why: just test data
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	// Fail the first download on the last part
+	s := &fakeS3{data: data}
+	d := newTestDownloader(t, s, path)
+	d.retries = 0
+	d.concurrency = 1
+	s.drop = map[string]bool{"bytes=3072-4095": true}
+	assert.NilError(t, d.Open(context.Background()))
+	assert.ErrorContains(t, d.Download(context.Background()), "failed to download part 3")
+	d.f.Close()
+
+	s.requests = nil
+	d = newTestDownloader(t, s, path)
+	assert.NilError(t, d.Open(context.Background()))
+	assert.NilError(t, d.Download(context.Background()))
+	assert.DeepEqual(t, s.requests, []string{"bytes=3072-4095"})
+
+	b, err := io.ReadAll(d.Reader())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, b, data)
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/md5" //nolint:gosec // Why: just using for digest checking
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -14,10 +13,12 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/getoutreach/devenv/internal/snapshot"
 	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/getoutreach/devenv/pkg/snapshoter"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -44,7 +45,11 @@ type SnapshotUploader struct {
 	// set after fetched
 	snapshot *box.SnapshotLockListItem
 
-	downloadedFile *os.File
+	// download is the downloaded snapshot archive
+	download *downloader
+
+	// manifest is set instead of download for chunked snapshots
+	manifest *snapshot.ChunkManifest
 }
 
 type step func(context.Context) error
@@ -131,14 +136,9 @@ func (s *SnapshotUploader) CreateClients(ctx context.Context) error {
 	return nil
 }
 
-// Discover implements snapshot discovery. This finds the latest snapshot
-// from a given S3 bucket.
+// Discover implements snapshot discovery. This finds the snapshot to use,
+// by default the latest, from a given S3 bucket.
 func (s *SnapshotUploader) Discover(ctx context.Context) error {
-	if s.conf.Source.Key != "" {
-		s.log.Info("Using snapshot at %s", s.conf.Source.Key)
-		return nil
-	}
-
 	s.log.Info("Discovering snapshots")
 	resp, err := s.source.GetObject(ctx, s.conf.Source.Bucket,
 		"automated-snapshots/v2/latest.yaml", minio.GetObjectOptions{})
@@ -153,24 +153,11 @@ func (s *SnapshotUploader) Discover(ctx context.Context) error {
 		return errors.Wrap(err, "failed to parse remote snapshot lockfile")
 	}
 
-	target := s.conf.Source.SnapshotTarget
-	channel := s.conf.Source.SnapshotChannel
-
-	if _, ok := lockfile.TargetsV2[target]; !ok {
-		return fmt.Errorf("unknown snapshot target '%s'", s.conf.Source.SnapshotTarget)
-	}
-
-	if _, ok := lockfile.TargetsV2[target].Snapshots[channel]; !ok {
-		return fmt.Errorf("unknown snapshot channel '%s'", channel)
-	}
-
-	if len(lockfile.TargetsV2[target].Snapshots[channel]) == 0 {
-		return fmt.Errorf("no snapshots found for channel '%s'", channel)
+	target, channel, snapshotTarget, err := selectSnapshot(lockfile, s.conf.Source)
+	if err != nil {
+		return err
 	}
 
-	// 0-index is the latest
-	snapshotTarget := lockfile.TargetsV2[target].Snapshots[channel][0]
-
 	targetJSON, err := json.Marshal(snapshotTarget)
 	if err != nil {
 		s.log.Infof("Using snapshot: %v", snapshotTarget)
@@ -179,12 +166,86 @@ func (s *SnapshotUploader) Discover(ctx context.Context) error {
 	}
 
 	s.snapshot = snapshotTarget
+	s.conf.Source.SnapshotTarget = target
+	s.conf.Source.SnapshotChannel = channel
 	s.conf.Source.Key = snapshotTarget.URI
 	s.conf.Source.Digest = snapshotTarget.Digest
 
 	return nil
 }
 
+// selectSnapshot returns the snapshot to use from the lockfile, and the target
+// and channel it's in. This is the snapshot at conf.Key, or with conf.Digest,
+// if set, otherwise the conf.SnapshotAge previous snapshot in the channel.
+func selectSnapshot(lockfile *box.SnapshotLock, conf *snapshot.S3Config) (string,
+	box.SnapshotLockChannel, *box.SnapshotLockListItem, error) {
+	target := conf.SnapshotTarget
+	channel := conf.SnapshotChannel
+
+	// Keys are unique across targets, so look in every target for them
+	targets := []string{target}
+	if conf.Key != "" {
+		for name := range lockfile.TargetsV2 {
+			if name != target {
+				targets = append(targets, name)
+			}
+		}
+		sort.Strings(targets[1:])
+	}
+
+	if _, ok := lockfile.TargetsV2[target]; !ok && conf.Key == "" {
+		return "", "", nil, fmt.Errorf("unknown snapshot target '%s'", target)
+	}
+
+	if conf.Key != "" || conf.Digest != "" {
+		for _, name := range targets {
+			t, ok := lockfile.TargetsV2[name]
+			if !ok {
+				continue
+			}
+
+			// Prefer the requested channel
+			channels := []box.SnapshotLockChannel{channel}
+			for c := range t.Snapshots {
+				if c != channel {
+					channels = append(channels, c)
+				}
+			}
+			rest := channels[1:]
+			sort.Slice(rest, func(i, j int) bool { return rest[i] < rest[j] })
+
+			for _, c := range channels {
+				for _, itm := range t.Snapshots[c] {
+					if (conf.Key == "" || itm.URI == conf.Key) && (conf.Digest == "" || itm.Digest == conf.Digest) {
+						return name, c, itm, nil
+					}
+				}
+			}
+		}
+
+		if conf.Key != "" {
+			return "", "", nil, fmt.Errorf("no snapshot found with key '%s'", conf.Key)
+		}
+		return "", "", nil, fmt.Errorf("no snapshot of target '%s' found with digest '%s'", target, conf.Digest)
+	}
+
+	snapshots, ok := lockfile.TargetsV2[target].Snapshots[channel]
+	if !ok {
+		return "", "", nil, fmt.Errorf("unknown snapshot channel '%s'", channel)
+	}
+
+	if len(snapshots) == 0 {
+		return "", "", nil, fmt.Errorf("no snapshots found for channel '%s'", channel)
+	}
+
+	// 0-index is the latest
+	if conf.SnapshotAge < 0 || conf.SnapshotAge >= len(snapshots) {
+		return "", "", nil, fmt.Errorf("snapshot age must be between 0 and %d for channel '%s'", len(snapshots)-1, channel)
+	}
+
+	return target, channel, snapshots[conf.SnapshotAge], nil
+}
+
 // Prepare checks if a snapshot needs to be downloaded or not
 // and otherwise prepares the dest to receive a snapshot.
 func (s *SnapshotUploader) Prepare(ctx context.Context) error {
@@ -201,6 +262,13 @@ func (s *SnapshotUploader) Prepare(ctx context.Context) error {
 	}
 
 	s.log.Info("Preparing local storage for snapshot")
+	s.clearDest(ctx)
+
+	return nil
+}
+
+// clearDest removes all of the files in the destination bucket
+func (s *SnapshotUploader) clearDest(ctx context.Context) {
 	for obj := range s.dest.ListObjects(ctx, s.conf.Dest.Bucket, minio.ListObjectsOptions{Recursive: true}) {
 		if obj.Key == "" {
 			continue
@@ -212,86 +280,113 @@ func (s *SnapshotUploader) Prepare(ctx context.Context) error {
 			s.log.WithError(err2).WithField("key", obj.Key).Warn("failed to remove old snapshot key")
 		}
 	}
-
-	return nil
 }
 
-// DownloadFile downloads a file from a given URL and returns the path to it
+// DownloadFile downloads the snapshot into a file, in parallel ranges, verifying
+// it while it's downloaded. Partial downloads are resumed from where they
+// left off, e.g. if the uploader was restarted after failing.
 func (s *SnapshotUploader) DownloadFile(ctx context.Context) error { //nolint:funlen
-	s.log.Info("Starting download")
-	obj, err := s.source.GetObject(ctx, s.conf.Source.Bucket, s.conf.Source.Key, minio.GetObjectOptions{})
-	if err != nil {
-		return errors.Wrap(err, "failed to fetch the latest snapshot information")
+	if snapshot.IsChunked(s.conf.Source.Key) {
+		return s.DownloadManifest(ctx)
 	}
-	defer obj.Close()
 
-	tmpFile, err := os.CreateTemp("", "devenv-snapshot-*")
-	if err != nil {
-		return errors.Wrap(err, "failed to create temporary file")
+	if s.conf.Stream {
+		s.log.Info("Streaming snapshot, skipping download")
+		return nil
 	}
 
-	tmpFile.Close()           //nolint:errcheck // Why: Best effort
-	os.Remove(tmpFile.Name()) //nolint:errcheck // Why: Best effort
-
-	err = os.MkdirAll(filepath.Dir(tmpFile.Name()), 0o755)
-	if err != nil {
-		return errors.Wrap(err, "failed to create temporary directory")
+	dir := s.conf.DownloadDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrap(err, "failed to create download directory")
 	}
 
-	f, err := os.Create(tmpFile.Name())
-	if err != nil {
-		return errors.Wrap(err, "failed to create temporary file")
+	s.log.Info("Starting download")
+	d := newDownloader(s.source, s.conf.Source.Bucket, s.conf.Source.Key,
+		filepath.Join(dir, "devenv-snapshot-"+filepath.Base(s.conf.Source.Key)), s.log)
+	if err := d.Open(ctx); err != nil {
+		return err
 	}
 
-	digest := md5.New() //nolint:gosec // Why: we're just checking the digest
-	_, err = io.Copy(io.MultiWriter(f, digest), obj)
-	f.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Verify the files in the archive while downloading, so a corrupt
+	// snapshot fails as soon as the first corrupt file is downloaded.
+	digest := snapshot.NewDigesterFor(s.conf.Source.Digest)
+	corrupt := make(chan error, 1)
+	go func() {
+		verr := verifyArchive(io.TeeReader(d.Reader(), digest))
+		if verr != nil && !d.Failed() {
+			cancel()
+			corrupt <- verr
+		}
+		close(corrupt)
+	}()
+
+	err := d.Download(ctx)
+	if verr := <-corrupt; verr != nil {
+		// Don't resume from corrupt data
+		d.Remove()
+		return errors.Wrap(verr, "downloaded snapshot is corrupt")
+	}
 	if err != nil {
-		return errors.Wrap(err, "failed to write file")
+		return errors.Wrap(err, "failed to download snapshot")
 	}
 	s.log.Info("Finished download snapshot")
 
-	gotMD5 := base64.StdEncoding.EncodeToString(digest.Sum(nil))
-	if gotMD5 != s.conf.Source.Digest {
+	if digest.Digest() != s.conf.Source.Digest {
+		d.Remove()
 		return fmt.Errorf("downloaded snapshot failed checksum validation")
 	}
 
-	f, err = os.Open(tmpFile.Name())
-	if err != nil {
-		return errors.Wrap(err, "failed to open temporary file")
-	}
-	s.downloadedFile = f
-
+	s.download = d
 	return nil
 }
 
-// UploadArchiveContents uploads a given archive's contents into
-// the configured destination bucket.
-func (s *SnapshotUploader) UploadArchiveContents(ctx context.Context) error {
-	s.log.Info("Extracting snapshot into minio bucket")
-	tarReader := tar.NewReader(s.downloadedFile)
+// verifyArchive reads a snapshot archive, verifying the checksums of the
+// files in it, and returns the first corrupt file as an error.
+func verifyArchive(r io.Reader) error {
+	v := snapshot.NewArchiveVerifier(tar.NewReader(r))
 	for {
-		header, err := tarReader.Next() //nolint:govet // Why: OK shadowing err
+		_, fr, err := v.Next()
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return errors.Wrap(err, "failed to read tar header")
+			return err
 		}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			continue
-		case tar.TypeReg:
-			fileName := strings.TrimPrefix(header.Name, "./")
-			_, err := s.dest.PutObject(ctx, s.conf.Dest.Bucket,
-				fileName, tarReader, header.Size, minio.PutObjectOptions{
-					SendContentMd5: true,
-				})
-			if err != nil {
-				return errors.Wrapf(err, "failed to upload file '%s'", fileName)
-			}
+		if _, err := io.Copy(io.Discard, fr); err != nil {
+			return err
 		}
 	}
+
+	// Read the padding after the end of the archive
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+// UploadArchiveContents uploads a given archive's, or chunked snapshot's,
+// contents into the configured destination bucket.
+func (s *SnapshotUploader) UploadArchiveContents(ctx context.Context) error {
+	s.log.Info("Extracting snapshot into minio bucket")
+	var err error
+	switch {
+	case s.manifest != nil:
+		err = s.UploadChunkedContents(ctx)
+	case s.download == nil:
+		err = s.StreamArchiveContents(ctx)
+	default:
+		err = snapshoter.ExtractArchive(ctx, tar.NewReader(s.download.Reader()), s.dest, s.conf.Dest.Bucket, "")
+	}
+	if err != nil {
+		return err
+	}
+	if s.download != nil {
+		s.download.Remove()
+	}
 	s.log.Info("Finished extracting snapshot")
 
 	s.log.Info("Writing snapshot state to minio")
@@ -307,6 +402,37 @@ func (s *SnapshotUploader) UploadArchiveContents(ctx context.Context) error {
 	return errors.Wrap(err, "failed to set current snapshot")
 }
 
+// StreamArchiveContents extracts the snapshot into the configured destination
+// bucket as it's downloaded, verifying it on the fly. If the snapshot fails
+// verification, the destination bucket is cleared so that a partial snapshot
+// is never used.
+func (s *SnapshotUploader) StreamArchiveContents(ctx context.Context) error {
+	obj, err := s.source.GetObject(ctx, s.conf.Source.Bucket, s.conf.Source.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch snapshot")
+	}
+	defer obj.Close()
+
+	digest := snapshot.NewDigesterFor(s.conf.Source.Digest)
+	r := io.TeeReader(obj, digest)
+
+	err = snapshoter.ExtractArchive(ctx, tar.NewReader(r), s.dest, s.conf.Dest.Bucket, "")
+	if err == nil {
+		// Read the padding after the end of the archive, which is part of the digest
+		_, err = io.Copy(io.Discard, r)
+	}
+	if err == nil && digest.Digest() != s.conf.Source.Digest {
+		err = fmt.Errorf("streamed snapshot failed checksum validation")
+	}
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to stream snapshot, removing extracted files")
+		s.clearDest(ctx)
+		return err
+	}
+
+	return nil
+}
+
 func (s *SnapshotUploader) getPostRestoreManifests(ctx context.Context, postRestorePath string) ([]byte, error) {
 	// compress because of 1MB limit, like Helm does.
 	s.log.Info("Compressing post-restore manifests")
@@ -351,7 +477,9 @@ func (s *SnapshotUploader) ExtractPostRestore(ctx context.Context) error {
 	}
 
 	data := map[string]string{
-		"snapshot.json": string(serializedSnapshot),
+		snapshot.InfoSnapshotKey: string(serializedSnapshot),
+		snapshot.InfoTargetKey:   s.conf.Source.SnapshotTarget,
+		snapshot.InfoChannelKey:  string(s.conf.Source.SnapshotChannel),
 	}
 
 	if postRestoreManifests != nil {
@@ -365,7 +493,7 @@ func (s *SnapshotUploader) ExtractPostRestore(ctx context.Context) error {
 	s.log.Info("Creating 'snapshot' configmap")
 	_, err = s.k.CoreV1().ConfigMaps("devenv").Create(ctx, &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "snapshot",
+			Name: snapshot.InfoConfigMap,
 		},
 		Data: data,
 	}, metav1.CreateOptions{})
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/internal/snapshot/snapshottest"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+)
+
+func TestSelectSnapshot(t *testing.T) {
+	lockfile := &box.SnapshotLock{
+		TargetsV2: map[string]*box.SnapshotLockList{
+			"base": {
+				Snapshots: map[box.SnapshotLockChannel][]*box.SnapshotLockListItem{
+					box.SnapshotLockChannelStable: {
+						{Digest: "2", URI: "base/2.tar"},
+						{Digest: "1", URI: "base/1.tar"},
+					},
+					box.SnapshotLockChannelRC: {
+						{Digest: "3", URI: "base/3.tar"},
+					},
+				},
+			},
+			"other": {
+				Snapshots: map[box.SnapshotLockChannel][]*box.SnapshotLockListItem{
+					box.SnapshotLockChannelStable: {
+						{Digest: "4", URI: "other/4.tar"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		conf    snapshot.S3Config
+		target  string
+		channel box.SnapshotLockChannel
+		uri     string
+		err     string
+	}{
+		"latest": {
+			conf:    snapshot.S3Config{SnapshotTarget: "base", SnapshotChannel: box.SnapshotLockChannelStable},
+			target:  "base",
+			channel: box.SnapshotLockChannelStable,
+			uri:     "base/2.tar",
+		},
+		"age": {
+			conf:    snapshot.S3Config{SnapshotTarget: "base", SnapshotChannel: box.SnapshotLockChannelStable, SnapshotAge: 1},
+			target:  "base",
+			channel: box.SnapshotLockChannelStable,
+			uri:     "base/1.tar",
+		},
+		"age out of range": {
+			conf: snapshot.S3Config{SnapshotTarget: "base", SnapshotChannel: box.SnapshotLockChannelStable, SnapshotAge: 2},
+			err:  "snapshot age must be between 0 and 1",
+		},
+		"digest in another channel": {
+			conf:    snapshot.S3Config{SnapshotTarget: "base", SnapshotChannel: box.SnapshotLockChannelStable, Digest: "3"},
+			target:  "base",
+			channel: box.SnapshotLockChannelRC,
+			uri:     "base/3.tar",
+		},
+		"unknown digest": {
+			conf: snapshot.S3Config{SnapshotTarget: "base", SnapshotChannel: box.SnapshotLockChannelStable, Digest: "4"},
+			err:  "no snapshot of target 'base' found with digest '4'",
+		},
+		"key in another target": {
+			conf:    snapshot.S3Config{SnapshotTarget: "base", SnapshotChannel: box.SnapshotLockChannelStable, Key: "other/4.tar"},
+			target:  "other",
+			channel: box.SnapshotLockChannelStable,
+			uri:     "other/4.tar",
+		},
+		"unknown target": {
+			conf: snapshot.S3Config{SnapshotTarget: "missing", SnapshotChannel: box.SnapshotLockChannelStable},
+			err:  "unknown snapshot target 'missing'",
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			target, channel, itm, err := selectSnapshot(lockfile, &tc.conf)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, target, tc.target)
+			assert.Equal(t, channel, tc.channel)
+			assert.Equal(t, itm.URI, tc.uri)
+		})
+	}
+}
+
+func TestStreamArchiveContentsClearsDestOnCorruption(t *testing.T) {
+	tests := map[string]struct {
+		archive *bytes.Buffer
+		digest  string
+		err     string
+	}{
+		"corrupt file": {
+			archive: snapshottest.NewArchive(t, [][2]string{
+				{"a", "a"},
+				{"a" + snapshot.ChecksumSuffix, snapshot.Digest([]byte("a"))},
+				{"b", "corrupt"},
+				{"b" + snapshot.ChecksumSuffix, snapshot.Digest([]byte("b"))},
+			}),
+			err: "file 'b' failed checksum validation",
+		},
+		"corrupt archive": {
+			archive: snapshottest.NewArchive(t, [][2]string{{"a", "a"}, {"b", "b"}}),
+			digest:  snapshot.Digest([]byte("other")),
+			err:     "streamed snapshot failed checksum validation",
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			digest := tc.digest
+			if digest == "" {
+				digest = snapshot.Digest(tc.archive.Bytes())
+			}
+
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+
+			dest := &snapshottest.S3{}
+			destClient := snapshottest.NewS3Client(t, dest)
+			_, err := destClient.PutObject(context.Background(), "dest", "old", strings.NewReader("old"), 3, minio.PutObjectOptions{})
+			assert.NilError(t, err)
+
+			s := &SnapshotUploader{
+				conf: &snapshot.Config{
+					Source: &snapshot.S3Config{Bucket: "source", Key: "snapshot.tar", Digest: digest},
+					Dest:   &snapshot.S3Config{Bucket: "dest"},
+				},
+				source: snapshottest.NewS3Client(t, &fakeS3{data: tc.archive.Bytes()}),
+				dest:   destClient,
+				log:    log,
+			}
+
+			assert.ErrorContains(t, s.StreamArchiveContents(context.Background()), tc.err)
+			assert.Equal(t, len(dest.Objects()), 0)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package devenv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/getoutreach/devenv/cmd/devenv/status"
+	"github.com/pkg/errors"
+)
+
+// StaticResolver is a resolver that resolves hostnames from a static
+// map of hostnames to addresses. It is used as status.Options.Resolver
+// so DNS resolution can be checked without depending on the host's
+// /etc/hosts, which isn't always writable in CI.
+type StaticResolver struct {
+	// Hosts is a map of hostnames to the addresses they resolve to
+	Hosts map[string][]string
+
+	// Default are the addresses returned for hostnames not in Hosts,
+	// if empty those hostnames fail to resolve.
+	Default []string
+}
+
+// LookupHost returns the addresses of a hostname
+func (r *StaticResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addrs, ok := r.Hosts[host]; ok {
+		return addrs, nil
+	}
+
+	if len(r.Default) == 0 {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return r.Default, nil
+}
+
+// CheckStatus checks that the devenv is running, resolving
+// hostnames with the provided resolver.
+//nolint:gocritic,revive // Why: t is first param in test helpers
+func CheckStatus(t *testing.T, ctx context.Context, r status.Resolver) {
+	sopts, err := status.NewOptions(Logger)
+	if err != nil {
+		t.Error(errors.Wrap(err, "failed to create devenv status options"))
+		return
+	}
+	sopts.Resolver = r
+
+	s, err := sopts.GetStatus(ctx)
+	if err != nil {
+		t.Error(errors.Wrap(err, "failed to get devenv status"))
+		return
+	}
+
+	if s.Status != status.Running {
+		t.Errorf("expected devenv to be %s, got %s: %s", status.Running, s.Status, s.Reason)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/getoutreach/devenv/cmd/devenv/snapshot"
 	"github.com/getoutreach/devenv/internal/e2e/devenv"
+	"github.com/getoutreach/devenv/pkg/kube"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/pkg/errors"
 )
@@ -56,7 +57,34 @@ var defaultProvisionArgs = devenv.ProvisionOpts{
 }
 
 func TestCanProvisionDevenv(t *testing.T) {
-	devenv.ProvisionDevenv(t, context.Background(), &defaultProvisionArgs)()
+	ctx := context.Background()
+
+	cleanupFn := devenv.ProvisionDevenv(t, ctx, &defaultProvisionArgs)
+	if cleanupFn != nil {
+		defer cleanupFn()
+	}
+	if t.Failed() {
+		return
+	}
+
+	k, err := kube.GetKubeClient()
+	if err != nil {
+		t.Error(errors.Wrap(err, "failed to create kubernetes client"))
+		return
+	}
+
+	ip, err := kube.IngressControllerIP(ctx, k)
+	if err != nil {
+		t.Error(errors.Wrap(err, "failed to get ingress controller IP"))
+		return
+	}
+
+	// Resolve everything to the ingress controller, as the
+	// e2e environment may not be able to modify /etc/hosts
+	devenv.CheckStatus(t, ctx, &devenv.StaticResolver{
+		Hosts:   map[string][]string{"localhost": {"127.0.0.1"}},
+		Default: []string{ip},
+	})
 }
 
 func TestCanProvisionSnapshotDevenv(t *testing.T) {
@@ -0,0 +1,118 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: This file contains the format of chunked snapshots, which
+// store the files of a snapshot as zstd compressed, content-addressed chunks.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChunkSize is the maximum size of a chunk, before compression
+	ChunkSize = 32 * 1024 * 1024
+
+	// ChunksPrefix is the prefix in the snapshot bucket that chunks are
+	// stored under, they're shared by every snapshot target.
+	ChunksPrefix = "automated-snapshots/v2/chunks/"
+
+	// ManifestSuffix is the suffix of snapshot URIs that point to a
+	// ChunkManifest, rather than a tar archive.
+	ManifestSuffix = ".manifest.json"
+)
+
+// ChunkManifest describes the files in a chunked snapshot
+type ChunkManifest struct {
+	// Files are the files in the snapshot
+	Files []ChunkedFile `json:"files"`
+}
+
+// ChunkedFile is a file in a chunked snapshot
+type ChunkedFile struct {
+	// Name is the name of the file, this is its key in the bucket
+	// the snapshot is extracted into.
+	Name string `json:"name"`
+
+	// Size is the size of the file
+	Size int64 `json:"size"`
+
+	// Chunks are the digests of the chunks that make up the file, in order
+	Chunks []string `json:"chunks"`
+}
+
+// Digests returns the unique digests of the chunks in a manifest
+func (m *ChunkManifest) Digests() map[string]bool {
+	digests := make(map[string]bool)
+	for i := range m.Files {
+		for _, d := range m.Files[i].Chunks {
+			digests[d] = true
+		}
+	}
+	return digests
+}
+
+// IsChunked returns true if a snapshot URI points to a ChunkManifest
+func IsChunked(uri string) bool {
+	return strings.HasSuffix(uri, ManifestSuffix)
+}
+
+// ChunkKey returns the key of a chunk in the snapshot bucket
+func ChunkKey(digest string) string {
+	return ChunksPrefix + digest + ".zst"
+}
+
+// ChunkDigest returns the digest of the contents of a chunk
+func ChunkDigest(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return hex.EncodeToString(sum[:])
+}
+
+// SplitChunks reads r in chunks of ChunkSize, calling fn with the digest and
+// contents of each chunk. The digests of the chunks are returned in order.
+func SplitChunks(r io.Reader, fn func(digest string, chunk []byte) error) ([]string, error) {
+	return splitChunks(r, ChunkSize, fn)
+}
+
+// splitChunks implements SplitChunks with a configurable chunk size
+func splitChunks(r io.Reader, size int, fn func(digest string, chunk []byte) error) ([]string, error) {
+	digests := make([]string, 0)
+	buf := make([]byte, size)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			digest := ChunkDigest(buf[:n])
+			if err := fn(digest, buf[:n]); err != nil { //nolint:govet // Why: OK shadowing err
+				return nil, err
+			}
+			digests = append(digests, digest)
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return digests, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read chunk")
+		}
+	}
+}
+
+// DecompressChunk decompresses a chunk and verifies that its
+// contents match its digest.
+func DecompressChunk(dec *zstd.Decoder, digest string, compressed []byte) ([]byte, error) {
+	chunk, err := dec.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress chunk %s", digest)
+	}
+
+	if got := ChunkDigest(chunk); got != digest {
+		return nil, fmt.Errorf("chunk %s failed checksum validation, got %s", digest, got)
+	}
+
+	return chunk, nil
+}
@@ -0,0 +1,68 @@
+package snapshot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"gotest.tools/v3/assert"
+)
+
+func TestSplitChunks(t *testing.T) {
+	data := []byte(strings.Repeat("a", 8) + strings.Repeat("b", 8) + "c")
+
+	chunks := make(map[string][]byte)
+	digests, err := splitChunks(bytes.NewReader(data), 8, func(digest string, chunk []byte) error {
+		chunks[digest] = append([]byte{}, chunk...)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(digests), 3)
+
+	var joined []byte
+	for _, d := range digests {
+		joined = append(joined, chunks[d]...)
+	}
+	assert.DeepEqual(t, joined, data)
+
+	// Identical content has an identical digest
+	again, err := splitChunks(bytes.NewReader(data[:8]), 8, func(string, []byte) error { return nil })
+	assert.NilError(t, err)
+	assert.DeepEqual(t, again, digests[:1])
+
+	empty, err := splitChunks(bytes.NewReader(nil), 8, func(string, []byte) error { return nil })
+	assert.NilError(t, err)
+	assert.Equal(t, len(empty), 0)
+}
+
+func TestDecompressChunk(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	assert.NilError(t, err)
+	defer enc.Close()
+
+	dec, err := zstd.NewReader(nil)
+	assert.NilError(t, err)
+	defer dec.Close()
+
+	chunk := []byte("hello world")
+	digest := ChunkDigest(chunk)
+	compressed := enc.EncodeAll(chunk, nil)
+
+	got, err := DecompressChunk(dec, digest, compressed)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, chunk)
+
+	_, err = DecompressChunk(dec, ChunkDigest([]byte("other")), compressed)
+	assert.ErrorContains(t, err, "failed checksum validation")
+}
+
+func TestManifestDigests(t *testing.T) {
+	m := &ChunkManifest{Files: []ChunkedFile{
+		{Name: "a", Chunks: []string{"1", "2"}},
+		{Name: "b", Chunks: []string{"2", "3"}},
+	}}
+	assert.DeepEqual(t, m.Digests(), map[string]bool{"1": true, "2": true, "3": true})
+	assert.Assert(t, IsChunked("automated-snapshots/v2/x/1.manifest.json"))
+	assert.Assert(t, !IsChunked("automated-snapshots/v2/x/1.tar"))
+}
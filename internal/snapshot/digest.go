@@ -0,0 +1,355 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: This file contains functions for computing and verifying
+// the digests of snapshots, and the files in them.
+package snapshot
+
+import (
+	"archive/tar"
+	"crypto/md5" //nolint:gosec // Why: only used to verify legacy digests
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sha256Prefix is the prefix of SHA-256 digests, digests without
+	// it are legacy base64 encoded MD5 digests.
+	sha256Prefix = "sha256:"
+
+	// ChecksumSuffix is the suffix of the file that follows each file in
+	// a snapshot archive, containing the checksum of the file.
+	ChecksumSuffix = ".sha256"
+
+	// ChecksumsFile is the name of the file, at the end of a snapshot
+	// archive, that contains the checksums of every file in it.
+	ChecksumsFile = "checksums.json"
+)
+
+// Digester computes the digest of a snapshot, it implements io.Writer
+type Digester struct {
+	h      hash.Hash
+	legacy bool
+}
+
+// NewDigester creates a Digester that computes SHA-256 digests
+func NewDigester() *Digester {
+	return &Digester{h: sha256.New()}
+}
+
+// NewDigesterFor creates a Digester that uses the same algorithm as
+// digest, this is MD5 for digests created before SHA-256 was used.
+func NewDigesterFor(digest string) *Digester {
+	if strings.HasPrefix(digest, sha256Prefix) {
+		return NewDigester()
+	}
+	return &Digester{h: md5.New(), legacy: true} //nolint:gosec // Why: only used to verify legacy digests
+}
+
+// Write implements io.Writer
+func (d *Digester) Write(p []byte) (int, error) {
+	return d.h.Write(p)
+}
+
+// Digest returns the digest of everything written so far
+func (d *Digester) Digest() string {
+	if d.legacy {
+		return base64.StdEncoding.EncodeToString(d.h.Sum(nil))
+	}
+	return sha256Prefix + hex.EncodeToString(d.h.Sum(nil))
+}
+
+// Digest returns the SHA-256 digest of b
+func Digest(b []byte) string {
+	d := NewDigester()
+	d.Write(b) //nolint:errcheck // Why: hashes never return errors
+	return d.Digest()
+}
+
+// Checksums are the digests of the files in a snapshot archive, by name
+type Checksums map[string]string
+
+// ArchiveWriter writes files into a snapshot archive, computing their
+// checksums as they're written. Each file is followed by its checksum, so
+// it can be verified as soon as it's read, and the checksums of every file
+// are written at the end of the archive so missing files can be detected.
+type ArchiveWriter struct {
+	tw        *tar.Writer
+	checksums Checksums
+}
+
+// NewArchiveWriter creates an ArchiveWriter that writes into tw
+func NewArchiveWriter(tw *tar.Writer) *ArchiveWriter {
+	return &ArchiveWriter{tw: tw, checksums: make(Checksums)}
+}
+
+// WriteFile writes a file, read from r, followed by its checksum
+func (w *ArchiveWriter) WriteFile(header *tar.Header, r io.Reader) error {
+	if err := w.tw.WriteHeader(header); err != nil {
+		return errors.Wrap(err, "failed to write tar header")
+	}
+
+	d := NewDigester()
+	if _, err := io.Copy(io.MultiWriter(w.tw, d), r); err != nil {
+		return errors.Wrapf(err, "failed to write file '%s'", header.Name)
+	}
+
+	digest := d.Digest()
+	w.checksums[strings.TrimPrefix(header.Name, "./")] = digest
+	return w.writeFile(header.Name+ChecksumSuffix, []byte(digest), header.ModTime)
+}
+
+// Close writes the checksums of every file in the archive, it doesn't
+// close the underlying tar.Writer.
+func (w *ArchiveWriter) Close() error {
+	b, err := json.Marshal(w.checksums)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal snapshot checksums")
+	}
+	return w.writeFile(ChecksumsFile, b, time.Now())
+}
+
+// writeFile writes a file that isn't checksummed into the archive
+func (w *ArchiveWriter) writeFile(name string, contents []byte, modTime time.Time) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(contents)),
+		Mode:     0o644,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to write tar header")
+	}
+
+	_, err = w.tw.Write(contents)
+	return errors.Wrapf(err, "failed to write %s", name)
+}
+
+// ArchiveVerifier reads the files in a snapshot archive, verifying each of
+// them against the checksum that follows it. Archives without checksums, e.g.
+// those created before checksums were added, aren't verified.
+type ArchiveVerifier struct {
+	tr *tar.Reader
+
+	// checked is set once a file has been followed by its checksum,
+	// after which every file must be.
+	checked bool
+
+	// unchecked is set if the first file wasn't followed by its
+	// checksum, in which case the archive isn't verified.
+	unchecked bool
+
+	// current is the file being read
+	current *verifyingReader
+
+	// pending is a header that was read while looking for a checksum
+	pending *tar.Header
+
+	// verified are the digests of the files that have been verified
+	verified Checksums
+
+	// checksums are the checksums at the end of the archive, these
+	// are nil until they're read.
+	checksums Checksums
+}
+
+// NewArchiveVerifier creates an ArchiveVerifier that reads from tr
+func NewArchiveVerifier(tr *tar.Reader) *ArchiveVerifier {
+	return &ArchiveVerifier{tr: tr, verified: make(Checksums)}
+}
+
+// FileReader reads a file in a snapshot archive
+type FileReader interface {
+	io.Reader
+
+	// Verify reads the rest of the file and returns an error if it
+	// doesn't match its checksum. Readers that don't read until io.EOF,
+	// e.g. ones that only read the size of the file, must call it to
+	// verify the file.
+	Verify() error
+}
+
+// Next returns the next file in the archive and a reader for its contents.
+// The reader returns an error instead of io.EOF if the file is corrupt.
+// io.EOF is returned once every file has been read.
+func (v *ArchiveVerifier) Next() (*tar.Header, FileReader, error) {
+	// The checksum of the current file follows it, so it has to be
+	// verified before moving on to the next file.
+	if v.current != nil {
+		if err := v.current.Verify(); err != nil {
+			return nil, nil, err
+		}
+		v.current = nil
+	}
+
+	for {
+		header := v.pending
+		v.pending = nil
+		if header == nil {
+			var err error
+			header, err = v.tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil, nil, v.verifyComplete()
+			} else if err != nil {
+				return nil, nil, errors.Wrap(err, "failed to read tar header")
+			}
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(header.Name, "./")
+		if v.unchecked {
+			return header, unverifiedReader{v.tr}, nil
+		}
+
+		if name == ChecksumsFile {
+			if err := v.readChecksums(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		v.current = &verifyingReader{v: v, name: name, d: NewDigester()}
+		return header, v.current, nil
+	}
+}
+
+// verify compares the digest of a file that's been read with the checksum
+// that follows it in the archive.
+func (v *ArchiveVerifier) verify(name string, d *Digester) error {
+	header, err := v.tr.Next()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return errors.Wrap(err, "failed to read tar header")
+	}
+
+	if header == nil || strings.TrimPrefix(header.Name, "./") != name+ChecksumSuffix {
+		if v.checked {
+			return fmt.Errorf("file '%s' has no checksum", name)
+		}
+
+		v.unchecked = true
+		v.pending = header
+		return nil
+	}
+	v.checked = true
+
+	expected, err := io.ReadAll(v.tr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read checksum of file '%s'", name)
+	}
+
+	if got := d.Digest(); got != string(expected) {
+		return fmt.Errorf("file '%s' failed checksum validation, expected %s, got %s", name, expected, got)
+	}
+	v.verified[name] = string(expected)
+	return nil
+}
+
+// readChecksums reads the checksums at the end of the archive, returning
+// an error if any of the files in them weren't in the archive.
+func (v *ArchiveVerifier) readChecksums() error {
+	if err := json.NewDecoder(v.tr).Decode(&v.checksums); err != nil {
+		return errors.Wrap(err, "failed to parse snapshot checksums")
+	}
+
+	names := make([]string, 0, len(v.checksums))
+	for name := range v.checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		got, ok := v.verified[name]
+		if !ok {
+			return fmt.Errorf("file '%s' is missing from the archive", name)
+		}
+		if got != v.checksums[name] {
+			return fmt.Errorf("file '%s' failed checksum validation, expected %s, got %s", name, v.checksums[name], got)
+		}
+	}
+	return nil
+}
+
+// verifyComplete returns an error if the archive has checksums but ended
+// before the checksums of every file, otherwise io.EOF
+func (v *ArchiveVerifier) verifyComplete() error {
+	if v.checked && v.checksums == nil {
+		return fmt.Errorf("snapshot archive is truncated, missing %s", ChecksumsFile)
+	}
+	return io.EOF
+}
+
+// unverifiedReader reads a file from an archive without checksums
+type unverifiedReader struct {
+	io.Reader
+}
+
+// Verify implements FileReader
+func (unverifiedReader) Verify() error {
+	return nil
+}
+
+// verifyingReader computes the digest of a file as it's read, returning
+// an error instead of io.EOF if it doesn't match its checksum.
+type verifyingReader struct {
+	v    *ArchiveVerifier
+	d    *Digester
+	name string
+
+	// done is set once the file has been verified, err is the result
+	done bool
+	err  error
+}
+
+// Read implements io.Reader
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	if r.done {
+		if r.err != nil {
+			return 0, r.err
+		}
+		return 0, io.EOF
+	}
+
+	n, err := r.v.tr.Read(p)
+	r.d.Write(p[:n]) //nolint:errcheck // Why: hashes never return errors
+
+	if errors.Is(err, io.EOF) {
+		// Return the error separately from the data, as readers
+		// such as io.ReadFull drop errors returned with data
+		if verr := r.Verify(); verr != nil && n == 0 {
+			return 0, verr
+		} else if n == 0 {
+			return 0, io.EOF
+		}
+		return n, nil
+	}
+	return n, err
+}
+
+// Verify implements FileReader
+func (r *verifyingReader) Verify() error {
+	if r.done {
+		return r.err
+	}
+	r.done = true
+
+	if _, err := io.Copy(r.d, r.v.tr); err != nil {
+		r.err = errors.Wrapf(err, "failed to read file '%s'", r.name)
+		return r.err
+	}
+
+	r.err = r.v.verify(r.name, r.d)
+	return r.err
+}
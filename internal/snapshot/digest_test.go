@@ -0,0 +1,173 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/getoutreach/devenv/internal/snapshot/snapshottest"
+	"gotest.tools/v3/assert"
+)
+
+func TestDigester(t *testing.T) {
+	d := NewDigester()
+	d.Write([]byte("hello")) //nolint:errcheck // Why: hashes never return errors
+	assert.Equal(t, d.Digest(), "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+	assert.Equal(t, Digest([]byte("hello")), d.Digest())
+
+	// Digests without a prefix are legacy base64 encoded MD5 digests
+	legacy := "XUFAKrxLKna5cZ2REBfFkg=="
+	d = NewDigesterFor(legacy)
+	d.Write([]byte("hello")) //nolint:errcheck // Why: hashes never return errors
+	assert.Equal(t, d.Digest(), legacy)
+}
+
+// testFile is a file in a test archive, it's followed by its checksum
+// if checksum is set
+type testFile struct {
+	name     string
+	contents string
+	checksum string
+}
+
+// newTestArchive creates a tar archive of files, in order, ending with
+// checksums if they aren't nil.
+func newTestArchive(t *testing.T, files []testFile, checksums Checksums) *tar.Reader {
+	entries := [][2]string{}
+	for _, f := range files {
+		entries = append(entries, [2]string{f.name, f.contents})
+		if f.checksum != "" {
+			entries = append(entries, [2]string{f.name + ChecksumSuffix, f.checksum})
+		}
+	}
+
+	if checksums != nil {
+		b, err := json.Marshal(checksums)
+		assert.NilError(t, err)
+		entries = append(entries, [2]string{ChecksumsFile, string(b)})
+	}
+
+	return tar.NewReader(snapshottest.NewArchive(t, entries))
+}
+
+// readAll reads every file from an ArchiveVerifier, returning the names
+// of the files that were read successfully and the first error.
+func readAll(v *ArchiveVerifier) ([]string, error) {
+	names := []string{}
+	for {
+		header, r, err := v.Next()
+		if err == io.EOF { //nolint:errorlint // Why: Next returns io.EOF unwrapped
+			return names, nil
+		} else if err != nil {
+			return names, err
+		}
+
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return names, err
+		}
+		names = append(names, header.Name)
+	}
+}
+
+func TestArchiveVerifier(t *testing.T) {
+	a := testFile{"a", "a", Digest([]byte("a"))}
+	b := testFile{"b", "b", Digest([]byte("b"))}
+	checksums := Checksums{"a": a.checksum, "b": b.checksum}
+
+	tests := map[string]struct {
+		files     []testFile
+		checksums Checksums
+		read      []string
+		err       string
+	}{
+		"valid": {
+			files:     []testFile{a, {"./b", "b", b.checksum}},
+			checksums: checksums,
+			read:      []string{"a", "./b"},
+		},
+		"fails on the first corrupt file": {
+			files:     []testFile{{"a", "corrupt", a.checksum}, b},
+			checksums: checksums,
+			read:      []string{},
+			err:       "file 'a' failed checksum validation",
+		},
+		"missing file": {
+			files:     []testFile{a},
+			checksums: checksums,
+			read:      []string{"a"},
+			err:       "file 'b' is missing from the archive",
+		},
+		"file without checksum": {
+			files:     []testFile{a, {"c", "c", ""}, b},
+			checksums: checksums,
+			read:      []string{"a"},
+			err:       "file 'c' has no checksum",
+		},
+		"truncated": {
+			files: []testFile{a, b},
+			read:  []string{"a", "b"},
+			err:   "snapshot archive is truncated",
+		},
+		"archives without checksums aren't verified": {
+			files: []testFile{{"a", "corrupt", ""}, {"b", "b", ""}},
+			read:  []string{"a", "b"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			read, err := readAll(NewArchiveVerifier(newTestArchive(t, tc.files, tc.checksums)))
+			assert.DeepEqual(t, read, tc.read)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+			} else {
+				assert.NilError(t, err)
+			}
+		})
+	}
+}
+
+func TestArchiveVerifierVerify(t *testing.T) {
+	a := testFile{"a", "corrupt", Digest([]byte("a"))}
+	v := NewArchiveVerifier(newTestArchive(t, []testFile{a}, Checksums{"a": a.checksum}))
+
+	header, r, err := v.Next()
+	assert.NilError(t, err)
+
+	// Reading only the size of the file never reaches io.EOF
+	_, err = io.ReadFull(r, make([]byte, header.Size))
+	assert.NilError(t, err)
+	assert.ErrorContains(t, r.Verify(), "file 'a' failed checksum validation")
+}
+
+func TestArchiveWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	aw := NewArchiveWriter(tw)
+	for _, f := range [][2]string{{"a", "a"}, {"b/c", "c"}} {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: f[0], Size: int64(len(f[1])), Mode: 0o644}
+		assert.NilError(t, aw.WriteFile(hdr, strings.NewReader(f[1])))
+	}
+	assert.NilError(t, aw.Close())
+	assert.NilError(t, tw.Close())
+
+	// Each file is followed by its checksum, with every checksum at the end
+	names := []string{}
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF { //nolint:errorlint // Why: Next returns io.EOF unwrapped
+			break
+		}
+		assert.NilError(t, err)
+		names = append(names, header.Name)
+	}
+	assert.DeepEqual(t, names, []string{"a", "a" + ChecksumSuffix, "b/c", "b/c" + ChecksumSuffix, ChecksumsFile})
+
+	read, err := readAll(NewArchiveVerifier(tar.NewReader(&buf)))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, read, []string{"a", "b/c"})
+}
@@ -32,6 +32,21 @@ const (
 	SnapshotNamespace = "velero"
 )
 
+// RestoreExcludedNamespaces are the namespaces that are never restored
+// from a snapshot, they're deployed before the restore happens.
+// TODO(DTSS-829): This should be moved into the generation framework
+var RestoreExcludedNamespaces = []string{ //nolint:gochecknoglobals // Why: This is a constant list
+	"nginx-ingress",
+	"kube-system",
+	"cert-manager",
+	"velero",
+	"minio",
+	"vault-secrets-operator",
+	"local-path-storage",
+	"monitoring",
+	"resourcer--bento1a",
+}
+
 // Manager contains logic for handling snapshots in a developer environment.
 type Manager struct {
 	log logrus.FieldLogger
@@ -151,19 +166,7 @@ func (m *Manager) Restore(ctx context.Context, snapshotName string) error { //no
 			IncludeClusterResources: boolptr.True(),
 			PreserveNodePorts:       boolptr.True(),
 
-			// TODO(DTSS-829): This should be moved into the generation framework
-			ExcludedNamespaces: []string{
-				"nginx-ingress",
-				"kube-system",
-				"cert-manager",
-				"nginx-ingress",
-				"velero",
-				"minio",
-				"vault-secrets-operator",
-				"local-path-storage",
-				"monitoring",
-				"resourcer--bento1a",
-			},
+			ExcludedNamespaces: RestoreExcludedNamespaces,
 		},
 	}, metav1.CreateOptions{}); err != nil {
 		return err
@@ -234,8 +237,9 @@ func (m *Manager) Restore(ctx context.Context, snapshotName string) error { //no
 	}
 }
 
-// CreateBackupStorage creates a backup storage location
-func (m *Manager) CreateBackupStorage(ctx context.Context, name, bucket string) error {
+// CreateBackupStorage creates a backup storage location for a bucket, and
+// optionally a prefix in it, in the in-cluster minio
+func (m *Manager) CreateBackupStorage(ctx context.Context, name, bucket, prefix string) error {
 	_, err := m.vc.VeleroV1().BackupStorageLocations(SnapshotNamespace).Create(ctx, &velerov1api.BackupStorageLocation{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
@@ -245,6 +249,7 @@ func (m *Manager) CreateBackupStorage(ctx context.Context, name, bucket string)
 			StorageType: velerov1api.StorageType{
 				ObjectStorage: &velerov1api.ObjectStorageLocation{
 					Bucket: bucket,
+					Prefix: prefix,
 				},
 			},
 			Config: map[string]string{
@@ -0,0 +1,69 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: This file contains functions for describing the
+// snapshot a developer environment was provisioned from.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// InfoConfigMap is the name of the configmap, in the devenv namespace,
+	// that describes the snapshot the developer environment was provisioned from
+	InfoConfigMap = "snapshot"
+
+	// InfoTargetKey is the key of the snapshot target in the InfoConfigMap
+	InfoTargetKey = "target"
+
+	// InfoChannelKey is the key of the snapshot channel in the InfoConfigMap
+	InfoChannelKey = "channel"
+
+	// InfoSnapshotKey is the key of the snapshot lockfile item in the InfoConfigMap
+	InfoSnapshotKey = "snapshot.json"
+)
+
+// Info describes the snapshot a developer environment was provisioned from
+type Info struct {
+	// Target is the snapshot target
+	Target string `json:"target,omitempty"`
+
+	// Channel is the channel the snapshot was in
+	Channel box.SnapshotLockChannel `json:"channel,omitempty"`
+
+	// Digest is the digest of the snapshot
+	Digest string `json:"digest"`
+
+	// URI is the key of the snapshot in the snapshot bucket
+	URI string `json:"uri"`
+
+	// VeleroBackupName is the name of the velero backup in the snapshot
+	VeleroBackupName string `json:"veleroBackupName"`
+}
+
+// GetInfo returns the snapshot the developer environment was provisioned from
+func GetInfo(ctx context.Context, k kubernetes.Interface) (*Info, error) {
+	cm, err := k.CoreV1().ConfigMaps("devenv").Get(ctx, InfoConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get snapshot configmap")
+	}
+
+	var itm box.SnapshotLockListItem
+	if err := json.Unmarshal([]byte(cm.Data[InfoSnapshotKey]), &itm); err != nil {
+		return nil, errors.Wrap(err, "failed to parse snapshot from configmap")
+	}
+
+	return &Info{
+		Target:           cm.Data[InfoTargetKey],
+		Channel:          box.SnapshotLockChannel(cm.Data[InfoChannelKey]),
+		Digest:           itm.Digest,
+		URI:              itm.URI,
+		VeleroBackupName: itm.VeleroBackupName,
+	}, nil
+}
@@ -26,7 +26,8 @@ type S3Config struct {
 	Region string `json:"region"`
 
 	// Key is the key to use when accessing S3, either an object
-	// or a path depending on the expected input.
+	// or a path depending on the expected input. If set in source,
+	// the snapshot at this key is used.
 	Key string `json:"s3_key"`
 
 	// SnapshotTarget is the target snapshot to use if in source, if in dest
@@ -37,8 +38,14 @@ type S3Config struct {
 	// ignored.
 	SnapshotChannel box.SnapshotLockChannel `json:"snapshot_channel,omitempty"`
 
-	// Digest is an optional digest to use when validating an object
+	// Digest is an optional digest to use when validating an object, this
+	// is a SHA-256 digest, or a MD5 digest for older snapshots. If set in
+	// source, the snapshot with this digest is used.
 	Digest string `json:"s3_md5_hash,omitempty"`
+
+	// SnapshotAge is the number of snapshots before the latest snapshot in
+	// SnapshotChannel to use if in source, if in dest ignored.
+	SnapshotAge int `json:"snapshot_age,omitempty"`
 }
 
 type Config struct {
@@ -47,4 +54,18 @@ type Config struct {
 
 	// Dest is the configuration for extracting the snapshot
 	Dest *S3Config `json:"dest"`
+
+	// DownloadDir is the directory snapshots are downloaded into, partial
+	// downloads in it are resumed. Defaults to the temporary directory.
+	DownloadDir string `json:"download_dir,omitempty"`
+
+	// Stream extracts the snapshot into Dest as it's downloaded, instead
+	// of downloading it into DownloadDir first.
+	Stream bool `json:"stream,omitempty"`
+
+	// ChunkCacheDir is the directory the chunks of chunked snapshots are
+	// cached in, so that only the chunks that aren't in it are fetched.
+	// It should outlive the cluster, e.g. be a directory on the host.
+	// Defaults to a directory in the temporary directory.
+	ChunkCacheDir string `json:"chunk_cache_dir,omitempty"`
 }
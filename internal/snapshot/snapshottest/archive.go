@@ -0,0 +1,32 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: This file contains helpers for creating snapshot
+// archives in tests.
+
+// Package snapshottest contains helpers for testing snapshots
+package snapshottest
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// NewArchive creates a tar archive of files, in order. Each file
+// is a pair of its name and contents.
+func NewArchive(t *testing.T, files [][2]string) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: f[0], Size: int64(len(f[1])), Mode: 0o644}))
+		_, err := tw.Write([]byte(f[1]))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+
+	return &buf
+}
@@ -0,0 +1,187 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: This file contains a minimal in-memory S3 for testing
+// snapshot uploads.
+
+package snapshottest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"gotest.tools/v3/assert"
+)
+
+// S3 is a minimal in-memory S3 that supports uploading, downloading, listing
+// and removing objects. Buckets are ignored, they always exist.
+type S3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// Objects returns a copy of the objects in the S3, by key
+func (s *S3) Objects() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects := make(map[string][]byte, len(s.objects))
+	for k, v := range s.objects {
+		objects[k] = v
+	}
+	return objects
+}
+
+// ServeHTTP implements http.Handler
+func (s *S3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case objectKey(r) == "" && (r.Method == http.MethodHead || r.Method == http.MethodPut):
+		// Bucket requests, e.g. BucketExists and MakeBucket
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, objectKey(r))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		s.listObjects(w, r.URL.Query().Get("prefix"))
+	default:
+		s.mu.Lock()
+		b, ok := s.objects[objectKey(r)]
+		s.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("ETag", `"fake-etag"`)
+		http.ServeContent(w, r, "", time.Unix(1600000000, 0), bytes.NewReader(b))
+	}
+}
+
+// objectKey returns the key of the object in a request, without its bucket
+func objectKey(r *http.Request) string {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// putObject stores an uploaded object, decoding it if it was uploaded
+// with a streaming signature
+func (s *S3) putObject(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		body = newChunkedReader(r.Body)
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	if s.objects == nil {
+		s.objects = make(map[string][]byte)
+	}
+	s.objects[objectKey(r)] = b
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", `"fake-etag"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// listObjects lists the objects with a prefix
+func (s *S3) listObjects(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		IsTruncated bool
+		Contents    []content
+	}{}
+
+	s.mu.Lock()
+	for k, v := range s.objects {
+		if strings.HasPrefix(k, prefix) {
+			result.Contents = append(result.Contents, content{Key: k, Size: len(v)})
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result) //nolint:errcheck // Why: the client fails on invalid responses
+}
+
+// newChunkedReader decodes a body uploaded with a streaming signature, i.e.
+// chunks of "<hex size>;chunk-signature=<signature>\r\n<data>\r\n"
+func newChunkedReader(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(line), ";", 2)[0], 16, 64)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if size == 0 {
+				pw.Close()
+				return
+			}
+
+			if _, err := io.CopyN(pw, br, size); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := br.Discard(2); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// NewS3Client starts a server for h, e.g. an S3, and returns a minio
+// client for it. The server is stopped when the test finishes.
+func NewS3Client(t *testing.T, h http.Handler) *minio.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	assert.NilError(t, err)
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Region: "us-east-1",
+	})
+	assert.NilError(t, err)
+
+	return client
+}
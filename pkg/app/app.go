@@ -183,6 +183,10 @@ type DevenvConfig struct {
 		// Required is a list of services that this service cannot function without
 		Required []string `yaml:"required"`
 	} `yaml:"dependencies"`
+
+	// Resources is the resource configuration of the app, applied
+	// by 'devenv apps top --enforce'
+	Resources ResourcesConfig `yaml:"resources"`
 }
 
 func (a *App) config() (*DevenvConfig, error) {
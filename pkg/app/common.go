@@ -20,18 +20,20 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// DevspaceVersion is the version of devspace used to deploy applications
+const DevspaceVersion = "v6.0.0-beta.8"
+
 // ensureDevspace ensures that devspace exists and returns
 // the location of devspace binary.
 // Note: this outputs text if devspace is being downloaded
 func ensureDevspace(log logrus.FieldLogger) (string, error) {
-	devspaceVersion := "v6.0.0-beta.8"
 	devspaceDownloadURL := fmt.Sprintf(
 		"https://github.com/loft-sh/devspace/releases/download/%s/devspace-%s-%s",
-		devspaceVersion,
+		DevspaceVersion,
 		runtime.GOOS,
 		runtime.GOARCH)
 
-	devspace, err := cmdutil.EnsureBinary(log, "devspace-"+devspaceVersion, "devspace", devspaceDownloadURL, "")
+	devspace, err := cmdutil.EnsureBinary(log, "devspace-"+DevspaceVersion, "devspace", devspaceDownloadURL, "")
 	if err != nil {
 		return "", err
 	}
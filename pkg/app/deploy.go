@@ -260,7 +260,7 @@ func (a *App) buildDockerImage(ctx context.Context) error {
 		"docker-image",
 		taggedImage,
 		"--name",
-		kubernetesruntime.KindClusterName,
+		kubernetesruntime.GetKindClusterName(),
 	)
 
 	return errors.Wrap(err, "failed to push docker image to Kubernetes")
@@ -348,7 +348,7 @@ func (a *App) deleteJobs(ctx context.Context) error {
 	// Delete all jobs with a db-migration annotation.
 	err := devenvutil.DeleteObjects(ctx, a.log, a.k, a.conf, devenvutil.DeleteObjectsObjects{
 		// TODO: the namespace is not quiet right I think.
-		Namespaces: []string{a.RepositoryName, fmt.Sprintf("%s--bento1a", a.RepositoryName)},
+		Namespaces: Namespaces(a.RepositoryName),
 		Type: &batchv1.Job{
 			TypeMeta: v1.TypeMeta{
 				Kind:       "Job",
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
+	"github.com/getoutreach/gobox/pkg/box"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// resourcesObjectName is the name of the ResourceQuota and LimitRange
+// created in an application's namespaces by EnforceResources
+const resourcesObjectName = "devenv"
+
+// ResourcesConfig is the resource configuration of an application in
+// devenv.yaml. Keys are resource names, e.g. requests.memory for Quota
+// or memory for DefaultLimits, and values are quantities, e.g. 1Gi.
+type ResourcesConfig struct {
+	// Quota is the total amount of resources that all pods in an
+	// application's namespace may use.
+	Quota map[string]string `yaml:"quota"`
+
+	// DefaultRequests are the requests set on containers that don't
+	// set their own.
+	DefaultRequests map[string]string `yaml:"defaultRequests"`
+
+	// DefaultLimits are the limits set on containers that don't
+	// set their own.
+	DefaultLimits map[string]string `yaml:"defaultLimits"`
+}
+
+// Namespaces returns the namespaces that an application is deployed into
+func Namespaces(appName string) []string {
+	return []string{appName, fmt.Sprintf("%s--bento1a", appName)}
+}
+
+// parseResourceList converts a map of resource names to quantities
+// into a corev1.ResourceList
+func parseResourceList(m map[string]string) (corev1.ResourceList, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	list := make(corev1.ResourceList, len(m))
+	for k, v := range m {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid quantity '%s' for resource '%s'", v, k)
+		}
+		list[corev1.ResourceName(k)] = q
+	}
+
+	return list, nil
+}
+
+// resourceObjects returns the ResourceQuota and LimitRange to create for
+// the provided configuration. Either are nil if not configured.
+func resourceObjects(conf *ResourcesConfig) (*corev1.ResourceQuota, *corev1.LimitRange, error) {
+	hard, err := parseResourceList(conf.Quota)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse quota")
+	}
+
+	defaultRequests, err := parseResourceList(conf.DefaultRequests)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse default requests")
+	}
+
+	defaultLimits, err := parseResourceList(conf.DefaultLimits)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse default limits")
+	}
+
+	var quota *corev1.ResourceQuota
+	if hard != nil {
+		quota = &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: resourcesObjectName},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		}
+	}
+
+	var limitRange *corev1.LimitRange
+	if defaultRequests != nil || defaultLimits != nil {
+		limitRange = &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: resourcesObjectName},
+			Spec: corev1.LimitRangeSpec{
+				Limits: []corev1.LimitRangeItem{{
+					Type:           corev1.LimitTypeContainer,
+					Default:        defaultLimits,
+					DefaultRequest: defaultRequests,
+				}},
+			},
+		}
+	}
+
+	return quota, limitRange, nil
+}
+
+// EnforceResources is a wrapper around NewApp().EnforceResources()
+func EnforceResources(ctx context.Context, log logrus.FieldLogger, k kubernetes.Interface, b *box.Config,
+	conf *rest.Config, appNameOrPath string, kr kubernetesruntime.RuntimeConfig) error {
+	app, err := NewApp(ctx, log, k, b, conf, appNameOrPath, &kr)
+	if err != nil {
+		return errors.Wrap(err, "parse app")
+	}
+	defer app.Close()
+
+	return app.EnforceResources(ctx)
+}
+
+// EnforceResources creates, or updates, a ResourceQuota and LimitRange in the
+// namespaces of the application based on the resources in its devenv.yaml.
+// Namespaces that don't exist are skipped.
+func (a *App) EnforceResources(ctx context.Context) error {
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+
+	quota, limitRange, err := resourceObjects(&cfg.Resources)
+	if err != nil {
+		return errors.Wrapf(err, "invalid resources in devenv.yaml")
+	}
+
+	if quota == nil && limitRange == nil {
+		a.log.Info("No resources configured in devenv.yaml, skipping")
+		return nil
+	}
+
+	for _, ns := range Namespaces(a.RepositoryName) {
+		if _, err := a.k.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{}); kerrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to get namespace %s", ns)
+		}
+
+		if quota != nil {
+			a.log.WithField("namespace", ns).Info("Applying resource quota")
+			if err := a.applyResourceQuota(ctx, ns, quota.DeepCopy()); err != nil {
+				return err
+			}
+		}
+
+		if limitRange != nil {
+			a.log.WithField("namespace", ns).Info("Applying limit range")
+			if err := a.applyLimitRange(ctx, ns, limitRange.DeepCopy()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyResourceQuota creates, or updates, a ResourceQuota
+func (a *App) applyResourceQuota(ctx context.Context, namespace string, quota *corev1.ResourceQuota) error {
+	existing, err := a.k.CoreV1().ResourceQuotas(namespace).Get(ctx, quota.Name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		_, err = a.k.CoreV1().ResourceQuotas(namespace).Create(ctx, quota, metav1.CreateOptions{})
+		return errors.Wrapf(err, "failed to create resource quota in %s", namespace)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to get resource quota in %s", namespace)
+	}
+
+	existing.Spec = quota.Spec
+	_, err = a.k.CoreV1().ResourceQuotas(namespace).Update(ctx, existing, metav1.UpdateOptions{})
+	return errors.Wrapf(err, "failed to update resource quota in %s", namespace)
+}
+
+// applyLimitRange creates, or updates, a LimitRange
+func (a *App) applyLimitRange(ctx context.Context, namespace string, limitRange *corev1.LimitRange) error {
+	existing, err := a.k.CoreV1().LimitRanges(namespace).Get(ctx, limitRange.Name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		_, err = a.k.CoreV1().LimitRanges(namespace).Create(ctx, limitRange, metav1.CreateOptions{})
+		return errors.Wrapf(err, "failed to create limit range in %s", namespace)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to get limit range in %s", namespace)
+	}
+
+	existing.Spec = limitRange.Spec
+	_, err = a.k.CoreV1().LimitRanges(namespace).Update(ctx, existing, metav1.UpdateOptions{})
+	return errors.Wrapf(err, "failed to update limit range in %s", namespace)
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestResourceObjects(t *testing.T) {
+	quota, limitRange, err := resourceObjects(&ResourcesConfig{})
+	assert.NilError(t, err)
+	assert.Assert(t, quota == nil)
+	assert.Assert(t, limitRange == nil)
+
+	quota, limitRange, err = resourceObjects(&ResourcesConfig{
+		Quota:         map[string]string{"requests.memory": "2Gi"},
+		DefaultLimits: map[string]string{"memory": "512Mi"},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, quota.Spec.Hard.Name("requests.memory", resource.BinarySI).String(), "2Gi")
+	assert.Equal(t, len(limitRange.Spec.Limits), 1)
+	assert.Equal(t, limitRange.Spec.Limits[0].Type, corev1.LimitTypeContainer)
+	assert.Equal(t, limitRange.Spec.Limits[0].Default.Memory().String(), "512Mi")
+	assert.Assert(t, limitRange.Spec.Limits[0].DefaultRequest == nil)
+
+	_, _, err = resourceObjects(&ResourcesConfig{Quota: map[string]string{"cpu": "lots"}})
+	assert.ErrorContains(t, err, "invalid quantity")
+}
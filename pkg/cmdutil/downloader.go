@@ -106,17 +106,26 @@ func downloadPureFile(resp *http.Response, execPath string) error {
 	return nil
 }
 
-// EnsureBinary downloads a binary if it's not found, based on the name of the binary
-// otherwise it returns the path to it.
-func EnsureBinary(log logrus.FieldLogger, name, downloadDesc, downloadURL, archiveFileName string) (string, error) { //nolint:funlen
+// GetDependencyPath returns the path that a binary downloaded by EnsureBinary
+// is stored at, based on the name of the binary. The binary may not exist.
+func GetDependencyPath(name string) (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 
 	// TODO: We need to figure out where to store these paths we use.
-	sourceDir := filepath.Join(homeDir, ".local", "dev-environment", ".deps")
-	execPath := filepath.Join(sourceDir, name)
+	return filepath.Join(homeDir, ".local", "dev-environment", ".deps", name), nil
+}
+
+// EnsureBinary downloads a binary if it's not found, based on the name of the binary
+// otherwise it returns the path to it.
+func EnsureBinary(log logrus.FieldLogger, name, downloadDesc, downloadURL, archiveFileName string) (string, error) { //nolint:funlen
+	execPath, err := GetDependencyPath(name)
+	if err != nil {
+		return "", err
+	}
+	sourceDir := filepath.Dir(execPath)
 
 	// TODO: better support for other archives in the future
 	isArchive := false
@@ -26,14 +26,33 @@ func (c *Config) ParseContext() (runtime, name string) {
 	return spl[0], spl[1]
 }
 
-// getConfigFile returns the path to the devenv config file
-func getConfigFile() (string, error) {
+// ConfigDirEnvVar is an environment variable that overrides the
+// directory devenv configuration files are stored in
+const ConfigDirEnvVar = "DEVENV_CONFIG_DIR"
+
+// GetConfigDir returns the path to the directory devenv
+// configuration files are stored in
+func GetConfigDir() (string, error) {
+	if dir := os.Getenv(ConfigDirEnvVar); dir != "" {
+		return dir, nil
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", errors.Wrap(err, "failed to read user's home dir")
 	}
 
-	return filepath.Join(homeDir, ".config", "devenv", "config.yaml"), nil
+	return filepath.Join(homeDir, ".config", "devenv"), nil
+}
+
+// getConfigFile returns the path to the devenv config file
+func getConfigFile() (string, error) {
+	confDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(confDir, "config.yaml"), nil
 }
 
 // LoadConfig reads the config from disk
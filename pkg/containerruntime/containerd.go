@@ -14,12 +14,13 @@ import (
 	olog "github.com/getoutreach/gobox/pkg/log"
 )
 
-// RemoveImage deletes an image from the containerruntime
-func RemoveImage(ctx context.Context, image string) error {
-	ctx = trace.StartCall(ctx, "containerruntime.RemoveImage", olog.F{"image": image})
+// RemoveImage deletes an image from the containerruntime of a kind node
+// container, e.g. kubernetesruntime.GetKindControlPlaneContainer()
+func RemoveImage(ctx context.Context, container, image string) error {
+	ctx = trace.StartCall(ctx, "containerruntime.RemoveImage", olog.F{"container": container, "image": image})
 	defer trace.EndCall(ctx)
 
-	if !HasImage(ctx, image) {
+	if !HasImage(ctx, container, image) {
 		return nil
 	}
 
@@ -29,7 +30,7 @@ func RemoveImage(ctx context.Context, image string) error {
 		false,
 		"docker",
 		"exec",
-		ContainerName,
+		container,
 		"ctr",
 		"--namespace",
 		"k8s.io",
@@ -40,15 +41,16 @@ func RemoveImage(ctx context.Context, image string) error {
 	return trace.SetCallStatus(ctx, err)
 }
 
-// HasImage checks to see if the containerruntime has the given image in its cache
-func HasImage(ctx context.Context, image string) bool {
-	ctx = trace.StartCall(ctx, "containerruntime.HasImage", olog.F{"image": image})
+// HasImage checks to see if the containerruntime of a kind node container
+// has the given image in its cache
+func HasImage(ctx context.Context, container, image string) bool {
+	ctx = trace.StartCall(ctx, "containerruntime.HasImage", olog.F{"container": container, "image": image})
 	defer trace.EndCall(ctx)
 
 	//nolint:gosec // Why: We need to pass args.
 	cmd := exec.CommandContext(ctx, "docker",
 		"exec",
-		ContainerName,
+		container,
 		"ctr", "--namespace", "k8s.io", "images", "list", "-q",
 		fmt.Sprintf("name==%s", image),
 	)
@@ -65,9 +67,10 @@ func HasImage(ctx context.Context, image string) bool {
 	return false
 }
 
-// PullImage fetches an image inside for our containerruntime to use.
-func PullImage(ctx context.Context, image string) error {
-	ctx = trace.StartCall(ctx, "containerruntime.PullImage", olog.F{"image": image})
+// PullImage fetches an image inside a kind node container for its
+// containerruntime to use.
+func PullImage(ctx context.Context, container, image string) error {
+	ctx = trace.StartCall(ctx, "containerruntime.PullImage", olog.F{"container": container, "image": image})
 	defer trace.EndCall(ctx)
 
 	homedir, err := os.UserHomeDir()
@@ -88,7 +91,7 @@ func PullImage(ctx context.Context, image string) error {
 		false,
 		"docker",
 		"exec",
-		ContainerName,
+		container,
 		"ctr",
 		"--namespace",
 		"k8s.io",
@@ -0,0 +1,356 @@
+// Package crashes captures the logs, specs and events of crashing
+// pods so that they can be looked at after the pods are gone.
+package crashes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// metadataFile is the file in a crash directory that
+	// contains the Crash metadata
+	metadataFile = "crash.json"
+
+	// idFormat is the time format of crash IDs, which are
+	// also the name of their directories
+	idFormat = "20060102T150405.000Z"
+
+	// maxCrashes is the number of crashes that are kept, older
+	// crashes are removed when new ones are captured
+	maxCrashes = 50
+
+	// maxLogBytes is the maximum number of bytes of logs
+	// that are captured per container
+	maxLogBytes = 5 * 1024 * 1024
+)
+
+// Crash is a capture of one, or more, crashing containers
+type Crash struct {
+	// ID is the ID of the crash, this is the name of its directory
+	ID string `json:"id"`
+
+	// Time is when the crash was captured
+	Time time.Time `json:"time"`
+
+	// Containers are the crashing containers that were captured
+	Containers []Container `json:"containers"`
+}
+
+// Container is a crashing container
+type Container struct {
+	Namespace    string    `json:"namespace"`
+	Pod          string    `json:"pod"`
+	PodUID       string    `json:"podUID"`
+	Container    string    `json:"container"`
+	Reason       string    `json:"reason"`
+	ExitCode     int32     `json:"exitCode"`
+	RestartCount int32     `json:"restartCount"`
+	FinishedAt   time.Time `json:"finishedAt,omitempty"`
+
+	// previous denotes if the crashed instance of the container
+	// is the previous one, i.e. it is waiting to restart
+	previous bool
+}
+
+// key uniquely identifies a crash of a container instance
+func (c *Container) key() string {
+	return fmt.Sprintf("%s/%s/%d", c.PodUID, c.Container, c.RestartCount)
+}
+
+// Dir returns the directory of a pod's files in a crash directory
+func (c *Container) Dir() string {
+	return c.Namespace + "_" + c.Pod
+}
+
+// LogFile returns the path of the container's logs in a crash directory
+func (c *Container) LogFile() string {
+	return filepath.Join(c.Dir(), c.Container+".log")
+}
+
+// GetDir returns the directory crashes are stored in
+func GetDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get user home dir")
+	}
+
+	return filepath.Join(homeDir, ".local", "dev-environment", "crashes"), nil
+}
+
+// FindCrashingContainers returns the containers of a pod that are in
+// CrashLoopBackOff, or have terminated with a non-zero exit code.
+func FindCrashingContainers(pod *corev1.Pod) []Container {
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+	crashing := make([]Container, 0)
+	for i := range statuses {
+		cs := &statuses[i]
+
+		// A container in CrashLoopBackOff is waiting to restart, the
+		// crash is its last termination.
+		terminated := cs.State.Terminated
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
+			terminated = cs.LastTerminationState.Terminated
+		}
+		if terminated == nil || terminated.ExitCode == 0 {
+			continue
+		}
+
+		c := Container{
+			Namespace:    pod.Namespace,
+			Pod:          pod.Name,
+			PodUID:       string(pod.UID),
+			Container:    cs.Name,
+			Reason:       terminated.Reason,
+			ExitCode:     terminated.ExitCode,
+			RestartCount: cs.RestartCount,
+			FinishedAt:   terminated.FinishedAt.Time,
+		}
+		if terminated != cs.State.Terminated {
+			c.Reason = cs.State.Waiting.Reason
+			c.previous = true
+		}
+		crashing = append(crashing, c)
+	}
+
+	return crashing
+}
+
+// List returns the captured crashes, newest first
+func List() ([]Crash, error) {
+	dir, err := GetDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Crash{}, nil
+		}
+		return nil, errors.Wrap(err, "failed to read crashes directory")
+	}
+
+	crashes := make([]Crash, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		c, err := readCrash(filepath.Join(dir, e.Name()))
+		if err != nil {
+			// Skip partially written, or otherwise invalid, crashes
+			continue
+		}
+		crashes = append(crashes, *c)
+	}
+
+	sort.Slice(crashes, func(i, j int) bool {
+		return crashes[i].ID > crashes[j].ID
+	})
+
+	return crashes, nil
+}
+
+// Get returns a crash by its ID, and the directory its files are in
+func Get(id string) (*Crash, string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, "", fmt.Errorf("invalid crash id '%s'", id)
+	}
+
+	dir, err := GetDir()
+	if err != nil {
+		return nil, "", err
+	}
+	dir = filepath.Join(dir, id)
+
+	c, err := readCrash(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", fmt.Errorf("crash '%s' not found", id)
+		}
+		return nil, "", err
+	}
+
+	return c, dir, nil
+}
+
+// readCrash reads the metadata of the crash in dir
+func readCrash(dir string) (*Crash, error) {
+	b, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var c Crash
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.Wrap(err, "failed to parse crash metadata")
+	}
+
+	return &c, nil
+}
+
+// Capture saves the previous logs, spec and events of the crashing containers of
+// the provided pods into a new crash directory. Containers that were captured
+// before are skipped, if there is nothing new to capture nil is returned.
+func Capture(ctx context.Context, k kubernetes.Interface, log logrus.FieldLogger, pods []*corev1.Pod) (*Crash, error) {
+	existing, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	captured := make(map[string]bool)
+	for i := range existing {
+		for j := range existing[i].Containers {
+			captured[existing[i].Containers[j].key()] = true
+		}
+	}
+
+	now := time.Now().UTC()
+	crash := &Crash{ID: now.Format(idFormat), Time: now, Containers: make([]Container, 0)}
+	crashingPods := make([]*corev1.Pod, 0)
+	for _, p := range pods {
+		var found bool
+		for _, c := range FindCrashingContainers(p) {
+			if captured[c.key()] {
+				continue
+			}
+			crash.Containers = append(crash.Containers, c)
+			found = true
+		}
+		if found {
+			crashingPods = append(crashingPods, p)
+		}
+	}
+
+	if len(crash.Containers) == 0 {
+		return nil, nil
+	}
+
+	baseDir, err := GetDir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(baseDir, crash.ID)
+
+	// Partially captured crashes would be listed without their
+	// metadata, and never captured again, so they're removed
+	if err := writeCrash(ctx, k, log, dir, crash, crashingPods); err != nil {
+		os.RemoveAll(dir) //nolint:errcheck // Why: Best effort
+		return nil, err
+	}
+
+	prune(baseDir, existing, log)
+
+	return crash, nil
+}
+
+// writeCrash captures the pods and logs of a crash into dir
+func writeCrash(ctx context.Context, k kubernetes.Interface, log logrus.FieldLogger, dir string,
+	crash *Crash, crashingPods []*corev1.Pod) error {
+	for _, p := range crashingPods {
+		if err := capturePod(ctx, k, dir, p); err != nil {
+			return err
+		}
+	}
+
+	for i := range crash.Containers {
+		c := &crash.Containers[i]
+		if err := captureLogs(ctx, k, filepath.Join(dir, c.LogFile()), c); err != nil {
+			// Logs may have been removed already, the spec and events are still useful
+			log.WithError(err).WithField("container", c.Namespace+"/"+c.Pod+"/"+c.Container).
+				Warn("Failed to capture container logs")
+		}
+	}
+
+	// The metadata is written last, so only complete crashes are listed
+	b, err := json.MarshalIndent(crash, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode crash metadata")
+	}
+	return errors.Wrap(os.WriteFile(filepath.Join(dir, metadataFile), b, 0o600), "failed to write crash metadata")
+}
+
+// capturePod saves the spec and events of a pod
+func capturePod(ctx context.Context, k kubernetes.Interface, dir string, p *corev1.Pod) error {
+	podDir := filepath.Join(dir, p.Namespace+"_"+p.Name)
+	if err := os.MkdirAll(podDir, 0o755); err != nil {
+		return errors.Wrap(err, "failed to create crash directory")
+	}
+
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode pod")
+	}
+	if err := os.WriteFile(filepath.Join(podDir, "pod.yaml"), b, 0o600); err != nil {
+		return errors.Wrap(err, "failed to write pod")
+	}
+
+	events, err := k.CoreV1().Events(p.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.uid", string(p.UID)).String(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list events of pod %s/%s", p.Namespace, p.Name)
+	}
+
+	b, err = yaml.Marshal(events.Items)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode events")
+	}
+	return errors.Wrap(os.WriteFile(filepath.Join(podDir, "events.yaml"), b, 0o600), "failed to write events")
+}
+
+// captureLogs saves the logs of the crashed instance of a container
+func captureLogs(ctx context.Context, k kubernetes.Interface, path string, c *Container) error {
+	limit := int64(maxLogBytes)
+
+	// Containers that are waiting to restart have their
+	// crash logs in the previous instance.
+	r, err := kube.StreamContainerLogs(ctx, k, c.Pod, c.Namespace, c.Container, &corev1.PodLogOptions{
+		Previous:   c.previous,
+		LimitBytes: &limit,
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create log file")
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return errors.Wrap(err, "failed to write logs")
+}
+
+// prune removes the oldest crashes, so that at most maxCrashes are kept.
+// existing are the crashes before the latest one was captured.
+func prune(dir string, existing []Crash, log logrus.FieldLogger) {
+	// existing is sorted newest first, and the latest crash counts too
+	for i := maxCrashes - 1; i < len(existing); i++ {
+		if err := os.RemoveAll(filepath.Join(dir, existing[i].ID)); err != nil {
+			log.WithError(err).WithField("crash", existing[i].ID).Warn("Failed to remove old crash")
+		}
+	}
+}
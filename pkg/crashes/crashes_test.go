@@ -0,0 +1,135 @@
+package crashes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestFindCrashingContainers(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: "app", UID: "1234"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{
+				Name:         "crashloop",
+				RestartCount: 3,
+				State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"},
+				},
+			},
+			{
+				Name:  "failed",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}},
+			},
+			{
+				Name:  "completed",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}},
+			},
+			{
+				Name:  "running",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			},
+		}},
+	}
+
+	assert.DeepEqual(t, FindCrashingContainers(pod), []Container{
+		{
+			Namespace: "app", Pod: "app-1", PodUID: "1234", Container: "crashloop",
+			Reason: "CrashLoopBackOff", ExitCode: 1, RestartCount: 3, previous: true,
+		},
+		{
+			Namespace: "app", Pod: "app-1", PodUID: "1234", Container: "failed",
+			Reason: "OOMKilled", ExitCode: 137,
+		},
+	}, cmp.AllowUnexported(Container{}))
+}
+
+func TestCapture(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ctx := context.Background()
+	log := logrus.New()
+	log.Out = io.Discard
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: "app", UID: "1234"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "app",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+		}}},
+	}
+	k := fake.NewSimpleClientset(pod)
+
+	crash, err := Capture(ctx, k, log, []*corev1.Pod{pod})
+	assert.NilError(t, err)
+	assert.Assert(t, crash != nil)
+	assert.Equal(t, len(crash.Containers), 1)
+
+	c, dir, err := Get(crash.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, c.ID, crash.ID)
+
+	// The fake clientset returns "fake logs" for every container
+	b, err := os.ReadFile(filepath.Join(dir, c.Containers[0].LogFile()))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "fake logs")
+
+	_, err = os.Stat(filepath.Join(dir, "app_app-1", "pod.yaml"))
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "app_app-1", "events.yaml"))
+	assert.NilError(t, err)
+
+	// The same crash isn't captured twice
+	crash, err = Capture(ctx, k, log, []*corev1.Pod{pod})
+	assert.NilError(t, err)
+	assert.Assert(t, crash == nil)
+
+	crashes, err := List()
+	assert.NilError(t, err)
+	assert.Equal(t, len(crashes), 1)
+
+	_, _, err = Get("../crashes")
+	assert.ErrorContains(t, err, "invalid crash id")
+}
+
+func TestCaptureRemovesPartialCrashes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	log := logrus.New()
+	log.Out = io.Discard
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: "app", UID: "1234"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "app",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+		}}},
+	}
+	k := fake.NewSimpleClientset(pod)
+	k.PrependReactor("list", "events", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+
+	// The pod spec was written before the events failed to be listed
+	_, err := Capture(context.Background(), k, log, []*corev1.Pod{pod})
+	assert.ErrorContains(t, err, "connection refused")
+
+	dir, err := GetDir()
+	assert.NilError(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+}
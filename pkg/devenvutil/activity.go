@@ -0,0 +1,66 @@
+package devenvutil
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// activityFile is the file, in ~/.local/dev-environment, whose modification
+// time is the last time the devenv CLI was invoked.
+const activityFile = "last-activity"
+
+// getActivityFile returns the path to the activity file
+func getActivityFile() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get user home dir")
+	}
+
+	return filepath.Join(homeDir, ".local", "dev-environment", activityFile), nil
+}
+
+// RecordActivity records that the devenv CLI was just invoked, this
+// is used by the agent to determine if the developer environment is idle.
+func RecordActivity() error {
+	path, err := getActivityFile()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrap(err, "failed to update activity file")
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to create activity file")
+		}
+		return f.Close()
+	}
+
+	return nil
+}
+
+// LastActivity returns the last time the devenv CLI was invoked, if
+// it has never been invoked a zero time is returned.
+func LastActivity() (time.Time, error) {
+	path, err := getActivityFile()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, errors.Wrap(err, "failed to read activity file")
+	}
+
+	return info.ModTime(), nil
+}
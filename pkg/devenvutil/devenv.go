@@ -10,6 +10,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/getoutreach/devenv/cmd/devenv/status"
 	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/crashes"
 	"github.com/getoutreach/devenv/pkg/kubernetesruntime"
 	"github.com/getoutreach/devenv/pkg/worker"
 	"github.com/getoutreach/gobox/pkg/async"
@@ -243,6 +244,14 @@ func WaitForAllPodsToBeReady(ctx context.Context, k kubernetes.Interface, log lo
 		log.WithError(err).WithField("pods", PodsStateInfo(unreadyPods)).
 			Info("Waiting for pods to be ready")
 
+		// Capture crashing pods now, their logs may be gone by the
+		// time someone looks into why they never became ready.
+		if crash, err := crashes.Capture(ctx, k, log, unreadyPods); err != nil { //nolint:govet // Why: OK w/ err shadow
+			log.WithError(err).Warn("Failed to capture crashing pods")
+		} else if crash != nil {
+			log.WithField("crash", crash.ID).Warn("Captured crashing pods, run 'devenv crashes show' to view them")
+		}
+
 		async.Sleep(ctx, 30*time.Second)
 	}
 	if ctx.Err() != nil {
@@ -0,0 +1,222 @@
+package devenvutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/getoutreach/gobox/pkg/async"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SuspendedReplicasAnnotation is the annotation that stores the number of
+// replicas a workload had before it was suspended by SuspendWorkloads
+const SuspendedReplicasAnnotation = "devenv.outreach.io/suspended-replicas"
+
+// suspendTimeout is how long to wait for workloads to scale
+// down, or up, before giving up.
+const suspendTimeout = 5 * time.Minute
+
+// suspendSkipNamespaces are namespaces whose workloads are required for
+// the cluster itself to function, so they are never suspended.
+//
+//nolint:gochecknoglobals // Why: Used as a constant set
+var suspendSkipNamespaces = map[string]bool{
+	"kube-system":        true,
+	"local-path-storage": true,
+}
+
+// replicasPatch creates a merge patch that sets the replicas of a workload
+// and the suspended replicas annotation. If annotation is nil, the annotation
+// is removed.
+func replicasPatch(replicas int32, annotation *string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				SuspendedReplicasAnnotation: annotation,
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	})
+}
+
+// suspendedReplicas returns the number of replicas recorded on a
+// suspended workload, or false if it wasn't suspended.
+func suspendedReplicas(annotations map[string]string) (int32, bool) {
+	v, ok := annotations[SuspendedReplicasAnnotation]
+	if !ok {
+		return 0, false
+	}
+
+	replicas, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return int32(replicas), true
+}
+
+// SuspendWorkloads gracefully scales down all workloads in the developer
+// environment, recording their replica counts so they can be restored by
+// ResumeWorkloads. Deployments are scaled down first, as they generally
+// depend on statefulsets (e.g. databases), which are then scaled down so
+// that they can flush their data to disk.
+func SuspendWorkloads(ctx context.Context, k kubernetes.Interface, log logrus.FieldLogger) error { //nolint:funlen
+	deployments, err := k.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list deployments")
+	}
+
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		if suspendSkipNamespaces[d.Namespace] || d.Spec.Replicas == nil || *d.Spec.Replicas == 0 {
+			continue
+		}
+
+		replicas := strconv.Itoa(int(*d.Spec.Replicas))
+		patch, err := replicasPatch(0, &replicas) //nolint:govet // Why: OK w/ err shadow
+		if err != nil {
+			return err
+		}
+
+		log.WithField("key", d.Namespace+"/"+d.Name).Info("Scaling down deployment")
+		if _, err := k.AppsV1().Deployments(d.Namespace).Patch(ctx, d.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return errors.Wrapf(err, "failed to scale down deployment %s/%s", d.Namespace, d.Name)
+		}
+	}
+
+	statefulsets, err := k.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list statefulsets")
+	}
+
+	suspended := []*appsv1.StatefulSet{}
+	for i := range statefulsets.Items {
+		s := &statefulsets.Items[i]
+		if suspendSkipNamespaces[s.Namespace] || s.Spec.Replicas == nil || *s.Spec.Replicas == 0 {
+			continue
+		}
+
+		replicas := strconv.Itoa(int(*s.Spec.Replicas))
+		patch, err := replicasPatch(0, &replicas) //nolint:govet // Why: OK w/ err shadow
+		if err != nil {
+			return err
+		}
+
+		log.WithField("key", s.Namespace+"/"+s.Name).Info("Scaling down statefulset")
+		if _, err := k.AppsV1().StatefulSets(s.Namespace).Patch(ctx, s.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return errors.Wrapf(err, "failed to scale down statefulset %s/%s", s.Namespace, s.Name)
+		}
+		suspended = append(suspended, s)
+	}
+
+	// Wait for the statefulsets to terminate, which gives them a chance to flush
+	// their data before the node is stopped.
+	return waitForStatefulSets(ctx, k, log, suspended, func(s *appsv1.StatefulSet, _ int32) bool {
+		return s.Status.Replicas == 0
+	})
+}
+
+// ResumeWorkloads restores the replica counts of workloads suspended by
+// SuspendWorkloads. This is the reverse of SuspendWorkloads, statefulsets
+// are scaled up and waited on before deployments are.
+func ResumeWorkloads(ctx context.Context, k kubernetes.Interface, log logrus.FieldLogger) error { //nolint:funlen
+	statefulsets, err := k.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list statefulsets")
+	}
+
+	resumed := []*appsv1.StatefulSet{}
+	for i := range statefulsets.Items {
+		s := &statefulsets.Items[i]
+		replicas, ok := suspendedReplicas(s.Annotations)
+		if !ok {
+			continue
+		}
+
+		patch, err := replicasPatch(replicas, nil) //nolint:govet // Why: OK w/ err shadow
+		if err != nil {
+			return err
+		}
+
+		log.WithField("key", s.Namespace+"/"+s.Name).Info("Scaling up statefulset")
+		if _, err := k.AppsV1().StatefulSets(s.Namespace).Patch(ctx, s.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return errors.Wrapf(err, "failed to scale up statefulset %s/%s", s.Namespace, s.Name)
+		}
+		resumed = append(resumed, s)
+	}
+
+	if err := waitForStatefulSets(ctx, k, log, resumed, func(s *appsv1.StatefulSet, replicas int32) bool { //nolint:govet // Why: OK w/ err shadow
+		return s.Status.ReadyReplicas >= replicas
+	}); err != nil {
+		// Deployments may still come up, so don't block on this
+		log.WithError(err).Warn("Not all statefulsets became ready, continuing")
+	}
+
+	deployments, err := k.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list deployments")
+	}
+
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		replicas, ok := suspendedReplicas(d.Annotations)
+		if !ok {
+			continue
+		}
+
+		patch, err := replicasPatch(replicas, nil) //nolint:govet // Why: OK w/ err shadow
+		if err != nil {
+			return err
+		}
+
+		log.WithField("key", d.Namespace+"/"+d.Name).Info("Scaling up deployment")
+		if _, err := k.AppsV1().Deployments(d.Namespace).Patch(ctx, d.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return errors.Wrapf(err, "failed to scale up deployment %s/%s", d.Namespace, d.Name)
+		}
+	}
+
+	return nil
+}
+
+// waitForStatefulSets waits for the done function to return true for all of the
+// provided statefulsets. done is passed the current statefulset and the number
+// of replicas it had when it was suspended.
+func waitForStatefulSets(ctx context.Context, k kubernetes.Interface, log logrus.FieldLogger,
+	statefulsets []*appsv1.StatefulSet, done func(*appsv1.StatefulSet, int32) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, suspendTimeout)
+	defer cancel()
+
+	for ctx.Err() == nil {
+		waiting := []string{}
+		for _, s := range statefulsets {
+			cur, err := k.AppsV1().StatefulSets(s.Namespace).Get(ctx, s.Name, metav1.GetOptions{})
+			if err != nil {
+				return errors.Wrapf(err, "failed to get statefulset %s/%s", s.Namespace, s.Name)
+			}
+
+			replicas, _ := suspendedReplicas(s.Annotations)
+			if !done(cur, replicas) {
+				waiting = append(waiting, s.Namespace+"/"+s.Name)
+			}
+		}
+
+		if len(waiting) == 0 {
+			return nil
+		}
+
+		log.WithField("statefulsets", waiting).Info("Waiting for statefulsets")
+		async.Sleep(ctx, 5*time.Second)
+	}
+
+	return fmt.Errorf("timed out waiting for statefulsets")
+}
@@ -0,0 +1,67 @@
+package devenvutil
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestSuspendResumeWorkloads(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	log.Out = io.Discard
+
+	k := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: "kube-system"},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(1)},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "mysql"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(1)},
+			Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1},
+		},
+	)
+
+	assert.NilError(t, SuspendWorkloads(ctx, k, log))
+
+	d, err := k.AppsV1().Deployments("app").Get(ctx, "app", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *d.Spec.Replicas, int32(0))
+	assert.Equal(t, d.Annotations[SuspendedReplicasAnnotation], "2")
+
+	d, err = k.AppsV1().Deployments("kube-system").Get(ctx, "coredns", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *d.Spec.Replicas, int32(1))
+
+	s, err := k.AppsV1().StatefulSets("mysql").Get(ctx, "mysql", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *s.Spec.Replicas, int32(0))
+	assert.Equal(t, s.Annotations[SuspendedReplicasAnnotation], "1")
+
+	assert.NilError(t, ResumeWorkloads(ctx, k, log))
+
+	d, err = k.AppsV1().Deployments("app").Get(ctx, "app", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *d.Spec.Replicas, int32(2))
+	_, ok := d.Annotations[SuspendedReplicasAnnotation]
+	assert.Assert(t, !ok)
+
+	s, err = k.AppsV1().StatefulSets("mysql").Get(ctx, "mysql", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *s.Spec.Replicas, int32(1))
+}
@@ -0,0 +1,184 @@
+package devenvutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/getoutreach/gobox/pkg/app"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// tracesFile is the file, in ~/.local/dev-environment, that
+	// recent CLI invocations are recorded in
+	tracesFile = "traces.jsonl"
+
+	// maxTraces is the number of CLI invocations that are kept
+	maxTraces = 100
+)
+
+// Trace is a recorded invocation of the devenv CLI
+type Trace struct {
+	// Time is when the command was started
+	Time time.Time `json:"time"`
+
+	// Command is the full name of the command, e.g. apps deploy
+	Command string `json:"command"`
+
+	// Args are the arguments passed to the command
+	Args []string `json:"args,omitempty"`
+
+	// Duration is how long the command took to run
+	Duration time.Duration `json:"duration"`
+
+	// Error is the error the command returned, if any
+	Error string `json:"error,omitempty"`
+
+	// Version is the version of the devenv CLI that ran the command
+	Version string `json:"version"`
+}
+
+// getTracesFile returns the path to the traces file
+func getTracesFile() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get user home dir")
+	}
+
+	return filepath.Join(homeDir, ".local", "dev-environment", tracesFile), nil
+}
+
+// RecordTrace appends a trace to the traces file, keeping the most recent maxTraces
+func RecordTrace(t *Trace) error {
+	path, err := getTracesFile()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode trace")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:govet // Why: OK shadowing err
+		return errors.Wrap(err, "failed to create traces directory")
+	}
+
+	// Every command records a trace, so commands running at the same
+	// time have to take turns rewriting the file
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "failed to read traces file")
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(existing)), "\n")
+	if lines[0] == "" {
+		lines = nil
+	}
+	lines = append(lines, string(b))
+	if len(lines) > maxTraces {
+		lines = lines[len(lines)-maxTraces:]
+	}
+
+	// Write to a temporary file first, so RecentTraces never reads a
+	// partially written file
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return errors.Wrap(err, "failed to write traces file")
+	}
+	return errors.Wrap(os.Rename(tmpPath, path), "failed to write traces file")
+}
+
+// lockFile takes an exclusive lock on path, creating it if it doesn't
+// exist, and returns a function that releases it.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open lock file")
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "failed to lock file")
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN) //nolint:errcheck // Why: closing the file releases the lock anyways
+		f.Close()
+	}, nil
+}
+
+// RecentTraces returns the recorded CLI invocations, oldest first
+func RecentTraces() ([]Trace, error) {
+	path, err := getTracesFile()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Trace{}, nil
+		}
+		return nil, errors.Wrap(err, "failed to read traces file")
+	}
+
+	traces := make([]Trace, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		var t Trace
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			// Skip lines that were partially written
+			continue
+		}
+		traces = append(traces, t)
+	}
+
+	return traces, scanner.Err()
+}
+
+// TraceCommands wraps the actions of the provided commands, and their
+// subcommands, so that each invocation is recorded with RecordTrace.
+// Failing to record a trace doesn't fail the command.
+func TraceCommands(cmds []*cli.Command) {
+	for _, cmd := range cmds {
+		TraceCommands(cmd.Subcommands)
+
+		if cmd.Action == nil {
+			continue
+		}
+
+		action := cmd.Action
+		cmd.Action = func(c *cli.Context) error {
+			start := time.Now()
+			err := action(c)
+
+			t := &Trace{
+				Time:     start,
+				Command:  c.Command.FullName(),
+				Args:     c.Args().Slice(),
+				Duration: time.Since(start),
+				Version:  app.Info().Version,
+			}
+			if err != nil {
+				t.Error = err.Error()
+			}
+			RecordTrace(t) //nolint:errcheck // Why: Best effort
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package devenvutil
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRecordTrace(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	traces, err := RecentTraces()
+	assert.NilError(t, err)
+	assert.Equal(t, len(traces), 0)
+
+	for i := 0; i < maxTraces+5; i++ {
+		assert.NilError(t, RecordTrace(&Trace{
+			Time:     time.Now(),
+			Command:  "apps deploy",
+			Args:     []string{fmt.Sprintf("app-%d", i)},
+			Duration: time.Second,
+		}))
+	}
+
+	// Only the most recent traces are kept
+	traces, err = RecentTraces()
+	assert.NilError(t, err)
+	assert.Equal(t, len(traces), maxTraces)
+	assert.DeepEqual(t, traces[0].Args, []string{"app-5"})
+	assert.DeepEqual(t, traces[maxTraces-1].Args, []string{fmt.Sprintf("app-%d", maxTraces+4)})
+}
+
+func TestRecordTraceConcurrently(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Check(t, RecordTrace(&Trace{Time: time.Now(), Command: "apps deploy", Args: []string{fmt.Sprintf("app-%d", i)}}))
+		}(i)
+	}
+	wg.Wait()
+
+	// Traces aren't lost when commands finish at the same time
+	traces, err := RecentTraces()
+	assert.NilError(t, err)
+	assert.Equal(t, len(traces), 20)
+}
@@ -10,7 +10,16 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// KubeConfigEnvVar is an environment variable that overrides the path
+// of the kubeconfig used to talk to the developer environment
+const KubeConfigEnvVar = "DEVENV_KUBECONFIG"
+
+// GetKubeConfig returns the path to the kubeconfig of the developer environment
 func GetKubeConfig() (string, error) {
+	if path := os.Getenv(KubeConfigEnvVar); path != "" {
+		return path, nil
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
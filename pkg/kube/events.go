@@ -0,0 +1,23 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Contains helpers for working with Kubernetes events
+package kube
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EventTime returns when an event last occurred. Depending on the API
+// that created it, an event may only have some of its timestamps set.
+func EventTime(e *corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
@@ -0,0 +1,53 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ingressControllerIPAnnotation is set on the ingress controller service
+	// when it is accessible at a known IP, e.g. on local clusters
+	ingressControllerIPAnnotation = "devenv.outreach.io/local-ip"
+
+	// FallbackIngressControllerIP is the IP address of the ingress controller
+	// when it isn't exposed through a load balancer
+	FallbackIngressControllerIP = "127.0.0.1"
+)
+
+// ErrIngressControllerNoIP is returned by IngressControllerIP when the
+// ingress controller hasn't been assigned an IP address yet
+var ErrIngressControllerNoIP = fmt.Errorf("ingress controller has no IP address")
+
+// IngressControllerIP returns the IP address of the ingress controller being
+// used in the devenv. If it is a load balancer that hasn't been assigned an
+// IP address yet, ErrIngressControllerNoIP is returned.
+func IngressControllerIP(ctx context.Context, k kubernetes.Interface) (string, error) {
+	s, err := k.CoreV1().Services("nginx-ingress").Get(ctx, "ingress-nginx-controller", metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get ingress controller service")
+	}
+
+	// return the value of the ingress controller IP annotation if
+	// it's found.
+	if ip, ok := s.Annotations[ingressControllerIPAnnotation]; ok {
+		return ip, nil
+	}
+
+	// if we're not a type loadbalancer, return the fallback IP
+	// we have no idea where it is accessible
+	if s.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return FallbackIngressControllerIP, nil
+	}
+
+	for i := range s.Status.LoadBalancer.Ingress {
+		return s.Status.LoadBalancer.Ingress[i].IP, nil
+	}
+
+	return "", ErrIngressControllerNoIP
+}
@@ -135,3 +135,19 @@ func StreamPodLogs(ctx context.Context, k kubernetes.Interface,
 
 	return r, nil
 }
+
+// StreamContainerLogs streams the logs of a container in a pod. Unlike
+// StreamPodLogs, the pod isn't required to be running and the provided
+// options, e.g. Follow or SinceSeconds, are used as-is.
+func StreamContainerLogs(ctx context.Context, k kubernetes.Interface,
+	name, namespace, container string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	logOpts := opts.DeepCopy()
+	logOpts.Container = container
+
+	r, err := k.CoreV1().Pods(namespace).GetLogs(name, logOpts).Stream(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stream logs of container %s in pod %s/%s", container, namespace, name)
+	}
+
+	return r, nil
+}
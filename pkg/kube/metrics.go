@@ -0,0 +1,29 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Contains helpers for reading metrics from metrics-server
+package kube
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// NodeUsage returns the resource usage of each node, by name. An
+// error is returned if metrics-server is unavailable.
+func NodeUsage(ctx context.Context, mc metricsclient.Interface) (map[string]corev1.ResourceList, error) {
+	metrics, err := mc.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list node metrics")
+	}
+
+	usage := make(map[string]corev1.ResourceList, len(metrics.Items))
+	for i := range metrics.Items {
+		usage[metrics.Items[i].Name] = metrics.Items[i].Usage
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,95 @@
+package kubernetesruntime
+
+import (
+	"context"
+
+	"github.com/getoutreach/devenv/pkg/kube"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// nodeProblemConditions are node conditions that denote a problem with
+// a node when they are true.
+var nodeProblemConditions = []corev1.NodeConditionType{
+	corev1.NodeMemoryPressure,
+	corev1.NodeDiskPressure,
+	corev1.NodePIDPressure,
+	corev1.NodeNetworkUnavailable,
+}
+
+// GetClusterStatus populates the node and resource information of a
+// RuntimeStatus from a running cluster. Usage information is only populated
+// if mc isn't nil and metrics-server is available. This isn't done by Status,
+// which is called often, e.g. by the agent, because it's slow.
+func GetClusterStatus(ctx context.Context, k kubernetes.Interface, mc metricsclient.Interface, resp *RuntimeStatus) error {
+	nodes, err := k.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+
+	var usage map[string]corev1.ResourceList
+	if mc != nil {
+		// metrics-server is optional, so don't fail if we can't get metrics
+		usage, _ = kube.NodeUsage(ctx, mc) //nolint:errcheck // Why: Usage is best effort
+	}
+
+	resources := &ResourceStatus{}
+	resp.Nodes = make([]NodeStatus, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		n := &nodes.Items[i]
+
+		ns := NodeStatus{
+			Name:        n.Name,
+			Capacity:    n.Status.Capacity,
+			Allocatable: n.Status.Allocatable,
+			Usage:       usage[n.Name],
+			Conditions:  make([]NodeCondition, 0, len(n.Status.Conditions)),
+			Images:      len(n.Status.Images),
+		}
+		for j := range n.Status.Conditions {
+			cond := &n.Status.Conditions[j]
+			ns.Conditions = append(ns.Conditions, NodeCondition{
+				Type:    string(cond.Type),
+				Status:  string(cond.Status),
+				Message: cond.Message,
+			})
+
+			if cond.Type == corev1.NodeReady {
+				ns.Ready = cond.Status == corev1.ConditionTrue
+				continue
+			}
+
+			for _, t := range nodeProblemConditions {
+				if cond.Type == t && cond.Status == corev1.ConditionTrue {
+					ns.Problems = append(ns.Problems, string(cond.Type))
+				}
+			}
+		}
+		for j := range n.Spec.Taints {
+			ns.Taints = append(ns.Taints, n.Spec.Taints[j].ToString())
+		}
+
+		resources.CPUCapacity.Add(*n.Status.Capacity.Cpu())
+		resources.MemoryCapacity.Add(*n.Status.Capacity.Memory())
+		resp.Nodes = append(resp.Nodes, ns)
+	}
+	resp.Resources = resources
+
+	if usage == nil {
+		return nil
+	}
+
+	cpu, mem := resource.Quantity{}, resource.Quantity{}
+	for _, u := range usage {
+		cpu.Add(*u.Cpu())
+		mem.Add(*u.Memory())
+	}
+	resources.CPUUsage = &cpu
+	resources.MemoryUsage = &mem
+
+	return nil
+}
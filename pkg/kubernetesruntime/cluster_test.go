@@ -0,0 +1,49 @@
+package kubernetesruntime
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetClusterStatus(t *testing.T) {
+	newNode := func(name, cpu string, conditions ...corev1.NodeCondition) *corev1.Node {
+		capacity := corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		}
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{Taints: []corev1.Taint{{Key: "role", Value: name, Effect: corev1.TaintEffectNoSchedule}}},
+			Status:     corev1.NodeStatus{Capacity: capacity, Allocatable: capacity, Conditions: conditions},
+		}
+	}
+
+	k := fake.NewSimpleClientset(
+		newNode("a", "2", corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}),
+		newNode("b", "4",
+			corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionFalse},
+			corev1.NodeCondition{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue, Message: "disk is full"},
+		),
+	)
+
+	var resp RuntimeStatus
+	assert.NilError(t, GetClusterStatus(context.Background(), k, nil, &resp))
+
+	assert.Equal(t, len(resp.Nodes), 2)
+	assert.Equal(t, resp.Nodes[0].Ready, true)
+	assert.Equal(t, resp.Nodes[1].Ready, false)
+	assert.DeepEqual(t, resp.Nodes[1].Problems, []string{"DiskPressure"})
+	assert.DeepEqual(t, resp.Nodes[1].Conditions[1], NodeCondition{Type: "DiskPressure", Status: "True", Message: "disk is full"})
+	assert.DeepEqual(t, resp.Nodes[0].Taints, []string{"role=a:NoSchedule"})
+	assert.Equal(t, resp.Resources.CPUCapacity.String(), "6")
+	assert.Equal(t, resp.Resources.MemoryCapacity.String(), "2Gi")
+
+	// Usage is only set with metrics-server
+	assert.Assert(t, resp.Resources.CPUUsage == nil)
+}
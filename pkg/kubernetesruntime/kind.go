@@ -1,7 +1,9 @@
 package kubernetesruntime
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -9,10 +11,9 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/getoutreach/devenv/cmd/devenv/status"
 	"github.com/getoutreach/devenv/pkg/cmdutil"
-	"github.com/getoutreach/devenv/pkg/containerruntime"
 	"github.com/getoutreach/devenv/pkg/embed"
+	"github.com/getoutreach/devenv/pkg/status"
 	"github.com/getoutreach/gobox/pkg/app"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/pkg/errors"
@@ -21,6 +22,7 @@ import (
 	"k8s.io/client-go/tools/clientcmd/api"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	dockerclient "github.com/docker/docker/client"
 )
 
@@ -28,6 +30,26 @@ const (
 	KindVersion     = "v0.13.0-outreach.1"
 	KindDownloadURL = "https://github.com/getoutreach/kind/releases/download/" + KindVersion + "/kind-" + runtime.GOOS + "-" + runtime.GOARCH
 	KindClusterName = "dev-environment"
+
+	// kindClusterLabel and kindRoleLabel are labels that kind
+	// sets on the containers backing each node.
+	kindClusterLabel = "io.x-k8s.kind.cluster"
+	kindRoleLabel    = "io.x-k8s.kind.role"
+
+	// kindStopTimeout is how long to wait for a node to shutdown
+	// before it's killed.
+	kindStopTimeout = 30 * time.Second
+
+	// KindSnapshotChunkCachePath is the path, in every kind node, of the
+	// directory on the host that the chunks of snapshots are cached in.
+	// It's shared by every kind cluster, and kept when they're destroyed.
+	KindSnapshotChunkCachePath = "/var/lib/devenv/snapshot-chunks"
+
+	// KindClusterNameEnvVar is an environment variable that overrides the
+	// name of the kind cluster, which allows more than one cluster to exist
+	// at once, e.g. when generating snapshots in parallel. The kubeconfig
+	// context is always named KindClusterName.
+	KindClusterNameEnvVar = "DEVENV_KIND_CLUSTER_NAME"
 )
 
 var configTemplate = template.Must(template.New("kind.yaml").Parse(string(embed.MustRead(embed.Config.ReadFile("config/kind.yaml")))))
@@ -37,6 +59,23 @@ var EnsureKind = (&KindRuntime{}).ensureKind
 
 type KindRuntime struct {
 	log logrus.FieldLogger
+
+	// Workers are worker nodes to create when creating a cluster
+	Workers KindWorkers
+}
+
+// GetKindClusterName returns the name of the kind cluster
+func GetKindClusterName() string {
+	if name := os.Getenv(KindClusterNameEnvVar); name != "" {
+		return name
+	}
+	return KindClusterName
+}
+
+// GetKindControlPlaneContainer returns the name of the container
+// backing the control-plane node of the kind cluster
+func GetKindControlPlaneContainer() string {
+	return GetKindClusterName() + "-control-plane"
 }
 
 // NewKindRuntime creates a new kind runtime
@@ -68,13 +107,13 @@ func (*KindRuntime) GetConfig() RuntimeConfig {
 	return RuntimeConfig{
 		Name:        "kind",
 		Type:        RuntimeTypeLocal,
-		ClusterName: "dev-environment",
+		ClusterName: GetKindClusterName(),
 	}
 }
 
 // Status gets the status of a runtime
 func (kr *KindRuntime) Status(ctx context.Context) RuntimeStatus {
-	resp := RuntimeStatus{status.Status{
+	resp := RuntimeStatus{Status: status.Status{
 		Status: status.Unknown,
 	}}
 
@@ -86,7 +125,7 @@ func (kr *KindRuntime) Status(ctx context.Context) RuntimeStatus {
 
 	// check the status of the k3s container to determine
 	// if it's stopped
-	cont, err := d.ContainerInspect(ctx, containerruntime.ContainerName)
+	cont, err := d.ContainerInspect(ctx, GetKindControlPlaneContainer())
 	if err != nil {
 		if dockerclient.IsErrNotFound(err) {
 			resp.Status.Status = status.Unprovisioned
@@ -103,6 +142,14 @@ func (kr *KindRuntime) Status(ctx context.Context) RuntimeStatus {
 		resp.Version = cont.Config.Labels["io.outreach.devenv.version"]
 	}
 
+	if t, err := time.Parse(time.RFC3339Nano, cont.Created); err == nil {
+		resp.CreatedAt = &t
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, cont.State.StartedAt); err == nil && !t.IsZero() {
+		resp.StartedAt = &t
+	}
+
 	// parse the container state
 	if cont.State.Status == "exited" {
 		resp.Status.Status = status.Stopped
@@ -139,19 +186,63 @@ func (kr *KindRuntime) Create(ctx context.Context) error {
 		tagSuffix = "-" + runtime.GOARCH
 	}
 
-	err = configTemplate.Execute(renderedConfig, map[string]string{
+	var buf bytes.Buffer
+	err = configTemplate.Execute(&buf, map[string]interface{}{
 		"Home":          homeDir,
 		"Name":          "",
 		"DevenvVersion": app.Info().Version,
 		"TagSuffix":     tagSuffix,
+		// Only the default cluster binds to the host's HTTP(S) ports, so
+		// that other clusters don't conflict with it
+		"HostPorts": GetKindClusterName() == KindClusterName,
 	})
 	if err != nil {
 		return errors.Wrap(err, "failed to generate kind configuration")
 	}
 
+	overrides, err := LoadKindOverrides()
+	if err != nil {
+		return err
+	}
+	if overrides != nil {
+		kr.log.Info("Applying kind configuration overrides")
+	}
+
+	if overrides == nil {
+		overrides = &KindOverrides{}
+	}
+
+	chunkCacheDir := filepath.Join(homeDir, ".local", "dev-environment", "snapshot-chunks")
+	if err := os.MkdirAll(chunkCacheDir, 0o755); err != nil { //nolint:govet // Why: OK w/ err shadow
+		return errors.Wrap(err, "failed to create snapshot chunk cache")
+	}
+	overrides.ExtraMounts = append(overrides.ExtraMounts, KindMount{
+		HostPath:      chunkCacheDir,
+		ContainerPath: KindSnapshotChunkCachePath,
+	})
+
+	if kr.Workers.Count > 0 {
+		workers, err := kr.Workers.nodes() //nolint:govet // Why: OK w/ err shadow
+		if err != nil {
+			return err
+		}
+
+		overrides.Nodes = append(overrides.Nodes, workers...)
+	}
+
+	conf, err := applyKindOverrides(buf.Bytes(), overrides)
+	if err != nil {
+		return errors.Wrap(err, "failed to apply kind configuration overrides")
+	}
+
+	if _, err := renderedConfig.Write(conf); err != nil { //nolint:govet // Why: OK w/ err shadow
+		return errors.Wrap(err, "failed to write kind configuration")
+	}
+	renderedConfig.Close() //nolint:errcheck
+
 	// we use a temp file for the kubeconfig because we don't actually use it
-	cmd := exec.CommandContext(ctx, kind, "create", "cluster", "--name", KindClusterName, "--wait", "5m", "--config", renderedConfig.Name(),
-		"--kubeconfig", filepath.Join(os.TempDir(), "devenv-kubeconfig-tmp.yaml"))
+	cmd := exec.CommandContext(ctx, kind, "create", "cluster", "--name", GetKindClusterName(), "--wait", "5m", "--config", renderedConfig.Name(),
+		"--kubeconfig", filepath.Join(os.TempDir(), "devenv-kubeconfig-tmp-"+GetKindClusterName()+".yaml"))
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
@@ -165,10 +256,32 @@ func (kr *KindRuntime) Destroy(ctx context.Context) error {
 		return err
 	}
 
-	b, err := exec.CommandContext(ctx, kind, "delete", "cluster", "--name", KindClusterName).CombinedOutput()
+	b, err := exec.CommandContext(ctx, kind, "delete", "cluster", "--name", GetKindClusterName()).CombinedOutput()
 	return errors.Wrapf(err, "failed to run kind: %s", b)
 }
 
+// getNodeContainers returns the IDs of the containers backing the nodes of
+// the kind cluster, the control-plane node is always first.
+func (kr *KindRuntime) getNodeContainers(ctx context.Context, d dockerclient.APIClient) ([]string, error) {
+	conts, err := d.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", kindClusterLabel+"="+GetKindClusterName())),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list kind node containers")
+	}
+
+	ids := []string{GetKindControlPlaneContainer()}
+	for i := range conts {
+		if conts[i].Labels[kindRoleLabel] == "control-plane" {
+			continue
+		}
+		ids = append(ids, conts[i].ID)
+	}
+
+	return ids, nil
+}
+
 // Stop stops a kind cluster
 func (kr *KindRuntime) Stop(ctx context.Context) error {
 	d, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv)
@@ -176,8 +289,20 @@ func (kr *KindRuntime) Stop(ctx context.Context) error {
 		return errors.Wrap(err, "failed to create docker client")
 	}
 
-	timeout := time.Duration(0)
-	return d.ContainerStop(ctx, containerruntime.ContainerName, &timeout)
+	ids, err := kr.getNodeContainers(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	// Stop the workers before the control-plane
+	timeout := kindStopTimeout
+	for i := len(ids) - 1; i >= 0; i-- {
+		if err := d.ContainerStop(ctx, ids[i], &timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Start starts a kind cluster
@@ -187,7 +312,55 @@ func (kr *KindRuntime) Start(ctx context.Context) error {
 		return errors.Wrap(err, "failed to create docker client")
 	}
 
-	return d.ContainerStart(ctx, containerruntime.ContainerName, types.ContainerStartOptions{})
+	ids, err := kr.getNodeContainers(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := d.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NetworkBytes returns the total number of bytes received and transmitted
+// by the nodes of the kind cluster. This is traffic between the nodes and
+// the outside world, e.g. localizer tunnels and kubectl, not traffic between
+// pods.
+func (kr *KindRuntime) NetworkBytes(ctx context.Context) (uint64, error) {
+	d, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create docker client")
+	}
+
+	ids, err := kr.getNodeContainers(ctx, d)
+	if err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	for _, id := range ids {
+		resp, err := d.ContainerStatsOneShot(ctx, id)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to get node container stats")
+		}
+
+		var stats types.StatsJSON
+		err = json.NewDecoder(resp.Body).Decode(&stats)
+		resp.Body.Close()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to decode node container stats")
+		}
+
+		for _, n := range stats.Networks {
+			total += n.RxBytes + n.TxBytes
+		}
+	}
+
+	return total, nil
 }
 
 // GetKubeConfig reads a kubeconfig from Kind and returns it
@@ -200,7 +373,7 @@ func (kr *KindRuntime) GetKubeConfig(ctx context.Context) (*api.Config, error) {
 		return nil, err
 	}
 
-	b, err := exec.CommandContext(ctx, kind, "get", "kubeconfig", "--name", KindClusterName).Output()
+	b, err := exec.CommandContext(ctx, kind, "get", "kubeconfig", "--name", GetKindClusterName()).Output()
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to run kind: %s", b)
 	}
@@ -210,9 +383,9 @@ func (kr *KindRuntime) GetKubeConfig(ctx context.Context) (*api.Config, error) {
 		return nil, errors.Wrap(err, "failed to load client config")
 	}
 
-	if c, ok := kubeconfig.Contexts["kind-"+KindClusterName]; ok {
+	if c, ok := kubeconfig.Contexts["kind-"+GetKindClusterName()]; ok {
 		kubeconfig.Contexts[KindClusterName] = c
-		delete(kubeconfig.Contexts, "kind-"+KindClusterName)
+		delete(kubeconfig.Contexts, "kind-"+GetKindClusterName())
 	}
 
 	kubeconfig.CurrentContext = KindClusterName
@@ -235,7 +408,7 @@ func (kr *KindRuntime) GetClusters(ctx context.Context) ([]*RuntimeCluster, erro
 
 	return []*RuntimeCluster{
 		{
-			Name:        KindClusterName,
+			Name:        GetKindClusterName(),
 			RuntimeName: kr.GetConfig().Name,
 			KubeConfig:  kubeconfig,
 		},
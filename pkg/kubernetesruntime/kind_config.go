@@ -0,0 +1,243 @@
+package kubernetesruntime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KindOverridesFile is the name of the file, in the devenv config dir,
+// that contains user provided overrides for the kind cluster configuration
+const KindOverridesFile = "kind-overrides.yaml"
+
+// KindOverrides are user provided overrides that are merged into the
+// kind cluster configuration when a cluster is created.
+type KindOverrides struct {
+	// NodeImage is the image to use for all nodes, unless a node sets
+	// its own image.
+	NodeImage string `yaml:"nodeImage"`
+
+	// ExtraPortMappings are port mappings added to the control-plane node
+	ExtraPortMappings []KindPortMapping `yaml:"extraPortMappings"`
+
+	// ExtraMounts are mounts added to every node
+	ExtraMounts []KindMount `yaml:"extraMounts"`
+
+	// KubeadmConfigPatches are kubeadm config patches applied to the
+	// whole cluster.
+	KubeadmConfigPatches []string `yaml:"kubeadmConfigPatches"`
+
+	// FeatureGates are Kubernetes feature gates to enable or disable
+	FeatureGates map[string]bool `yaml:"featureGates"`
+
+	// Nodes are extra nodes to add to the cluster, e.g. workers
+	Nodes []KindNode `yaml:"nodes"`
+}
+
+// KindPortMapping is a port on a node that is exposed on the host
+type KindPortMapping struct {
+	ContainerPort int32  `yaml:"containerPort"`
+	HostPort      int32  `yaml:"hostPort"`
+	ListenAddress string `yaml:"listenAddress,omitempty"`
+	Protocol      string `yaml:"protocol,omitempty"`
+}
+
+// KindMount is a path on the host that is mounted into a node
+type KindMount struct {
+	HostPath      string `yaml:"hostPath"`
+	ContainerPath string `yaml:"containerPath"`
+	ReadOnly      bool   `yaml:"readOnly,omitempty"`
+	Propagation   string `yaml:"propagation,omitempty"`
+}
+
+// KindNode is a node in a kind cluster
+type KindNode struct {
+	// Role is the role of the node, defaults to worker
+	Role string `yaml:"role"`
+
+	// Image is the image to use for this node, defaults to
+	// the image of the control-plane node.
+	Image string `yaml:"image,omitempty"`
+
+	ExtraMounts          []KindMount       `yaml:"extraMounts,omitempty"`
+	ExtraPortMappings    []KindPortMapping `yaml:"extraPortMappings,omitempty"`
+	Labels               map[string]string `yaml:"labels,omitempty"`
+	KubeadmConfigPatches []string          `yaml:"kubeadmConfigPatches,omitempty"`
+
+	// Rest contains fields that we don't need to modify, this
+	// ensures they are preserved when re-rendering the config.
+	Rest map[string]interface{} `yaml:",inline"`
+}
+
+// kindConfig is the subset of the kind cluster configuration that
+// can be overridden, the rest of the configuration is preserved.
+type kindConfig struct {
+	Nodes                []KindNode      `yaml:"nodes"`
+	FeatureGates         map[string]bool `yaml:"featureGates,omitempty"`
+	KubeadmConfigPatches []string        `yaml:"kubeadmConfigPatches,omitempty"`
+
+	Rest map[string]interface{} `yaml:",inline"`
+}
+
+// LoadKindOverrides reads the user's kind overrides, if they
+// don't have any nil is returned.
+func LoadKindOverrides() (*KindOverrides, error) {
+	confDir, err := config.GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(confDir, KindOverridesFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read kind overrides")
+	}
+
+	var overrides KindOverrides
+	if err := yaml.UnmarshalStrict(b, &overrides); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", KindOverridesFile)
+	}
+
+	return &overrides, nil
+}
+
+// applyKindOverrides merges the provided overrides into a rendered kind
+// cluster configuration and returns the new configuration.
+func applyKindOverrides(rendered []byte, overrides *KindOverrides) ([]byte, error) {
+	if overrides == nil {
+		return rendered, nil
+	}
+
+	var conf kindConfig
+	if err := yaml.Unmarshal(rendered, &conf); err != nil {
+		return nil, errors.Wrap(err, "failed to parse kind configuration")
+	}
+
+	if len(conf.Nodes) == 0 {
+		return nil, errors.New("kind configuration has no nodes")
+	}
+
+	// Nodes from the template use the override image, extra nodes
+	// only use it if they don't set their own.
+	if overrides.NodeImage != "" {
+		for i := range conf.Nodes {
+			conf.Nodes[i].Image = overrides.NodeImage
+		}
+	}
+
+	for i := range overrides.Nodes {
+		n := overrides.Nodes[i]
+		if n.Role == "" {
+			n.Role = "worker"
+		}
+		if n.Image == "" {
+			n.Image = conf.Nodes[0].Image
+		}
+		conf.Nodes = append(conf.Nodes, n)
+	}
+
+	for i := range conf.Nodes {
+		conf.Nodes[i].ExtraMounts = append(conf.Nodes[i].ExtraMounts, overrides.ExtraMounts...)
+	}
+	conf.Nodes[0].ExtraPortMappings = append(conf.Nodes[0].ExtraPortMappings, overrides.ExtraPortMappings...)
+
+	conf.KubeadmConfigPatches = append(conf.KubeadmConfigPatches, overrides.KubeadmConfigPatches...)
+
+	if len(overrides.FeatureGates) != 0 && conf.FeatureGates == nil {
+		conf.FeatureGates = make(map[string]bool)
+	}
+	for k, v := range overrides.FeatureGates {
+		conf.FeatureGates[k] = v
+	}
+
+	return yaml.Marshal(&conf)
+}
+
+// KindWorkers is the configuration of worker nodes created, in
+// addition to the control-plane node, when creating a kind cluster.
+type KindWorkers struct {
+	// Count is the number of worker nodes to create
+	Count int
+
+	// Labels are labels applied to every worker node
+	Labels map[string]string
+
+	// Taints are taints applied to every worker node
+	Taints []corev1.Taint
+}
+
+// nodes returns the kind nodes for the configured workers
+func (w *KindWorkers) nodes() ([]KindNode, error) {
+	var patches []string
+	if len(w.Taints) != 0 {
+		// kind doesn't support taints natively, so we have kubeadm
+		// register the node with them instead.
+		taints := make([]map[string]string, len(w.Taints))
+		for i := range w.Taints {
+			taints[i] = map[string]string{
+				"key":    w.Taints[i].Key,
+				"effect": string(w.Taints[i].Effect),
+			}
+			if w.Taints[i].Value != "" {
+				taints[i]["value"] = w.Taints[i].Value
+			}
+		}
+
+		patch, err := yaml.Marshal(map[string]interface{}{
+			"kind": "JoinConfiguration",
+			"nodeRegistration": map[string]interface{}{
+				"taints": taints,
+			},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create taints patch")
+		}
+		patches = append(patches, string(patch))
+	}
+
+	nodes := make([]KindNode, w.Count)
+	for i := range nodes {
+		nodes[i] = KindNode{
+			Role:                 "worker",
+			Labels:               w.Labels,
+			KubeadmConfigPatches: patches,
+		}
+	}
+
+	return nodes, nil
+}
+
+// ParseTaint parses a taint in the format used by kubectl, e.g.
+// key=value:NoSchedule or key:NoSchedule
+func ParseTaint(s string) (corev1.Taint, error) {
+	var taint corev1.Taint
+
+	spl := strings.Split(s, ":")
+	if len(spl) != 2 || spl[0] == "" {
+		return taint, fmt.Errorf("invalid taint '%s', expected key[=value]:effect", s)
+	}
+
+	switch effect := corev1.TaintEffect(spl[1]); effect {
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		taint.Effect = effect
+	default:
+		return taint, fmt.Errorf("invalid taint effect '%s', expected one of: %s, %s, %s", spl[1],
+			corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+	}
+
+	kv := strings.SplitN(spl[0], "=", 2)
+	taint.Key = kv[0]
+	if len(kv) == 2 {
+		taint.Value = kv[1]
+	}
+
+	return taint, nil
+}
@@ -0,0 +1,87 @@
+package kubernetesruntime
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+	"gotest.tools/v3/assert"
+)
+
+const testKindConfig = `
+kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+  - role: control-plane
+    image: "kindest/node:v1.21.10"
+    extraLabels:
+      io.outreach.devenv.version: "v1.0.0"
+    extraPortMappings:
+      - containerPort: 32080
+        hostPort: 80
+`
+
+func TestApplyKindOverrides(t *testing.T) {
+	b, err := applyKindOverrides([]byte(testKindConfig), &KindOverrides{
+		NodeImage:         "kindest/node:v1.23.0",
+		ExtraMounts:       []KindMount{{HostPath: "/src", ContainerPath: "/src"}},
+		ExtraPortMappings: []KindPortMapping{{ContainerPort: 30000, HostPort: 3000}},
+		FeatureGates:      map[string]bool{"EphemeralContainers": true},
+		Nodes: []KindNode{
+			{},
+			{Image: "kindest/node:custom"},
+		},
+	})
+	assert.NilError(t, err)
+
+	var conf kindConfig
+	assert.NilError(t, yaml.Unmarshal(b, &conf))
+
+	assert.Equal(t, conf.Rest["kind"], "Cluster")
+	assert.DeepEqual(t, conf.FeatureGates, map[string]bool{"EphemeralContainers": true})
+	assert.Equal(t, len(conf.Nodes), 3)
+
+	cp := conf.Nodes[0]
+	assert.Equal(t, cp.Role, "control-plane")
+	assert.Equal(t, cp.Image, "kindest/node:v1.23.0")
+	assert.Equal(t, len(cp.ExtraPortMappings), 2)
+	assert.Equal(t, len(cp.ExtraMounts), 1)
+	assert.Assert(t, cp.Rest["extraLabels"] != nil)
+
+	assert.Equal(t, conf.Nodes[1].Role, "worker")
+	assert.Equal(t, conf.Nodes[1].Image, "kindest/node:v1.23.0")
+	assert.Equal(t, len(conf.Nodes[1].ExtraMounts), 1)
+	assert.Equal(t, len(conf.Nodes[1].ExtraPortMappings), 0)
+	assert.Equal(t, conf.Nodes[2].Image, "kindest/node:custom")
+}
+
+func TestKindConfigHostPorts(t *testing.T) {
+	for _, hostPorts := range []bool{true, false} {
+		var buf bytes.Buffer
+		assert.NilError(t, configTemplate.Execute(&buf, map[string]interface{}{"HostPorts": hostPorts}))
+
+		var conf kindConfig
+		assert.NilError(t, yaml.Unmarshal(buf.Bytes(), &conf))
+		assert.Equal(t, len(conf.Nodes[0].ExtraPortMappings) != 0, hostPorts)
+		assert.Equal(t, len(conf.Nodes[0].ExtraMounts), 1)
+	}
+}
+
+func TestParseTaint(t *testing.T) {
+	taint, err := ParseTaint("dedicated=backend:NoSchedule")
+	assert.NilError(t, err)
+	assert.Equal(t, taint.Key, "dedicated")
+	assert.Equal(t, taint.Value, "backend")
+	assert.Equal(t, string(taint.Effect), "NoSchedule")
+
+	taint, err = ParseTaint("dedicated:NoExecute")
+	assert.NilError(t, err)
+	assert.Equal(t, taint.Key, "dedicated")
+	assert.Equal(t, taint.Value, "")
+
+	_, err = ParseTaint("dedicated=backend")
+	assert.ErrorContains(t, err, "invalid taint")
+
+	_, err = ParseTaint("dedicated=backend:Sometimes")
+	assert.ErrorContains(t, err, "invalid taint effect")
+}
@@ -7,11 +7,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/getoutreach/devenv/cmd/devenv/status"
 	"github.com/getoutreach/devenv/pkg/config"
+	"github.com/getoutreach/devenv/pkg/status"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -64,6 +67,104 @@ type RuntimeCluster struct {
 // RuntimeStatus is the status of a given runtime
 type RuntimeStatus struct {
 	status.Status
+
+	// Nodes is the status of each node in the cluster, this is only
+	// set by GetClusterStatus.
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+
+	// Resources is the total capacity and usage of all nodes in the
+	// cluster, this is only set by GetClusterStatus.
+	Resources *ResourceStatus `json:"resources,omitempty"`
+
+	// CreatedAt is when the cluster was created
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// StartedAt is when the cluster was last started (or woken up)
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+
+	// Loft is information specific to the loft runtime, this is only
+	// set by the loft runtime.
+	Loft *LoftStatus `json:"loft,omitempty"`
+}
+
+// NodeStatus is the status of a node in a cluster
+type NodeStatus struct {
+	// Name is the name of this node
+	Name string `json:"name"`
+
+	// Ready denotes if this node is ready to run pods
+	Ready bool `json:"ready"`
+
+	// Problems is a list of conditions that are currently affecting
+	// this node, e.g. MemoryPressure
+	Problems []string `json:"problems,omitempty"`
+
+	// Capacity is the total resources of this node
+	Capacity corev1.ResourceList `json:"capacity"`
+
+	// Allocatable is the resources of this node available to pods
+	Allocatable corev1.ResourceList `json:"allocatable"`
+
+	// Usage is the resources used on this node, this is only
+	// set if metrics-server is available.
+	Usage corev1.ResourceList `json:"usage,omitempty"`
+
+	// Conditions are the conditions of this node
+	Conditions []NodeCondition `json:"conditions"`
+
+	// Taints are the taints on this node, e.g. key=value:NoSchedule
+	Taints []string `json:"taints,omitempty"`
+
+	// Images is the number of images on this node
+	Images int `json:"images"`
+}
+
+// NodeCondition is a condition of a node
+type NodeCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// ResourceStatus is the capacity and usage of a cluster
+type ResourceStatus struct {
+	// CPUCapacity is the total CPU capacity of the cluster
+	CPUCapacity resource.Quantity `json:"cpuCapacity"`
+
+	// CPUUsage is the total CPU usage of the cluster, this is only
+	// set if metrics-server is available.
+	CPUUsage *resource.Quantity `json:"cpuUsage,omitempty"`
+
+	// MemoryCapacity is the total memory capacity of the cluster
+	MemoryCapacity resource.Quantity `json:"memoryCapacity"`
+
+	// MemoryUsage is the total memory usage of the cluster, this is only
+	// set if metrics-server is available.
+	MemoryUsage *resource.Quantity `json:"memoryUsage,omitempty"`
+}
+
+// LoftStatus is the status of a loft vcluster
+type LoftStatus struct {
+	// BackingCluster is the cluster the vcluster is running in
+	BackingCluster string `json:"backingCluster"`
+
+	// Region is the region of the backing cluster, if known
+	Region string `json:"region,omitempty"`
+
+	// Space is the space (namespace) that backs the vcluster
+	Space string `json:"space"`
+
+	// SleepAfter is how long the vcluster can be inactive before
+	// being put to sleep
+	SleepAfter time.Duration `json:"sleepAfter,omitempty"`
+
+	// SleepDeadline is when the vcluster will be put to sleep
+	// if no further activity occurs
+	SleepDeadline *time.Time `json:"sleepDeadline,omitempty"`
+
+	// SleepingSince is when the vcluster was put to sleep, only
+	// set if it's currently sleeping.
+	SleepingSince *time.Time `json:"sleepingSince,omitempty"`
 }
 
 // Runtime is the Kubernetes Runtime interface that all
@@ -10,13 +10,15 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/getoutreach/devenv/cmd/devenv/status"
 	"github.com/getoutreach/devenv/pkg/cmdutil"
+	"github.com/getoutreach/devenv/pkg/status"
 	"github.com/getoutreach/gobox/pkg/box"
 	"github.com/getoutreach/gobox/pkg/region"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 
@@ -27,13 +29,21 @@ import (
 )
 
 const (
-	loftVersion     = "v2.2.0"
-	loftDownloadURL = "https://github.com/loft-sh/loft/releases/download/" + loftVersion + "/loft-" + runtime.GOOS + "-" + runtime.GOARCH
+	LoftVersion     = "v2.2.0"
+	LoftDownloadURL = "https://github.com/loft-sh/loft/releases/download/" + LoftVersion + "/loft-" + runtime.GOOS + "-" + runtime.GOARCH
+
+	// loftKubeConfigTTL is how long a cached vcluster kubeconfig is
+	// considered valid before it is fetched from loft again.
+	loftKubeConfigTTL = 12 * time.Hour
 )
 
+// loftKubeConfigCachePath is the path, relative to the user's home dir,
+// that vcluster kubeconfigs are cached in.
+var loftKubeConfigCachePath = filepath.Join(".outreach", ".cache", "dev-environment", "loft")
+
 type LoftRuntime struct {
 	// kubeConfig stores the kubeconfig of the last created
-	// cluster by Create()
+	// or fetched cluster, see GetKubeConfig()
 	kubeConfig []byte
 
 	box *box.Config
@@ -60,7 +70,7 @@ func NewLoftRuntime() *LoftRuntime {
 // the location of loft binary. Note: this outputs text
 // if loft is being downloaded
 func (*LoftRuntime) ensureLoft(log logrus.FieldLogger) (string, error) {
-	return cmdutil.EnsureBinary(log, "loft-"+loftVersion, "loft", loftDownloadURL, "")
+	return cmdutil.EnsureBinary(log, "loft-"+LoftVersion, "loft", LoftDownloadURL, "")
 }
 
 func (lr *LoftRuntime) Configure(log logrus.FieldLogger, conf *box.Config) {
@@ -157,7 +167,7 @@ func (lr *LoftRuntime) GetConfig() RuntimeConfig {
 
 // Status returns the status of our cluster
 func (lr *LoftRuntime) Status(ctx context.Context) RuntimeStatus {
-	resp := RuntimeStatus{status.Status{
+	resp := RuntimeStatus{Status: status.Status{
 		Status: status.Unprovisioned,
 	}}
 
@@ -176,6 +186,23 @@ func (lr *LoftRuntime) Status(ctx context.Context) RuntimeStatus {
 			continue
 		}
 
+		createdAt := c.CreationTimestamp.Time
+		resp.CreatedAt = &createdAt
+		resp.Loft = &LoftStatus{
+			BackingCluster: c.Cluster,
+			Region:         lr.getClusterRegion(c.Cluster),
+			Space:          c.Namespace,
+		}
+		lr.populateSleepStatus(ctx, c, &resp)
+
+		// Use the last time the vcluster became ready as when it was started
+		for j := range c.Status.Conditions {
+			if cond := &c.Status.Conditions[j]; cond.Type == v1.ReadyCondition && !cond.LastTransitionTime.IsZero() {
+				startedAt := cond.LastTransitionTime.Time
+				resp.StartedAt = &startedAt
+			}
+		}
+
 		if c.Status.Phase == v1.VirtualClusterDeployed {
 			resp.Status.Status = status.Running
 			return resp
@@ -190,6 +217,53 @@ func (lr *LoftRuntime) Status(ctx context.Context) RuntimeStatus {
 	return resp
 }
 
+// getClusterRegion returns the region of a backing cluster based
+// on the box configuration, if it's not known an empty string is
+// returned.
+func (lr *LoftRuntime) getClusterRegion(clusterName string) string {
+	if lr.box == nil {
+		return ""
+	}
+
+	for _, c := range lr.box.DeveloperEnvironmentConfig.RuntimeConfig.Loft.Clusters {
+		if c.Name == clusterName {
+			return string(c.Region)
+		}
+	}
+
+	return ""
+}
+
+// populateSleepStatus populates the sleep mode information of the space
+// backing the provided vcluster. This is best effort, so errors are ignored.
+func (lr *LoftRuntime) populateSleepStatus(ctx context.Context, vc *loftctlhelper.ClusterVirtualCluster, resp *RuntimeStatus) {
+	clusterClient, err := lr.loftctl.Cluster(vc.Cluster)
+	if err != nil {
+		return
+	}
+
+	space, err := clusterClient.Agent().ClusterV1().Spaces().Get(ctx, vc.Namespace, metav1.GetOptions{})
+	if err != nil || space.Status.SleepModeConfig == nil {
+		return
+	}
+	sleepConfig := space.Status.SleepModeConfig
+
+	if sleepConfig.Status.SleepingSince != 0 {
+		sleepingSince := time.Unix(sleepConfig.Status.SleepingSince, 0)
+		resp.Loft.SleepingSince = &sleepingSince
+	}
+
+	if sleepConfig.Spec.SleepAfter == 0 {
+		return
+	}
+	resp.Loft.SleepAfter = time.Duration(sleepConfig.Spec.SleepAfter) * time.Second
+
+	if resp.Loft.SleepingSince == nil && sleepConfig.Status.LastActivity != 0 {
+		deadline := time.Unix(sleepConfig.Status.LastActivity, 0).Add(resp.Loft.SleepAfter)
+		resp.Loft.SleepDeadline = &deadline
+	}
+}
+
 // getPreferredCluster returns the backing cluster that should be used for this devenv
 func (lr *LoftRuntime) getPreferredCluster(ctx context.Context) string {
 	loftConfig := &lr.box.DeveloperEnvironmentConfig.RuntimeConfig.Loft
@@ -258,7 +332,15 @@ func (lr *LoftRuntime) Create(ctx context.Context) error {
 	}
 
 	lr.kubeConfig, err = os.ReadFile(kubeConfig.Name())
-	return errors.Wrap(err, "failed to read kubeconfig")
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	if err := lr.saveCachedKubeConfig(lr.kubeConfig); err != nil { //nolint:govet // Why: OK w/ err shadow
+		lr.log.WithError(err).Warn("failed to cache vcluster kubeconfig")
+	}
+
+	return nil
 }
 
 func (lr *LoftRuntime) Destroy(ctx context.Context) error {
@@ -268,7 +350,16 @@ func (lr *LoftRuntime) Destroy(ctx context.Context) error {
 	}
 
 	out, err := exec.CommandContext(ctx, loft, "delete", "vcluster", "--delete-space", lr.clusterName).CombinedOutput()
-	return errors.Wrapf(err, "failed to delete loft vcluster: %s", out)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete loft vcluster: %s", out)
+	}
+
+	lr.kubeConfig = nil
+	if err := lr.removeCachedKubeConfig(); err != nil { //nolint:govet // Why: OK w/ err shadow
+		lr.log.WithError(err).Warn("failed to remove cached vcluster kubeconfig")
+	}
+
+	return nil
 }
 
 // getSpaceForVcluster returns the space backing a given vcluster
@@ -318,12 +409,119 @@ func (lr *LoftRuntime) Start(ctx context.Context) error {
 	return errors.Wrapf(err, "failed to wakeup loft vcluster: %s", out)
 }
 
+// GetKubeConfig returns the kubeconfig for the vcluster owned by the
+// current user. The kubeconfig is read from memory, then from the on-disk
+// cache, and if neither are available (or the cache has expired) it is
+// fetched from loft and cached again.
 func (lr *LoftRuntime) GetKubeConfig(ctx context.Context) (*api.Config, error) {
-	if len(lr.kubeConfig) == 0 {
-		return nil, fmt.Errorf("found no kubeconfig, was a cluster created?")
+	if len(lr.kubeConfig) != 0 {
+		return loadLoftKubeConfig(lr.kubeConfig)
 	}
 
-	kubeconfig, err := clientcmd.Load(lr.kubeConfig)
+	if b, err := lr.readCachedKubeConfig(); err == nil {
+		lr.kubeConfig = b
+		return loadLoftKubeConfig(lr.kubeConfig)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		lr.log.WithError(err).Warn("failed to read cached vcluster kubeconfig, fetching from loft")
+	}
+
+	if err := lr.ensureClient(); err != nil {
+		return nil, errors.Wrap(err, "failed to create loft client")
+	}
+
+	clusterName := lr.GetConfig().ClusterName
+	clusters, err := loftctlhelper.GetVirtualClusters(lr.loftctl, newLoftLogger())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list vclusters")
+	}
+
+	var vc *loftctlhelper.ClusterVirtualCluster
+	for i := range clusters {
+		if clusters[i].Name == clusterName {
+			vc = &clusters[i]
+			break
+		}
+	}
+	if vc == nil {
+		return nil, fmt.Errorf("found no vcluster named %s, was a cluster created?", clusterName)
+	}
+
+	b, err := lr.fetchKubeConfigForVCluster(ctx, vc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lr.saveCachedKubeConfig(b); err != nil {
+		lr.log.WithError(err).Warn("failed to cache vcluster kubeconfig")
+	}
+	lr.kubeConfig = b
+
+	return loadLoftKubeConfig(lr.kubeConfig)
+}
+
+// getKubeConfigCacheFile returns the path to the cached kubeconfig
+// of the vcluster owned by the current user
+func (lr *LoftRuntime) getKubeConfigCacheFile() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get user's home dir")
+	}
+
+	return filepath.Join(homeDir, loftKubeConfigCachePath, lr.GetConfig().ClusterName+".yaml"), nil
+}
+
+// readCachedKubeConfig reads the cached kubeconfig from disk. If the cache
+// has expired, os.ErrNotExist is returned.
+func (lr *LoftRuntime) readCachedKubeConfig() ([]byte, error) {
+	cacheFile, err := lr.getKubeConfigCacheFile()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(info.ModTime()) > loftKubeConfigTTL {
+		return nil, os.ErrNotExist
+	}
+
+	return os.ReadFile(cacheFile)
+}
+
+// saveCachedKubeConfig writes a kubeconfig to the on-disk cache
+func (lr *LoftRuntime) saveCachedKubeConfig(b []byte) error {
+	cacheFile, err := lr.getKubeConfigCacheFile()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create kubeconfig cache dir")
+	}
+
+	return errors.Wrap(os.WriteFile(cacheFile, b, 0o600), "failed to write cached kubeconfig")
+}
+
+// removeCachedKubeConfig removes the cached kubeconfig, if it exists
+func (lr *LoftRuntime) removeCachedKubeConfig() error {
+	cacheFile, err := lr.getKubeConfigCacheFile()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(cacheFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// loadLoftKubeConfig parses a kubeconfig created by loft and renames
+// its context to the one devenv expects
+func loadLoftKubeConfig(b []byte) (*api.Config, error) {
+	kubeconfig, err := clientcmd.Load(b)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to load kube config from loft")
 	}
@@ -339,41 +537,52 @@ func (lr *LoftRuntime) GetKubeConfig(ctx context.Context) (*api.Config, error) {
 	return kubeconfig, nil
 }
 
-// TODO(jaredallard): plumb error information, share between provision and switch
-func (lr *LoftRuntime) getKubeConfigForVCluster(ctx context.Context, vc *loftctlhelper.ClusterVirtualCluster) *api.Config {
-	loft, _ := lr.ensureLoft(lr.log) //nolint:errcheck
+// fetchKubeConfigForVCluster fetches a raw kubeconfig for the provided
+// vcluster from loft
+func (lr *LoftRuntime) fetchKubeConfigForVCluster(ctx context.Context, vc *loftctlhelper.ClusterVirtualCluster) ([]byte, error) {
+	loft, err := lr.ensureLoft(lr.log)
+	if err != nil {
+		return nil, err
+	}
 
 	kubeConfig, err := os.CreateTemp("", "loft-kubeconfig-*")
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	kubeConfig.Close() //nolint:errcheck
 	defer os.Remove(kubeConfig.Name())
 
 	cmd := exec.CommandContext(ctx, loft, "use", "vcluster", "--cluster",
-		vc.ClusterName, vc.Name)
+		vc.Cluster, vc.Name)
 	cmd.Env = append(os.Environ(), "KUBECONFIG="+kubeConfig.Name())
-	if err := cmd.Run(); err != nil {
-		return nil
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get kubeconfig for vcluster: %s", out)
 	}
 
 	out, err := os.ReadFile(kubeConfig.Name())
-	if err != nil {
-		return nil
+	return out, errors.Wrap(err, "failed to read kubeconfig")
+}
+
+// TODO(jaredallard): plumb error information, share between provision and switch
+func (lr *LoftRuntime) getKubeConfigForVCluster(ctx context.Context, vc *loftctlhelper.ClusterVirtualCluster) *api.Config {
+	// Our own vcluster goes through GetKubeConfig so that the cache is used
+	if vc.Name == lr.GetConfig().ClusterName {
+		kubeconfig, err := lr.GetKubeConfig(ctx)
+		if err != nil {
+			return nil
+		}
+		return kubeconfig
 	}
 
-	kubeconfig, err := clientcmd.Load(out)
+	b, err := lr.fetchKubeConfigForVCluster(ctx, vc)
 	if err != nil {
 		return nil
 	}
 
-	// Assume the first context is the one we want
-	for k := range kubeconfig.Contexts {
-		kubeconfig.Contexts[KindClusterName] = kubeconfig.Contexts[k]
-		delete(kubeconfig.Contexts, k)
-		break
+	kubeconfig, err := loadLoftKubeConfig(b)
+	if err != nil {
+		return nil
 	}
-	kubeconfig.CurrentContext = KindClusterName
 
 	return kubeconfig
 }
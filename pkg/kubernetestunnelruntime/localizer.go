@@ -1,11 +1,20 @@
 package kubernetestunnelruntime
 
 import (
+	"context"
+	"io"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/getoutreach/devenv/pkg/cmdutil"
+	localizerapi "github.com/getoutreach/localizer/api"
+	"github.com/getoutreach/localizer/pkg/localizer"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/grpclog"
 )
 
 //nolint:gochecknoglobals
@@ -23,3 +32,27 @@ func EnsureLocalizer(log logrus.FieldLogger) (string, error) { //nolint:funlen
 	log.WithField("version", LocalizerVersion).WithField("url", LocalizerDownloadURL).Info("using localizer")
 	return cmdutil.EnsureBinary(log, "localizer-"+LocalizerVersion, "Kubernetes Tunnel Runtime (localizer)", LocalizerDownloadURL, "localizer")
 }
+
+// ListServices returns the services tunneled by a running localizer
+func ListServices(ctx context.Context) ([]*localizerapi.ListService, error) {
+	// gRPC logs connection problems, which we return as errors instead
+	grpclog.SetLoggerV2(grpclog.NewLoggerV2(io.Discard, io.Discard, io.Discard))
+
+	// localizer is communicating over the local network, so this
+	// should be quick if it is actually running.
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	client, closer, err := localizer.Connect(ctx, grpc.WithBlock(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to localizer")
+	}
+	defer closer()
+
+	resp, err := client.List(ctx, &localizerapi.ListRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list localizer tunnels")
+	}
+
+	return resp.Services, nil
+}
@@ -0,0 +1,85 @@
+package snapshoter
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// WriteArchive writes every object in a bucket under root+prefix into a snapshot
+// archive. The names of the files in the archive are relative to root.
+func WriteArchive(ctx context.Context, aw *snapshot.ArchiveWriter, m *minio.Client, bucket, root, prefix string) error {
+	for obj := range m.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: root + prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return errors.Wrap(obj.Err, "failed to list objects in local S3")
+		}
+
+		// Skip empty keys
+		if strings.EqualFold(obj.Key, "") {
+			continue
+		}
+
+		sObj, err := m.GetObject(ctx, bucket, obj.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return errors.Wrap(err, "failed to get object from local S3")
+		}
+
+		info, err := sObj.Stat()
+		if err != nil {
+			sObj.Close()
+			return errors.Wrap(err, "failed to stat object")
+		}
+
+		err = aw.WriteFile(&tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       strings.TrimPrefix(info.Key, root),
+			Size:       info.Size,
+			Mode:       0o755,
+			ModTime:    info.LastModified,
+			AccessTime: info.LastModified,
+			ChangeTime: info.LastModified,
+		}, sObj)
+		sObj.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to archive object '%s' from local S3", info.Key)
+		}
+	}
+
+	return nil
+}
+
+// ExtractArchive uploads the files in a tar archive into a bucket, the
+// names of the files are prefixed with prefix. If the archive contains
+// checksums, each file is verified once it's uploaded and the first corrupt
+// file is removed from the bucket and returned as an error.
+func ExtractArchive(ctx context.Context, tr *tar.Reader, m *minio.Client, bucket, prefix string) error {
+	v := snapshot.NewArchiveVerifier(tr)
+	for {
+		header, r, err := v.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		fileName := prefix + strings.TrimPrefix(header.Name, "./")
+		_, err = m.PutObject(ctx, bucket, fileName, r, header.Size, minio.PutObjectOptions{
+			SendContentMd5: true,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to upload file '%s'", fileName)
+		}
+
+		// PutObject only reads the size of the file, so it never sees
+		// the checksum error returned at the end of the file
+		if err := r.Verify(); err != nil { //nolint:govet // Why: OK shadowing err
+			m.RemoveObject(ctx, bucket, fileName, minio.RemoveObjectOptions{}) //nolint:errcheck // Why: Best effort
+			return err
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package snapshoter
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/getoutreach/devenv/internal/snapshot"
+	"github.com/getoutreach/devenv/internal/snapshot/snapshottest"
+	"github.com/minio/minio-go/v7"
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteAndExtractArchive(t *testing.T) {
+	ctx := context.Background()
+	src := &snapshottest.S3{}
+	m := snapshottest.NewS3Client(t, src)
+	for _, key := range []string{"root/backups/a", "root/backups/b/c", "root/restic/d"} {
+		_, err := m.PutObject(ctx, "bucket", key, strings.NewReader(key), int64(len(key)), minio.PutObjectOptions{})
+		assert.NilError(t, err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	aw := snapshot.NewArchiveWriter(tw)
+	assert.NilError(t, WriteArchive(ctx, aw, m, "bucket", "root/", "backups/"))
+	assert.NilError(t, aw.Close())
+	assert.NilError(t, tw.Close())
+
+	dest := &snapshottest.S3{}
+	err := ExtractArchive(ctx, tar.NewReader(&buf), snapshottest.NewS3Client(t, dest), "bucket", "imported/")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dest.Objects(), map[string][]byte{
+		"imported/backups/a":   []byte("root/backups/a"),
+		"imported/backups/b/c": []byte("root/backups/b/c"),
+	})
+}
+
+func TestExtractArchiveRemovesCorruptFiles(t *testing.T) {
+	archive := snapshottest.NewArchive(t, [][2]string{
+		{"a", "a"},
+		{"a" + snapshot.ChecksumSuffix, snapshot.Digest([]byte("a"))},
+		{"b", "corrupt"},
+		{"b" + snapshot.ChecksumSuffix, snapshot.Digest([]byte("b"))},
+	})
+
+	dest := &snapshottest.S3{}
+	err := ExtractArchive(context.Background(), tar.NewReader(archive), snapshottest.NewS3Client(t, dest), "bucket", "")
+	assert.ErrorContains(t, err, "file 'b' failed checksum validation")
+
+	// Files before the corrupt file were valid, so they're kept
+	assert.DeepEqual(t, dest.Objects(), map[string][]byte{"a": []byte("a")})
+}
@@ -31,6 +31,9 @@ type SnapshotBackend struct {
 	*minio.Client
 
 	fw *portforward.PortForwarder
+
+	// endpoint is the local address minio is port-forwarded to
+	endpoint string
 }
 
 // NewSnapshotBackend creates a connection to the snapshot backend
@@ -69,15 +72,36 @@ loop:
 		Name(pod.Name).
 		SubResource("portforward").URL())
 
-	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{"61002:9000"}, ctx.Done(), nil, os.Stdin, os.Stderr)
+	// Use a random local port so that more than one developer environment
+	// can be talked to at once, e.g. when generating snapshots in parallel
+	ready := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{"0:9000"}, ctx.Done(), ready, os.Stdin, os.Stderr)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create port-forward")
 	}
 	sb.fw = fw
 
-	go fw.ForwardPorts() //nolint:errcheck // Why: Best attempt port-forward creation
+	fwErr := make(chan error, 1)
+	go func() { fwErr <- fw.ForwardPorts() }()
+
+	select {
+	case <-ready:
+	case err := <-fwErr:
+		if err == nil {
+			err = fmt.Errorf("port-forward exited")
+		}
+		return nil, errors.Wrap(err, "failed to create port-forward")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ports, err := fw.GetPorts()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get port-forward ports")
+	}
+	sb.endpoint = fmt.Sprintf("127.0.0.1:%d", ports[0].Local)
 
-	m, err := minio.New("127.0.0.1:61002", &minio.Options{
+	m, err := minio.New(sb.endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
 		Secure: false,
 	})
@@ -112,7 +136,7 @@ func (sb *SnapshotBackend) waitForMinio(ctx context.Context) error {
 			return fmt.Errorf("reached maximum attempts to talk to minio")
 		}
 
-		resp, err := http.Get("http://127.0.0.1:61002/minio/health/live")
+		resp, err := http.Get("http://" + sb.endpoint + "/minio/health/live")
 		if err == nil {
 			resp.Body.Close()
 
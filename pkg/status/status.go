@@ -0,0 +1,28 @@
+// Package status contains the types used to describe the status
+// of a developer environment. These are shared between the status
+// command and the kubernetes runtimes.
+package status
+
+const (
+	Degraded      = "degraded"
+	Unprovisioned = "unprovisioned"
+	Running       = "running"
+	Stopped       = "stopped"
+	Unknown       = "unknown"
+)
+
+type Status struct {
+	// Status is the status of the cluster in text format, eventually
+	// will be enum of: running, stopped, unprovisioned, degraded, or unknown
+	Status string `json:"status"`
+
+	// Reason is included when a status may need potential
+	// explanation. For now this is just non-running or stopped statuses
+	Reason string `json:"reason,omitempty"`
+
+	// KubernetesVersion is the version of the developer environment
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+
+	// Version is the version of the developer environment
+	Version string `json:"version,omitempty"`
+}